@@ -1,16 +1,30 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
 
+	"github.com/fasaxi-linker/servergo/internal/db"
+	"github.com/fasaxi-linker/servergo/internal/runs"
 	"github.com/fasaxi-linker/servergo/pkg/core"
 	"github.com/spf13/cobra"
 )
 
 var (
-	configStr string
+	configStr  string
+	dryRun     bool
+	planOutput string
+	repair     bool
+	reportFile string
+	exitCode   int // set by the commands, main exits with it
 )
 
 func main() {
@@ -23,24 +37,7 @@ func main() {
 		Use:   "run",
 		Short: "Run the linker task",
 		Run: func(cmd *cobra.Command, args []string) {
-			var opts core.Options
-			if err := json.Unmarshal([]byte(configStr), &opts); err != nil {
-				fmt.Printf("Error parsing config: %v\n", err)
-				os.Exit(1)
-			}
-			
-			// Overrides from flags could go here
-			
-			stats, err := core.Run(opts, func(level, msg string) {
-				fmt.Printf("[%s] %s\n", level, msg)
-			})
-			if err != nil {
-				fmt.Printf("Task failed: %v\n", err)
-				os.Exit(1)
-			}
-			
-			// Output stats
-			printStats(stats)
+			exitCode = runLinks()
 		},
 	}
 
@@ -48,58 +45,231 @@ func main() {
 		Use:   "prune",
 		Short: "Prune invalid links",
 		Run: func(cmd *cobra.Command, args []string) {
-			var opts core.Options
-			if err := json.Unmarshal([]byte(configStr), &opts); err != nil {
-				fmt.Printf("Error parsing config: %v\n", err)
-				os.Exit(1)
-			}
-
-			files, err := core.GetPruneFiles(opts)
-			if err != nil {
-				fmt.Printf("Prune analysis failed: %v\n", err)
-				os.Exit(1)
-			}
-
-			if len(files) == 0 {
-				fmt.Println("No files to prune.")
-				return
-			}
-
-			fmt.Printf("Found %d files to delete:\n", len(files))
-			for _, f := range files {
-				fmt.Println(f)
-			}
-
-			if !opts.DeleteDir { // Wait, reusing deleteDir as 'confirm' flag hack? No.
-				// Core prune usually asks implementation to confirm.
-				// In CLI usually we add --yes flag.
-				// For now, let's just list them unless we implement confirmation or --yes.
-				// Assuming automation usage mostly via JSON config including "WithoutConfirm".
-			}
-			
-			// Implementation of deletion
-			// Using rm directly provided by `core` logic? 
-			// Core.PruneFiles? I missed `core.RmFiles` implementation exposed?
-			// `core/cleaner.go` has helpers but maybe I need to call os.Remove
-			
-			// For now, simple removal loop:
-			// (Assuming user acknowledges if we actually run this command)
-			// But safer to just List unless force flag is present.
+			exitCode = runPrune()
 		},
 	}
 
 	runCmd.Flags().StringVar(&configStr, "config", "", "JSON configuration string")
 	runCmd.MarkFlagRequired("config")
+	runCmd.Flags().BoolVar(&repair, "repair", false, "Re-check cached files and re-link targets whose inode no longer matches the source")
+	runCmd.Flags().StringVar(&reportFile, "report", "", "Write the outcome of every file to this file as JSON Lines")
 	
 	pruneCmd.Flags().StringVar(&configStr, "config", "", "JSON configuration string")
 	pruneCmd.MarkFlagRequired("config")
 
+	for _, c := range []*cobra.Command{runCmd, pruneCmd} {
+		c.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be done without touching the filesystem")
+		c.Flags().StringVar(&planOutput, "plan-output", "", "With --dry-run, write every planned action to this file as JSON Lines")
+	}
+
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(pruneCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		exitCode = 1
+	}
+	os.Exit(exitCode)
+}
+
+// runLinks executes the run command and returns the exit code. Commands return
+// instead of calling os.Exit so deferred cleanup like closing the database runs.
+func runLinks() int {
+	var opts core.Options
+	if err := json.Unmarshal([]byte(configStr), &opts); err != nil {
+		fmt.Printf("Error parsing config: %v\n", err)
+		return 1
+	}
+
+	// Overrides from flags
+	if repair {
+		opts.Repair = true
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if dryRun {
+		if opts.OpenCache {
+			openCacheOnly()
+			defer db.Close()
+		}
+		return runPlan(ctx, core.PlanRun, opts)
+	}
+
+	history := openHistory()
+	defer db.Close()
+
+	var reportOut *bufio.Writer
+	if reportFile != "" {
+		f, err := os.Create(reportFile)
+		if err != nil {
+			fmt.Printf("Error creating report file: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		reportOut = bufio.NewWriter(f)
+		opts.Report = core.NewReport(reportOut)
+	}
+
+	startTime := time.Now()
+	stats, err := core.Run(ctx, opts, func(level, msg string) {
+		fmt.Printf("[%s] %s\n", level, msg)
+	})
+	if reportOut != nil {
+		if werr := reportOut.Flush(); werr != nil || opts.Report.Err() != nil {
+			fmt.Printf("Warning: failed to write report: %v\n", errors.Join(werr, opts.Report.Err()))
+		} else {
+			fmt.Printf("Report written to %s (%d lines)\n", reportFile, opts.Report.Count())
+		}
+	}
+	if history != nil {
+		record := runs.NewRecord(opts.TaskID, opts.Name, runs.TriggerCLI, startTime, time.Now(), stats, err)
+		if _, err := history.Add(record); err != nil {
+			fmt.Printf("Warning: failed to save run history: %v\n", err)
+		}
+	}
+	if stats.Cancelled {
+		fmt.Println("Task cancelled, partial result:")
+		printStats(stats)
+		return 130
+	}
+	if err != nil {
+		fmt.Printf("Task failed: %v\n", err)
+		return 1
+	}
+
+	// Output stats
+	printStats(stats)
+	return 0
+}
+
+// runPrune executes the prune command and returns the exit code
+func runPrune() int {
+	var opts core.Options
+	if err := json.Unmarshal([]byte(configStr), &opts); err != nil {
+		fmt.Printf("Error parsing config: %v\n", err)
+		return 1
+	}
+	opts.Type = "prune"
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Deleting is irreversible: use --dry-run to review the files first
+	if dryRun {
+		return runPlan(ctx, core.PlanPrune, opts)
+	}
+
+	history := openHistory()
+	defer db.Close()
+
+	startTime := time.Now()
+	stats, err := core.Prune(ctx, opts, func(level, msg string) {
+		fmt.Printf("[%s] %s\n", level, msg)
+	})
+	if history != nil {
+		record := runs.NewRecord(opts.TaskID, opts.Name, runs.TriggerCLI, startTime, time.Now(), stats, err)
+		if _, err := history.Add(record); err != nil {
+			fmt.Printf("Warning: failed to save run history: %v\n", err)
+		}
+	}
+	if stats.Cancelled {
+		fmt.Println("Prune cancelled, partial result:")
+		printStats(stats)
+		return 130
+	}
+	if err != nil {
+		fmt.Printf("Prune failed: %v\n", err)
+		return 1
+	}
+
+	printStats(stats)
+	fmt.Printf("Deleted: %d (%d bytes), empty dirs removed: %d\n", stats.DeletedCount, stats.FreedBytes, stats.RemovedDirs)
+	return 0
+}
+
+// runPlan computes a dry-run plan, prints its summary and either lists every
+// action or writes them to --plan-output. It returns the exit code.
+func runPlan(ctx context.Context, build func(context.Context, core.Options) (*core.Plan, error), opts core.Options) int {
+	plan, err := build(ctx, opts)
+	if err != nil {
+		if ctx.Err() != nil {
+			fmt.Println("Dry run cancelled")
+			return 130
+		}
+		fmt.Printf("Dry run failed: %v\n", err)
+		return 1
+	}
+
+	if planOutput != "" {
+		f, err := os.Create(planOutput)
+		if err != nil {
+			fmt.Printf("Error creating plan file: %v\n", err)
+			return 1
+		}
+		if err := plan.WriteJSONL(f); err != nil {
+			f.Close()
+			fmt.Printf("Error writing plan file: %v\n", err)
+			return 1
+		}
+		f.Close()
+		fmt.Printf("Plan written to %s\n", planOutput)
+	} else {
+		for _, a := range plan.Actions {
+			switch {
+			case a.Reason != "":
+				fmt.Printf("[%s] %s (%s)\n", a.Action, a.Source, a.Reason)
+			case a.Source != "" && a.Target != "":
+				fmt.Printf("[%s] %s -> %s\n", a.Action, a.Source, a.Target)
+			default:
+				fmt.Printf("[%s] %s%s\n", a.Action, a.Source, a.Target)
+			}
+		}
+	}
+
+	fmt.Println("Dry run summary (nothing was changed):")
+	actions := make([]string, 0, len(plan.Summary.Counts))
+	for action := range plan.Summary.Counts {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	for _, action := range actions {
+		fmt.Printf("  %-12s %d\n", action, plan.Summary.Counts[action])
+	}
+	if plan.Summary.LinkBytes > 0 {
+		fmt.Printf("  bytes to link:   %d\n", plan.Summary.LinkBytes)
+	}
+	if plan.Summary.DeleteBytes > 0 {
+		fmt.Printf("  bytes to delete: %d\n", plan.Summary.DeleteBytes)
+	}
+	return 0
+}
+
+// openHistory connects to the database when it is configured through the environment,
+// so CLI runs show up in the run history and cache lookups work. It returns nil if
+// history is unavailable.
+func openHistory() *runs.Store {
+	cfg, err := db.LoadConfigFromEnv()
+	if err != nil {
+		return nil
+	}
+	if err := db.InitDB(cfg); err != nil {
+		fmt.Printf("Warning: run history disabled: %v\n", err)
+		return nil
+	}
+	return &runs.Store{}
+}
+
+// openCacheOnly connects to an existing database so a dry run can look up the
+// cache. Unlike openHistory it creates nothing, a dry run must not write.
+func openCacheOnly() {
+	cfg, err := db.LoadConfigFromEnv()
+	if err != nil {
+		return
+	}
+	if err := db.Connect(cfg); err != nil {
+		fmt.Printf("Warning: cache lookups disabled: %v\n", err)
 	}
 }
 
@@ -3,16 +3,22 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
+	"time"
 
 	"github.com/fasaxi-linker/servergo/internal/auth"
 	"github.com/fasaxi-linker/servergo/internal/cache"
 	"github.com/fasaxi-linker/servergo/internal/config"
 	"github.com/fasaxi-linker/servergo/internal/db"
 	"github.com/fasaxi-linker/servergo/internal/logs"
+	"github.com/fasaxi-linker/servergo/internal/runs"
 	"github.com/fasaxi-linker/servergo/internal/task"
 	"github.com/gin-gonic/gin"
 )
@@ -374,7 +380,8 @@ func (h *Handler) GetTaskList(c *gin.Context) {
 	// Frontend expects isWatching field
 	type TaskWithStatus struct {
 		task.Task
-		IsWatching bool `json:"isWatching"`
+		IsWatching bool       `json:"isWatching"`
+		NextRunAt  *time.Time `json:"nextRunAt,omitempty"`
 	}
 
 	result := make([]TaskWithStatus, len(tasks))
@@ -383,6 +390,9 @@ func (h *Handler) GetTaskList(c *gin.Context) {
 			Task:       t,
 			IsWatching: h.Service.IsWatching(t.ID),
 		}
+		if next, ok := h.Service.NextRun(t.ID); ok {
+			result[i].NextRunAt = &next
+		}
 	}
 
 	Success(c, result)
@@ -402,23 +412,46 @@ func (h *Handler) GetTask(c *gin.Context) {
 		return
 	}
 	Success(c, gin.H{ // Frontend expects mixed object
-		"id":            t.ID,
-		"name":          t.Name,
-		"type":          t.Type,
-		"pathsMapping":  t.PathsMapping,
-		"include":       t.Include,
-		"exclude":       t.Exclude,
-		"saveMode":      t.SaveMode,
-		"openCache":     t.OpenCache,
-		"mkdirIfSingle": t.MkdirIfSingle,
-		"deleteDir":     t.DeleteDir,
-		"keepDirStruct": t.KeepDirStruct,
-		"scheduleType":  t.ScheduleType,
-		"scheduleValue": t.ScheduleValue,
-		"reverse":       t.Reverse,
-		"config":        t.Config,   // config name (display)
-		"configId":      t.ConfigID, // association id
-		"isWatching":    h.Service.IsWatching(taskID),
+		"id":               t.ID,
+		"name":             t.Name,
+		"type":             t.Type,
+		"pathsMapping":     t.PathsMapping,
+		"include":          t.Include,
+		"exclude":          t.Exclude,
+		"saveMode":         t.SaveMode,
+		"openCache":        t.OpenCache,
+		"mkdirIfSingle":    t.MkdirIfSingle,
+		"deleteDir":        t.DeleteDir,
+		"keepDirStruct":    t.KeepDirStruct,
+		"contentHash":      t.ContentHash,
+		"scanOnStart":      t.ScanOnStart,
+		"stableSeconds":    t.StableSeconds,
+		"tempSuffixes":     t.TempSuffixes,
+		"linkStrategy":     t.LinkStrategy,
+		"conflictPolicy":   t.ConflictPolicy,
+		"destTemplate":     t.DestTemplate,
+		"destPattern":      t.DestPattern,
+		"naming":           t.Naming,
+		"companions":       t.Companions,
+		"companionPrimary": t.CompanionPrimary,
+		"minSize":          t.MinSize,
+		"maxSize":          t.MaxSize,
+		"minAgeSeconds":    t.MinAgeSeconds,
+		"modifiedAfter":    t.ModifiedAfter,
+		"modifiedBefore":   t.ModifiedBefore,
+		"matchCase":        t.MatchCase,
+		"matchHidden":      t.MatchHidden,
+		"workers":          t.Workers,
+		"maxOpsPerSecond":  t.MaxOpsPerSecond,
+		"lowPriorityIO":    t.LowPriorityIO,
+		"runReport":        t.RunReport,
+		"scheduleType":     t.ScheduleType,
+		"scheduleValue":    t.ScheduleValue,
+		"reverse":          t.Reverse,
+		"priority":         t.Priority,
+		"config":           t.Config,   // config name (display)
+		"configId":         t.ConfigID, // association id
+		"isWatching":       h.Service.IsWatching(taskID),
 	})
 }
 
@@ -430,35 +463,14 @@ func (h *Handler) CreateTask(c *gin.Context) {
 	}
 
 	// Resolve config name by ID (association by ID)
-	if t.ConfigID > 0 {
-		if cfg, detail, ok := h.ConfigService.GetByID(t.ConfigID); ok {
-			t.Config = cfg.Name
-			// Sync config fields to task on creation
-			var rc struct {
-				Include       []string `json:"include"`
-				Exclude       []string `json:"exclude"`
-				KeepDirStruct bool     `json:"keepDirStruct"`
-				OpenCache     bool     `json:"openCache"`
-				MkdirIfSingle bool     `json:"mkdirIfSingle"`
-				DeleteDir     bool     `json:"deleteDir"`
-			}
-			if err := json.Unmarshal([]byte(detail), &rc); err == nil {
-				t.Include = rc.Include
-				t.Exclude = rc.Exclude
-				t.KeepDirStruct = rc.KeepDirStruct
-				t.OpenCache = rc.OpenCache
-				t.MkdirIfSingle = rc.MkdirIfSingle
-				t.DeleteDir = rc.DeleteDir
-			}
-		} else {
-			ErrorMsg(c, "Config not found")
-			return
-		}
+	if t.ConfigID > 0 && !h.syncTaskConfig(&t) {
+		ErrorMsg(c, "Config not found")
+		return
 	}
 
-	// Validate paths
-	if err := validatePathMapping(t); err != nil {
-		ErrorMsg(c, err.Error())
+	result := h.Service.Validate(t)
+	if !result.Valid {
+		ValidationFailed(c, result)
 		return
 	}
 
@@ -466,7 +478,7 @@ func (h *Handler) CreateTask(c *gin.Context) {
 		Error(c, err)
 		return
 	}
-	Success(c, true)
+	SuccessWithWarnings(c, true, result.Issues)
 }
 
 func (h *Handler) UpdateTask(c *gin.Context) {
@@ -485,35 +497,8 @@ func (h *Handler) UpdateTask(c *gin.Context) {
 	}
 
 	// Resolve config name by ID (association by ID)
-	if body.Task.ConfigID > 0 {
-		if cfg, detail, ok := h.ConfigService.GetByID(body.Task.ConfigID); ok {
-			body.Task.Config = cfg.Name
-			// Sync config fields to task when config ID changes
-			var rc struct {
-				Include       []string `json:"include"`
-				Exclude       []string `json:"exclude"`
-				KeepDirStruct bool     `json:"keepDirStruct"`
-				OpenCache     bool     `json:"openCache"`
-				MkdirIfSingle bool     `json:"mkdirIfSingle"`
-				DeleteDir     bool     `json:"deleteDir"`
-			}
-			if err := json.Unmarshal([]byte(detail), &rc); err == nil {
-				body.Task.Include = rc.Include
-				body.Task.Exclude = rc.Exclude
-				body.Task.KeepDirStruct = rc.KeepDirStruct
-				body.Task.OpenCache = rc.OpenCache
-				body.Task.MkdirIfSingle = rc.MkdirIfSingle
-				body.Task.DeleteDir = rc.DeleteDir
-			}
-		} else {
-			ErrorMsg(c, "Config not found")
-			return
-		}
-	}
-
-	// Validate paths
-	if err := validatePathMapping(body.Task); err != nil {
-		ErrorMsg(c, err.Error())
+	if body.Task.ConfigID > 0 && !h.syncTaskConfig(&body.Task) {
+		ErrorMsg(c, "Config not found")
 		return
 	}
 
@@ -556,6 +541,14 @@ func (h *Handler) UpdateTask(c *gin.Context) {
 		}
 	}
 
+	// Only a changed task is checked, so an unchanged save never fails on a
+	// directory that went missing since
+	result := h.Service.Validate(body.Task)
+	if !result.Valid {
+		ValidationFailed(c, result)
+		return
+	}
+
 	// Check if task is currently watching before update
 	wasWatching := h.Service.IsWatching(body.TaskID)
 	if wasWatching {
@@ -585,7 +578,28 @@ func (h *Handler) UpdateTask(c *gin.Context) {
 			}
 		}(body.TaskID)
 	}
-	Success(c, true)
+	SuccessWithWarnings(c, true, result.Issues)
+}
+
+// ValidateTask runs the pre-flight checks of CreateTask/UpdateTask without saving.
+// Pass taskId when checking an edit so the task is not compared with itself.
+func (h *Handler) ValidateTask(c *gin.Context) {
+	var body struct {
+		TaskID int `json:"taskId"`
+		task.Task
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		Error(c, err)
+		return
+	}
+
+	if body.Task.ConfigID > 0 && !h.syncTaskConfig(&body.Task) {
+		ErrorMsg(c, "Config not found")
+		return
+	}
+
+	body.Task.ID = body.TaskID
+	Success(c, h.Service.Validate(body.Task))
 }
 
 func (h *Handler) DeleteTask(c *gin.Context) {
@@ -618,19 +632,29 @@ func (h *Handler) RunTask(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "Task not found"})
 		return
 	}
+	// Repair mode re-checks cached files and re-links diverged targets
+	opts.Repair = c.Query("repair") == "true"
 
-	// Check if already running
+	// Check if already running or waiting
 	if task.IsRunning(taskID) {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": "任务正在执行中", "running": true})
 		return
 	}
+	if task.IsQueued(taskID) {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "任务已在排队中", "queued": true})
+		return
+	}
 
-	// Start async execution
+	// Start async execution, or wait in the run queue
 	if err := task.StartRun(taskID, opts); err != nil {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
 		return
 	}
 
+	if q, ok := task.QueueStatus(taskID); ok {
+		c.JSON(http.StatusOK, gin.H{"success": true, "message": "任务已加入执行队列", "running": false, "queued": true, "queue": q})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "任务已开始执行", "running": true})
 }
 
@@ -642,11 +666,16 @@ func (h *Handler) StopRun(c *gin.Context) {
 		return
 	}
 
+	queued := task.IsQueued(taskID)
 	if err := task.StopRun(taskID); err != nil {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
 		return
 	}
 
+	if queued {
+		c.JSON(http.StatusOK, gin.H{"success": true, "message": "已取消排队"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "任务已停止"})
 }
 
@@ -659,7 +688,249 @@ func (h *Handler) GetRunStatus(c *gin.Context) {
 	}
 
 	running := task.IsRunning(taskID)
-	c.JSON(http.StatusOK, gin.H{"running": running})
+	resp := gin.H{"running": running, "queued": false}
+	if q, ok := task.QueueStatus(taskID); ok {
+		resp["queued"] = true
+		resp["queue"] = q
+	}
+	if progress, ok := task.GetProgress(taskID); ok {
+		resp["progress"] = progress
+	}
+	if last, ok := task.LastRun(taskID); ok {
+		resp["lastRun"] = last
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// StreamRun pushes progress and log lines of a running or queued task as Server-Sent Events.
+// Events: "queued" (queue entry) while the run waits, "progress" (core.Progress),
+// "log" (level/message) and a final "done" (run result).
+func (h *Handler) StreamRun(c *gin.Context) {
+	taskIDStr := c.Query("taskId")
+	taskID, err := strconv.Atoi(taskIDStr)
+	if err != nil || taskID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "taskId parameter is required"})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	events, unsubscribe, ok := task.SubscribeRun(taskID)
+	if !ok {
+		// Neither running nor queued: report the last result (if any) and end the stream
+		done := task.RunEvent{Type: task.EventDone, Time: time.Now()}
+		if last, ok := task.LastRun(taskID); ok {
+			done.Result = last
+		}
+		c.SSEvent(task.EventDone, done)
+		return
+	}
+	defer unsubscribe()
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(ev.Type, ev)
+			return ev.Type != task.EventDone
+		case <-heartbeat.C:
+			// Comment line keeps proxies from closing an idle connection
+			fmt.Fprint(w, ": ping\n\n")
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// planPreviewLimit bounds how many plan actions are returned inline; the full plan is downloadable
+const planPreviewLimit = 500
+
+// PlanTask computes what running a task would do without touching the filesystem
+func (h *Handler) PlanTask(c *gin.Context) {
+	var body struct {
+		TaskID int  `json:"taskId"`
+		Repair bool `json:"repair"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		Error(c, err)
+		return
+	}
+	if body.TaskID <= 0 {
+		ErrorMsg(c, "taskId is required")
+		return
+	}
+	if _, ok := h.Service.Get(body.TaskID); !ok {
+		ErrorMsg(c, "任务不存在")
+		return
+	}
+
+	// Planning a large library takes a while; stop if the client goes away
+	plan, err := h.Service.BuildPlan(c.Request.Context(), body.TaskID, body.Repair)
+	if err != nil {
+		ErrorMsg(c, fmt.Sprintf("生成执行计划失败: %v", err))
+		return
+	}
+
+	actions := plan.Actions
+	truncated := len(actions) > planPreviewLimit
+	if truncated {
+		actions = actions[:planPreviewLimit]
+	}
+
+	Success(c, gin.H{
+		"type":        plan.Type,
+		"createdAt":   plan.CreatedAt,
+		"summary":     plan.Summary,
+		"total":       len(plan.Actions),
+		"actions":     actions,
+		"truncated":   truncated,
+		"downloadUrl": fmt.Sprintf("/api/task/plan/download?taskId=%d", body.TaskID),
+	})
+}
+
+// DownloadPlan serves the latest plan of a task as JSON Lines
+func (h *Handler) DownloadPlan(c *gin.Context) {
+	taskID, err := strconv.Atoi(c.Query("taskId"))
+	if err != nil || taskID <= 0 {
+		ErrorMsg(c, "taskId parameter is required")
+		return
+	}
+
+	path := task.PlanFile(taskID)
+	if _, err := os.Stat(path); err != nil {
+		ErrorMsg(c, "执行计划不存在，请先生成")
+		return
+	}
+	c.FileAttachment(path, fmt.Sprintf("plan_task_%d.jsonl", taskID))
+}
+
+// DownloadRunReport serves the per-file report of a run as JSON Lines.
+// name is a report name from lastRun.report; without it the newest report is sent.
+func (h *Handler) DownloadRunReport(c *gin.Context) {
+	taskID, err := strconv.Atoi(c.Query("taskId"))
+	if err != nil || taskID <= 0 {
+		ErrorMsg(c, "taskId parameter is required")
+		return
+	}
+
+	path, err := task.ReportFile(taskID, c.Query("name"))
+	if err != nil {
+		ErrorMsg(c, "运行报告不存在，请在任务高级选项中开启 runReport 后执行")
+		return
+	}
+	c.FileAttachment(path, fmt.Sprintf("report_task_%d_%s", taskID, filepath.Base(path)))
+}
+
+// GetTaskRuns lists run history, newest first. taskId and trigger are optional filters.
+func (h *Handler) GetTaskRuns(c *gin.Context) {
+	filter := runs.ListFilter{Trigger: c.Query("trigger")}
+	if taskIDStr := c.Query("taskId"); taskIDStr != "" {
+		taskID, err := strconv.Atoi(taskIDStr)
+		if err != nil || taskID <= 0 {
+			ErrorMsg(c, "invalid taskId")
+			return
+		}
+		filter.TaskID = taskID
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	if pageSize > 200 {
+		pageSize = 200
+	}
+
+	store := &runs.Store{}
+	list, total, err := store.List(filter, page, pageSize)
+	if err != nil {
+		ErrorMsg(c, fmt.Sprintf("读取执行记录失败: %v", err))
+		return
+	}
+
+	Success(c, gin.H{
+		"list":  list,
+		"total": total,
+	})
+}
+
+// GetTaskRunDetail returns one run including its failure summary
+func (h *Handler) GetTaskRunDetail(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil || id <= 0 {
+		ErrorMsg(c, "id parameter is required")
+		return
+	}
+
+	store := &runs.Store{}
+	record, err := store.Get(id)
+	if err != nil {
+		if errors.Is(err, runs.ErrNotFound) {
+			ErrorMsg(c, "执行记录不存在")
+			return
+		}
+		ErrorMsg(c, fmt.Sprintf("读取执行记录失败: %v", err))
+		return
+	}
+
+	Success(c, record)
+}
+
+// === Schedule ===
+
+func (h *Handler) SetSchedule(c *gin.Context) {
+	var body struct {
+		TaskID        int    `json:"taskId"`
+		ScheduleType  string `json:"scheduleType"`
+		ScheduleValue string `json:"scheduleValue"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		Error(c, err)
+		return
+	}
+
+	if body.TaskID <= 0 {
+		ErrorMsg(c, "taskId is required")
+		return
+	}
+	if body.ScheduleType == "" {
+		ErrorMsg(c, "scheduleType is required")
+		return
+	}
+
+	if err := h.Service.SetSchedule(body.TaskID, body.ScheduleType, body.ScheduleValue); err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, true)
+}
+
+func (h *Handler) CancelSchedule(c *gin.Context) {
+	taskIDStr := c.Query("taskId")
+	taskID, err := strconv.Atoi(taskIDStr)
+	if err != nil || taskID <= 0 {
+		ErrorMsg(c, "taskId parameter is required")
+		return
+	}
+
+	if err := h.Service.SetSchedule(taskID, "", ""); err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, true)
 }
 
 // === Watch ===
@@ -729,6 +1000,22 @@ func (h *Handler) GetWatchStatus(c *gin.Context) {
 	Success(c, h.Service.IsWatching(taskID))
 }
 
+func (h *Handler) GetWatchPending(c *gin.Context) {
+	taskIDStr := c.Query("taskId")
+	taskID, err := strconv.Atoi(taskIDStr)
+	if err != nil || taskID <= 0 {
+		ErrorMsg(c, "taskId parameter is required")
+		return
+	}
+
+	files, err := h.Service.GetPendingFiles(taskID)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, files)
+}
+
 func (h *Handler) GetLogFiles(c *gin.Context) {
 	taskIDStr := c.Query("taskId")
 	taskID, err := strconv.Atoi(taskIDStr)
@@ -774,7 +1061,7 @@ func (h *Handler) GetTaskLog(c *gin.Context) {
 	}
 
 	// Return structured log entries
-	logEntries, total, err := task.GetLogEntries(taskID, filename, page, pageSize, levelFilter, search)
+	logEntries, total, file, err := task.GetLogEntries(taskID, filename, page, pageSize, levelFilter, search)
 	if err != nil {
 		ErrorMsg(c, fmt.Sprintf("读取日志失败: %v", err))
 		return
@@ -787,7 +1074,7 @@ func (h *Handler) GetTaskLog(c *gin.Context) {
 	Success(c, gin.H{
 		"list":  logEntries,
 		"total": total,
-		"file":  filename,
+		"file":  file,
 	})
 }
 
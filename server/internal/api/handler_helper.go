@@ -1,24 +1,37 @@
 package api
 
 import (
-	"fmt"
-	"os"
+	"encoding/json"
 
 	"github.com/fasaxi-linker/servergo/internal/task"
 )
 
-// Helper to validate paths in task
-func validatePathMapping(t task.Task) error {
-	for _, mapping := range t.PathsMapping {
-		// Check Source
-		if _, err := os.Stat(mapping.Source); os.IsNotExist(err) {
-			return fmt.Errorf("源路径不存在: %s", mapping.Source)
-		}
+// syncTaskConfig copies the fields of the task's associated config onto it and
+// resolves the config name. It returns false if the config does not exist.
+func (h *Handler) syncTaskConfig(t *task.Task) bool {
+	cfg, detail, ok := h.ConfigService.GetByID(t.ConfigID)
+	if !ok {
+		return false
+	}
+	t.Config = cfg.Name
 
-		// Check Dest
-		if _, err := os.Stat(mapping.Dest); os.IsNotExist(err) {
-			return fmt.Errorf("目标路径不存在: %s", mapping.Dest)
-		}
+	var rc struct {
+		Include       []string `json:"include"`
+		Exclude       []string `json:"exclude"`
+		KeepDirStruct bool     `json:"keepDirStruct"`
+		OpenCache     bool     `json:"openCache"`
+		MkdirIfSingle bool     `json:"mkdirIfSingle"`
+		DeleteDir     bool     `json:"deleteDir"`
+		task.AdvancedOptions
+	}
+	if err := json.Unmarshal([]byte(detail), &rc); err == nil {
+		t.Include = rc.Include
+		t.Exclude = rc.Exclude
+		t.KeepDirStruct = rc.KeepDirStruct
+		t.OpenCache = rc.OpenCache
+		t.MkdirIfSingle = rc.MkdirIfSingle
+		t.DeleteDir = rc.DeleteDir
+		t.AdvancedOptions = rc.AdvancedOptions
 	}
-	return nil
+	return true
 }
@@ -2,14 +2,17 @@ package api
 
 import (
 	"net/http"
+	"strings"
 
+	"github.com/fasaxi-linker/servergo/internal/task"
 	"github.com/gin-gonic/gin"
 )
 
 type APIResponse struct {
-	Success      bool        `json:"success"`
-	Data         interface{} `json:"data,omitempty"`
-	ErrorMessage string      `json:"errorMessage,omitempty"`
+	Success      bool                   `json:"success"`
+	Data         interface{}            `json:"data,omitempty"`
+	ErrorMessage string                 `json:"errorMessage,omitempty"`
+	Warnings     []task.ValidationIssue `json:"warnings,omitempty"`
 }
 
 func Success(c *gin.Context, data interface{}) {
@@ -32,3 +35,21 @@ func ErrorMsg(c *gin.Context, msg string) {
 		ErrorMessage: msg,
 	})
 }
+
+// SuccessWithWarnings is Success with the non-blocking validation issues of a saved task
+func SuccessWithWarnings(c *gin.Context, data interface{}, warnings []task.ValidationIssue) {
+	c.JSON(http.StatusOK, APIResponse{
+		Success:  true,
+		Data:     data,
+		Warnings: warnings,
+	})
+}
+
+// ValidationFailed reports a task that was rejected, with every issue in data
+func ValidationFailed(c *gin.Context, result task.ValidationResult) {
+	c.JSON(http.StatusOK, APIResponse{
+		Success:      false,
+		Data:         result,
+		ErrorMessage: strings.Join(result.Errors(), "; "),
+	})
+}
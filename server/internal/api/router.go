@@ -59,14 +59,25 @@ func SetupRouter(h *Handler) *gin.Engine {
 		t.POST("/", h.CreateTask)
 		t.PUT("/", h.UpdateTask)
 		t.DELETE("/", h.DeleteTask)
+		t.POST("/validate", h.ValidateTask)
 
 		t.GET("/run", h.RunTask)
 		t.POST("/run/stop", h.StopRun)
 		t.GET("/run/status", h.GetRunStatus)
+		t.GET("/run/stream", h.StreamRun)
+		t.GET("/run/report", h.DownloadRunReport)
+		t.POST("/plan", h.PlanTask)
+		t.GET("/plan/download", h.DownloadPlan)
+		t.GET("/runs", h.GetTaskRuns)
+		t.GET("/runs/detail", h.GetTaskRunDetail)
+
+		t.POST("/schedule", h.SetSchedule)
+		t.DELETE("/schedule", h.CancelSchedule)
 
 		t.POST("/watch/start", h.StartWatch)
 		t.POST("/watch/stop", h.StopWatch)
 		t.GET("/watch/status", h.GetWatchStatus)
+		t.GET("/watch/pending", h.GetWatchPending)
 
 		t.GET("/log", h.GetTaskLog)
 		t.GET("/log/files", h.GetLogFiles)
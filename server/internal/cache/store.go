@@ -2,11 +2,14 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/fasaxi-linker/servergo/internal/db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // Store manages cache data in PostgreSQL
@@ -72,6 +75,66 @@ func (s *Store) Has(taskID int, filePath string) (bool, error) {
 	return exists, nil
 }
 
+// HasMany checks a batch of file paths with a single query and returns the
+// ones that are cached for a specific task
+func (s *Store) HasMany(taskID int, filePaths []string) (map[string]bool, error) {
+	found := make(map[string]bool)
+	if len(filePaths) == 0 {
+		return found, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pool := db.GetPool()
+	if pool == nil {
+		return nil, fmt.Errorf("database connection pool is not initialized")
+	}
+
+	query := `SELECT file_path FROM cache_files WHERE task_id = $1 AND file_path = ANY($2)`
+	rows, err := pool.Query(ctx, query, taskID, filePaths)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check cache: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, fmt.Errorf("failed to scan cache file: %w", err)
+		}
+		found[p] = true
+	}
+	return found, rows.Err()
+}
+
+// EachPath streams every cached file path of a task to fn without holding
+// the whole list in memory
+func (s *Store) EachPath(taskID int, fn func(filePath string)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	pool := db.GetPool()
+	if pool == nil {
+		return fmt.Errorf("database connection pool is not initialized")
+	}
+
+	rows, err := pool.Query(ctx, `SELECT file_path FROM cache_files WHERE task_id = $1`, taskID)
+	if err != nil {
+		return fmt.Errorf("failed to query cache files: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return fmt.Errorf("failed to scan cache file: %w", err)
+		}
+		fn(p)
+	}
+	return rows.Err()
+}
+
 // Add adds new file paths to cache for a specific task (batch insert for performance)
 func (s *Store) Add(taskID int, filePaths []string) error {
 	if len(filePaths) == 0 {
@@ -269,3 +332,319 @@ func (s *Store) GetByTaskIDPaged(taskID, page, pageSize int, search string) ([]C
 
 	return files, total, nil
 }
+
+// FileMeta describes a cached source file beyond its path, so that a file
+// that was renamed or moved can be recognised by its identity or content
+type FileMeta struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Device  uint64
+	Inode   uint64
+	Hash    string // MD5 of the content, empty when hashing is disabled
+}
+
+// AddMeta adds or refreshes cache entries together with their file metadata.
+// Large batches are streamed with COPY into a staging table and merged with a
+// single statement; small ones, such as a single file from the watcher, use a
+// plain INSERT.
+func (s *Store) AddMeta(taskID int, metas []FileMeta) error {
+	if len(metas) == 0 {
+		return nil
+	}
+
+	timeout := time.Duration(len(metas)/10000+1) * time.Minute
+	if timeout > 10*time.Minute {
+		timeout = 10 * time.Minute
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	pool := db.GetPool()
+	if pool == nil {
+		return fmt.Errorf("database connection pool is not initialized")
+	}
+
+	if len(metas) >= copyMinRows {
+		return s.copyMeta(ctx, pool, taskID, metas)
+	}
+
+	// ON CONFLICT cannot update a row twice; the last entry of a path wins
+	metas = lastPerPath(metas)
+	values := make([]string, len(metas))
+	args := make([]interface{}, 0, len(metas)*6+1)
+	args = append(args, taskID)
+	for j, m := range metas {
+		n := j*6 + 2
+		values[j] = fmt.Sprintf("($1, $%d, $%d, $%d, $%d, $%d, $%d)", n, n+1, n+2, n+3, n+4, n+5)
+		args = append(args, m.Path, m.Size, m.ModTime, int64(m.Device), int64(m.Inode), m.Hash)
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO cache_files (task_id, file_path, size, mtime, device, inode, content_hash)
+		VALUES %s
+		ON CONFLICT (task_id, file_path) DO UPDATE
+		SET size = EXCLUDED.size,
+			mtime = EXCLUDED.mtime,
+			device = EXCLUDED.device,
+			inode = EXCLUDED.inode,
+			content_hash = EXCLUDED.content_hash`,
+		strings.Join(values, ", "),
+	)
+
+	if _, err := pool.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to batch insert cache files: %w", err)
+	}
+	return nil
+}
+
+// lastPerPath drops all but the last entry of each path, keeping the order
+func lastPerPath(metas []FileMeta) []FileMeta {
+	last := make(map[string]int, len(metas))
+	for i, m := range metas {
+		last[m.Path] = i
+	}
+	if len(last) == len(metas) {
+		return metas
+	}
+	unique := make([]FileMeta, 0, len(last))
+	for i, m := range metas {
+		if last[m.Path] == i {
+			unique = append(unique, m)
+		}
+	}
+	return unique
+}
+
+// copyMinRows is the batch size from which AddMeta uses COPY
+const copyMinRows = 100
+
+// copyMeta writes metas through a temporary staging table, since COPY itself
+// cannot update rows that already exist
+func (s *Store) copyMeta(ctx context.Context, pool *pgxpool.Pool, taskID int, metas []FileMeta) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin cache transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	stage := `
+		CREATE TEMP TABLE cache_files_stage (
+			file_path TEXT NOT NULL,
+			size BIGINT,
+			mtime TIMESTAMPTZ,
+			device BIGINT,
+			inode BIGINT,
+			content_hash VARCHAR(32) NOT NULL
+		) ON COMMIT DROP`
+	if _, err := tx.Exec(ctx, stage); err != nil {
+		return fmt.Errorf("failed to create cache staging table: %w", err)
+	}
+
+	columns := []string{"file_path", "size", "mtime", "device", "inode", "content_hash"}
+	rows := pgx.CopyFromSlice(len(metas), func(i int) ([]interface{}, error) {
+		m := metas[i]
+		return []interface{}{m.Path, m.Size, m.ModTime, int64(m.Device), int64(m.Inode), m.Hash}, nil
+	})
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"cache_files_stage"}, columns, rows); err != nil {
+		return fmt.Errorf("failed to copy cache files: %w", err)
+	}
+
+	// DISTINCT ON keeps one row per path, ON CONFLICT cannot update a row twice
+	merge := `
+		INSERT INTO cache_files (task_id, file_path, size, mtime, device, inode, content_hash)
+		SELECT DISTINCT ON (file_path) $1, file_path, size, mtime, device, inode, content_hash
+		FROM cache_files_stage
+		ON CONFLICT (task_id, file_path) DO UPDATE
+		SET size = EXCLUDED.size,
+			mtime = EXCLUDED.mtime,
+			device = EXCLUDED.device,
+			inode = EXCLUDED.inode,
+			content_hash = EXCLUDED.content_hash`
+	if _, err := tx.Exec(ctx, merge, taskID); err != nil {
+		return fmt.Errorf("failed to merge cache files: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit cache files: %w", err)
+	}
+	return nil
+}
+
+// GetMeta returns the cached metadata of a file, or nil if it is not cached
+func (s *Store) GetMeta(taskID int, filePath string) (*FileMeta, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pool := db.GetPool()
+	if pool == nil {
+		return nil, fmt.Errorf("database connection pool is not initialized")
+	}
+
+	query := `SELECT ` + metaColumns + ` FROM cache_files WHERE task_id = $1 AND file_path = $2`
+	m, err := scanMeta(pool.QueryRow(ctx, query, taskID, filePath))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cache file: %w", err)
+	}
+	return m, nil
+}
+
+// metaColumns are the columns read by scanMeta
+const metaColumns = `file_path, COALESCE(size, 0), COALESCE(mtime, 'epoch'::timestamptz), COALESCE(device, 0), COALESCE(inode, 0), COALESCE(content_hash, '')`
+
+// scanMeta reads one row of metaColumns
+func scanMeta(row pgx.Row) (*FileMeta, error) {
+	var m FileMeta
+	var device, inode int64
+	if err := row.Scan(&m.Path, &m.Size, &m.ModTime, &device, &inode, &m.Hash); err != nil {
+		return nil, err
+	}
+	m.Device, m.Inode = uint64(device), uint64(inode)
+	return &m, nil
+}
+
+// queryMeta runs a query selecting metaColumns and passes every row to fn
+func (s *Store) queryMeta(query string, fn func(*FileMeta), args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pool := db.GetPool()
+	if pool == nil {
+		return fmt.Errorf("database connection pool is not initialized")
+	}
+
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query cache files: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := scanMeta(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan cache file: %w", err)
+		}
+		fn(m)
+	}
+	return rows.Err()
+}
+
+// GetMetaMany returns the cached metadata of a batch of files with a single
+// query; files that are not cached are missing from the map
+func (s *Store) GetMetaMany(taskID int, filePaths []string) (map[string]*FileMeta, error) {
+	found := make(map[string]*FileMeta)
+	if len(filePaths) == 0 {
+		return found, nil
+	}
+	err := s.queryMeta(
+		`SELECT `+metaColumns+` FROM cache_files WHERE task_id = $1 AND file_path = ANY($2)`,
+		func(m *FileMeta) { found[m.Path] = m },
+		taskID, filePaths,
+	)
+	return found, err
+}
+
+// InodeKey identifies a file by device and inode
+type InodeKey struct {
+	Device uint64
+	Inode  uint64
+}
+
+// FindByInodes returns the cached paths of a task for a batch of device/inode
+// pairs with a single query
+func (s *Store) FindByInodes(taskID int, keys []InodeKey) (map[InodeKey][]string, error) {
+	found := make(map[InodeKey][]string)
+	if len(keys) == 0 {
+		return found, nil
+	}
+	devices := make([]int64, len(keys))
+	inodes := make([]int64, len(keys))
+	for i, k := range keys {
+		devices[i], inodes[i] = int64(k.Device), int64(k.Inode)
+	}
+	err := s.queryMeta(
+		`SELECT `+metaColumns+` FROM cache_files
+		WHERE task_id = $1 AND (device, inode) IN (SELECT * FROM unnest($2::bigint[], $3::bigint[]))`,
+		func(m *FileMeta) {
+			k := InodeKey{Device: m.Device, Inode: m.Inode}
+			found[k] = append(found[k], m.Path)
+		},
+		taskID, devices, inodes,
+	)
+	return found, err
+}
+
+// FindHashedBySizes returns the cached files of a task that have a content hash
+// and one of the given sizes, with a single query. Callers compare the hashes.
+func (s *Store) FindHashedBySizes(taskID int, sizes []int64) (map[int64][]FileMeta, error) {
+	found := make(map[int64][]FileMeta)
+	if len(sizes) == 0 {
+		return found, nil
+	}
+	err := s.queryMeta(
+		`SELECT `+metaColumns+` FROM cache_files WHERE task_id = $1 AND content_hash <> '' AND size = ANY($2)`,
+		func(m *FileMeta) { found[m.Size] = append(found[m.Size], *m) },
+		taskID, sizes,
+	)
+	return found, err
+}
+
+// FindByInode returns cached paths of a task that refer to the given device/inode
+func (s *Store) FindByInode(taskID int, device, inode uint64) ([]string, error) {
+	return s.findPaths(
+		`SELECT file_path FROM cache_files WHERE task_id = $1 AND device = $2 AND inode = $3`,
+		taskID, int64(device), int64(inode),
+	)
+}
+
+// FindByHash returns cached paths of a task with the given content hash and size
+func (s *Store) FindByHash(taskID int, hash string, size int64) ([]string, error) {
+	if hash == "" {
+		return nil, nil
+	}
+	return s.findPaths(
+		`SELECT file_path FROM cache_files WHERE task_id = $1 AND content_hash = $2 AND size = $3`,
+		taskID, hash, size,
+	)
+}
+
+func (s *Store) findPaths(query string, args ...interface{}) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pool := db.GetPool()
+	if pool == nil {
+		return nil, fmt.Errorf("database connection pool is not initialized")
+	}
+
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cache files: %w", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, fmt.Errorf("failed to scan cache file: %w", err)
+		}
+		paths = append(paths, p)
+	}
+	return paths, rows.Err()
+}
+
+// FindByPrefix returns cached paths of a task located below dir
+func (s *Store) FindByPrefix(taskID int, dir string) ([]string, error) {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	// Escape LIKE wildcards in the directory name
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+	return s.findPaths(
+		`SELECT file_path FROM cache_files WHERE task_id = $1 AND file_path LIKE $2`,
+		taskID, escaped+"%",
+	)
+}
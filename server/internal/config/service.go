@@ -353,6 +353,9 @@ func (s *Service) Add(c task.Config, detail string) error {
 	// Parse the detail to ensure it's valid
 	var config ParsedConfig
 	if err := json.Unmarshal([]byte(detail), &config); err == nil {
+		if err := config.validate(); err != nil {
+			return err
+		}
 		// Valid JSON, re-marshal to ensure consistent format
 		jsonBytes, err := json.MarshalIndent(config, "", "  ")
 		if err != nil {
@@ -399,6 +402,9 @@ func (s *Service) UpdateByID(id int, c task.Config, detail string) error {
 	// Parse the detail to ensure it's valid
 	var config ParsedConfig
 	if err := json.Unmarshal([]byte(detail), &config); err == nil {
+		if err := config.validate(); err != nil {
+			return err
+		}
 		// Valid JSON, re-marshal to ensure consistent format
 		jsonBytes, err := json.MarshalIndent(config, "", "  ")
 		if err != nil {
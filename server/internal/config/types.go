@@ -1,6 +1,11 @@
 package config
 
-import "github.com/fasaxi-linker/servergo/internal/task"
+import (
+	"fmt"
+
+	"github.com/fasaxi-linker/servergo/internal/task"
+	"github.com/fasaxi-linker/servergo/pkg/core"
+)
 
 // ParsedConfig represents the parsed configuration
 type ParsedConfig struct {
@@ -10,6 +15,18 @@ type ParsedConfig struct {
 	OpenCache     bool     `json:"openCache"`
 	MkdirIfSingle bool     `json:"mkdirIfSingle"`
 	DeleteDir     bool     `json:"deleteDir"`
+	task.AdvancedOptions
+}
+
+// validate checks the patterns and advanced options of a config
+func (p *ParsedConfig) validate() error {
+	if err := core.ValidatePatterns(p.Include); err != nil {
+		return fmt.Errorf("include: %w", err)
+	}
+	if err := core.ValidatePatterns(p.Exclude); err != nil {
+		return fmt.Errorf("exclude: %w", err)
+	}
+	return p.AdvancedOptions.Validate()
 }
 
 // Ensure ParsedConfig implements ConfigOptions interface
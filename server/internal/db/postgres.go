@@ -57,6 +57,27 @@ func InitDB(cfg *Config) error {
 		return fmt.Errorf("failed to ensure database exists: %w", err)
 	}
 
+	if err := connect(ctx, cfg); err != nil {
+		return err
+	}
+
+	if err := createTables(ctx); err != nil {
+		return fmt.Errorf("failed to create tables: %w", err)
+	}
+
+	fmt.Println("✅ Database initialized successfully")
+	return nil
+}
+
+// Connect opens the pool to an existing database without creating the database
+// or its tables, for callers that must not write, like a dry run
+func Connect(cfg *Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return connect(ctx, cfg)
+}
+
+func connect(ctx context.Context, cfg *Config) error {
 	poolConfig, err := pgxpool.ParseConfig(cfg.ConnectionString())
 	if err != nil {
 		return fmt.Errorf("failed to parse connection string: %w", err)
@@ -75,12 +96,6 @@ func InitDB(cfg *Config) error {
 	if err := pool.Ping(ctx); err != nil {
 		return fmt.Errorf("failed to ping database: %w", err)
 	}
-
-	if err := createTables(ctx); err != nil {
-		return fmt.Errorf("failed to create tables: %w", err)
-	}
-
-	fmt.Println("✅ Database initialized successfully")
 	return nil
 }
 
@@ -133,6 +148,8 @@ func createTables(ctx context.Context) error {
 		config_id INTEGER,
 		is_watching BOOLEAN DEFAULT false,
 		watch_error TEXT DEFAULT '',
+		advanced_options JSONB NOT NULL DEFAULT '{}'::jsonb,
+		priority INTEGER NOT NULL DEFAULT 0,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
@@ -153,6 +170,11 @@ func createTables(ctx context.Context) error {
 		id SERIAL PRIMARY KEY,
 		task_id INTEGER NOT NULL,
 		file_path TEXT NOT NULL,
+		size BIGINT,
+		mtime TIMESTAMPTZ,
+		device BIGINT,
+		inode BIGINT,
+		content_hash VARCHAR(32) NOT NULL DEFAULT '',
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		UNIQUE(task_id, file_path)
 	);
@@ -172,6 +194,15 @@ func createTables(ctx context.Context) error {
 		return fmt.Errorf("failed to create tasks table: %w", err)
 	}
 
+	// Columns added after the initial schema
+	tasksMigrations := `
+	ALTER TABLE tasks ADD COLUMN IF NOT EXISTS advanced_options JSONB NOT NULL DEFAULT '{}'::jsonb;
+	ALTER TABLE tasks ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0;
+	`
+	if _, err := pool.Exec(ctx, tasksMigrations); err != nil {
+		return fmt.Errorf("failed to migrate tasks table: %w", err)
+	}
+
 	tasksComments := `
 	COMMENT ON TABLE tasks IS '任务表';
 	COMMENT ON COLUMN tasks.name IS '任务名称';
@@ -191,6 +222,8 @@ func createTables(ctx context.Context) error {
 	COMMENT ON COLUMN tasks.config_id IS '绑定的配置ID';
 	COMMENT ON COLUMN tasks.is_watching IS '是否监听中';
 	COMMENT ON COLUMN tasks.watch_error IS '监听错误信息';
+	COMMENT ON COLUMN tasks.advanced_options IS '高级选项（JSON）';
+	COMMENT ON COLUMN tasks.priority IS '执行队列优先级（越大越先执行）';
 	COMMENT ON COLUMN tasks.created_at IS '创建时间';
 	COMMENT ON COLUMN tasks.updated_at IS '更新时间';
 	`
@@ -218,9 +251,25 @@ func createTables(ctx context.Context) error {
 		return fmt.Errorf("failed to create cache_files table: %w", err)
 	}
 
+	// Columns added after the initial schema
+	cacheFilesMigrations := `
+	ALTER TABLE cache_files ADD COLUMN IF NOT EXISTS size BIGINT;
+	ALTER TABLE cache_files ADD COLUMN IF NOT EXISTS mtime TIMESTAMPTZ;
+	ALTER TABLE cache_files ADD COLUMN IF NOT EXISTS device BIGINT;
+	ALTER TABLE cache_files ADD COLUMN IF NOT EXISTS inode BIGINT;
+	ALTER TABLE cache_files ADD COLUMN IF NOT EXISTS content_hash VARCHAR(32) NOT NULL DEFAULT '';
+	`
+	if _, err := pool.Exec(ctx, cacheFilesMigrations); err != nil {
+		return fmt.Errorf("failed to migrate cache_files table: %w", err)
+	}
+
 	// Create index for ORDER BY created_at DESC queries (pagination)
+	// and for recognising renamed files by inode or content hash
 	cacheFilesIndexes := `
 	CREATE INDEX IF NOT EXISTS idx_cache_files_task_created ON cache_files(task_id, created_at DESC);
+	CREATE INDEX IF NOT EXISTS idx_cache_files_task_inode ON cache_files(task_id, device, inode);
+	CREATE INDEX IF NOT EXISTS idx_cache_files_task_hash ON cache_files(task_id, content_hash) WHERE content_hash <> '';
+	CREATE INDEX IF NOT EXISTS idx_cache_files_task_size ON cache_files(task_id, size) WHERE content_hash <> '';
 	`
 	if _, err := pool.Exec(ctx, cacheFilesIndexes); err != nil {
 		return fmt.Errorf("failed to create indexes for cache_files table: %w", err)
@@ -231,6 +280,11 @@ func createTables(ctx context.Context) error {
 	COMMENT ON COLUMN cache_files.id IS '主键';
 	COMMENT ON COLUMN cache_files.task_id IS '关联任务ID';
 	COMMENT ON COLUMN cache_files.file_path IS '缓存文件路径';
+	COMMENT ON COLUMN cache_files.size IS '文件大小（字节）';
+	COMMENT ON COLUMN cache_files.mtime IS '文件修改时间';
+	COMMENT ON COLUMN cache_files.device IS '文件所在设备号';
+	COMMENT ON COLUMN cache_files.inode IS '文件 inode';
+	COMMENT ON COLUMN cache_files.content_hash IS '文件内容 MD5（未开启内容校验时为空）';
 	COMMENT ON COLUMN cache_files.created_at IS '创建时间';
 	`
 	if _, err := pool.Exec(ctx, cacheFilesComments); err != nil {
@@ -254,6 +308,61 @@ func createTables(ctx context.Context) error {
 		return fmt.Errorf("failed to add comments for users table: %w", err)
 	}
 
+	taskRunsTable := `
+	CREATE TABLE IF NOT EXISTS task_runs (
+		id SERIAL PRIMARY KEY,
+		task_id INTEGER NOT NULL,
+		task_name VARCHAR(255) NOT NULL DEFAULT '',
+		trigger VARCHAR(50) NOT NULL,
+		start_time TIMESTAMPTZ NOT NULL,
+		end_time TIMESTAMPTZ NOT NULL,
+		duration_ms BIGINT NOT NULL DEFAULT 0,
+		success_count INTEGER NOT NULL DEFAULT 0,
+		fail_count INTEGER NOT NULL DEFAULT 0,
+		deleted_count INTEGER NOT NULL DEFAULT 0,
+		freed_bytes BIGINT NOT NULL DEFAULT 0,
+		removed_dirs INTEGER NOT NULL DEFAULT 0,
+		cancelled BOOLEAN NOT NULL DEFAULT false,
+		error TEXT NOT NULL DEFAULT '',
+		fail_summary JSONB NOT NULL DEFAULT '[]'::jsonb,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	if _, err := pool.Exec(ctx, taskRunsTable); err != nil {
+		return fmt.Errorf("failed to create task_runs table: %w", err)
+	}
+
+	taskRunsIndexes := `
+	CREATE INDEX IF NOT EXISTS idx_task_runs_task_start ON task_runs(task_id, start_time DESC);
+	CREATE INDEX IF NOT EXISTS idx_task_runs_start ON task_runs(start_time DESC);
+	`
+	if _, err := pool.Exec(ctx, taskRunsIndexes); err != nil {
+		return fmt.Errorf("failed to create indexes for task_runs table: %w", err)
+	}
+
+	taskRunsComments := `
+	COMMENT ON TABLE task_runs IS '任务执行记录表';
+	COMMENT ON COLUMN task_runs.id IS '主键';
+	COMMENT ON COLUMN task_runs.task_id IS '关联任务ID';
+	COMMENT ON COLUMN task_runs.task_name IS '执行时的任务名称';
+	COMMENT ON COLUMN task_runs.trigger IS '触发方式（manual/cron/loop/watch-batch/cli）';
+	COMMENT ON COLUMN task_runs.start_time IS '开始时间';
+	COMMENT ON COLUMN task_runs.end_time IS '结束时间';
+	COMMENT ON COLUMN task_runs.duration_ms IS '耗时（毫秒）';
+	COMMENT ON COLUMN task_runs.success_count IS '成功数';
+	COMMENT ON COLUMN task_runs.fail_count IS '失败数';
+	COMMENT ON COLUMN task_runs.deleted_count IS '删除文件数（清理任务）';
+	COMMENT ON COLUMN task_runs.freed_bytes IS '释放空间字节数（清理任务）';
+	COMMENT ON COLUMN task_runs.removed_dirs IS '删除空目录数（清理任务）';
+	COMMENT ON COLUMN task_runs.cancelled IS '是否被手动停止';
+	COMMENT ON COLUMN task_runs.error IS '错误信息';
+	COMMENT ON COLUMN task_runs.fail_summary IS '失败汇总（按原因分组，JSON）';
+	COMMENT ON COLUMN task_runs.created_at IS '创建时间';
+	`
+	if _, err := pool.Exec(ctx, taskRunsComments); err != nil {
+		return fmt.Errorf("failed to add comments for task_runs table: %w", err)
+	}
+
 	// Note: task_logs table has been removed - logs are now stored as files in ./logs/task_{id}/
 
 	fmt.Println("✅ Tables created/verified successfully")
@@ -0,0 +1,253 @@
+package logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ExecutionType identifies what produced a log file
+type ExecutionType string
+
+const (
+	ExecWatch ExecutionType = "watch" // rolling file shared by the watcher
+	ExecRun   ExecutionType = "run"   // one file per manual run
+	ExecCron  ExecutionType = "cron"  // one file per scheduled run
+)
+
+const (
+	logFileExt     = ".jsonl"
+	fileTimeLayout = "20060102_150405"
+)
+
+// Rotation and retention settings, overridable through the environment:
+//   - LOG_DIR: base directory (default ./logs)
+//   - LOG_MAX_FILE_SIZE_MB: rotate the watch file once it exceeds this size (default 10)
+//   - LOG_MAX_FILE_AGE_HOURS: rotate the watch file once it is older than this (default 24)
+//   - LOG_RETENTION_DAYS: delete files not modified for this many days (default 30)
+//   - LOG_MAX_FILES: keep at most this many files per task (default 50)
+var (
+	BaseDir        = envString("LOG_DIR", "./logs")
+	MaxFileSize    = int64(envInt("LOG_MAX_FILE_SIZE_MB", 10)) * 1024 * 1024
+	MaxFileAge     = time.Duration(envInt("LOG_MAX_FILE_AGE_HOURS", 24)) * time.Hour
+	RetentionAge   = time.Duration(envInt("LOG_RETENTION_DAYS", 30)) * 24 * time.Hour
+	MaxFilesPerDir = envInt("LOG_MAX_FILES", 50)
+)
+
+// LogEntry is a single line of a log file
+type LogEntry struct {
+	CreatedAt time.Time `json:"createdAt"`
+	Level     string    `json:"level"`
+	Message   string    `json:"message"`
+}
+
+// FileLogger writes JSON Lines log entries for one task
+type FileLogger struct {
+	taskID   int
+	execType ExecutionType
+	file     *os.File
+	path     string
+	size     int64
+	openedAt time.Time
+	mu       sync.Mutex
+}
+
+// openLoggers tracks files currently being written, keyed by path,
+// so that clearing an open file truncates it instead of unlinking it
+var (
+	openLoggers   = make(map[string]*FileLogger)
+	openLoggersMu sync.Mutex
+)
+
+// TaskDir returns the log directory of a task
+func TaskDir(taskID int) string {
+	return filepath.Join(BaseDir, fmt.Sprintf("task_%d", taskID))
+}
+
+// NewFileLogger creates a logger for a task.
+// Watch mode appends to the most recent watch file unless it is due for rotation;
+// run and cron executions always start a new file.
+func NewFileLogger(taskID int, execType ExecutionType) (*FileLogger, error) {
+	dir := TaskDir(taskID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	l := &FileLogger{
+		taskID:   taskID,
+		execType: execType,
+	}
+
+	if execType == ExecWatch {
+		if name, info := latestFileOfType(dir, ExecWatch); name != "" {
+			createdAt, ok := parseFileTime(name)
+			if !ok {
+				createdAt = info.ModTime()
+			}
+			if !needsRotation(info.Size(), createdAt) {
+				if err := l.open(filepath.Join(dir, name)); err == nil {
+					return l, nil
+				}
+			}
+		}
+	}
+
+	if err := l.openNew(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Log appends an entry; errors are reported to stdout since there is nowhere else to put them
+func (l *FileLogger) Log(level, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return
+	}
+
+	if l.execType == ExecWatch && needsRotation(l.size, l.openedAt) {
+		if err := l.rotate(); err != nil {
+			fmt.Printf("Error rotating log file: %v\n", err)
+			return
+		}
+	}
+
+	line, err := json.Marshal(LogEntry{
+		CreatedAt: time.Now(),
+		Level:     level,
+		Message:   msg,
+	})
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		fmt.Printf("Error writing log file %s: %v\n", l.path, err)
+	}
+}
+
+// Close closes the underlying file
+func (l *FileLogger) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closeFile()
+}
+
+// Path returns the file currently written to
+func (l *FileLogger) Path() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.path
+}
+
+func (l *FileLogger) open(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+
+	l.file = f
+	l.path = path
+	l.size = info.Size()
+	l.openedAt = time.Now()
+	if createdAt, ok := parseFileTime(filepath.Base(path)); ok {
+		l.openedAt = createdAt
+	}
+
+	openLoggersMu.Lock()
+	openLoggers[path] = l
+	openLoggersMu.Unlock()
+	return nil
+}
+
+func (l *FileLogger) openNew() error {
+	dir := TaskDir(l.taskID)
+	base := fmt.Sprintf("%s_%s", l.execType, time.Now().Format(fileTimeLayout))
+	path := filepath.Join(dir, base+logFileExt)
+	// Several executions may start within the same second
+	for i := 1; fileExists(path); i++ {
+		path = filepath.Join(dir, fmt.Sprintf("%s_%d%s", base, i, logFileExt))
+	}
+
+	if err := l.open(path); err != nil {
+		return err
+	}
+	enforceRetention(dir, path)
+	return nil
+}
+
+func (l *FileLogger) rotate() error {
+	l.closeFile()
+	return l.openNew()
+}
+
+func (l *FileLogger) closeFile() {
+	if l.file == nil {
+		return
+	}
+	l.file.Close()
+	l.file = nil
+
+	openLoggersMu.Lock()
+	if openLoggers[l.path] == l {
+		delete(openLoggers, l.path)
+	}
+	openLoggersMu.Unlock()
+}
+
+// truncate empties the file in place (used when clearing an open file)
+func (l *FileLogger) truncate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	if err := l.file.Truncate(0); err != nil {
+		return err
+	}
+	l.size = 0
+	l.openedAt = time.Now()
+	return nil
+}
+
+func needsRotation(size int64, openedAt time.Time) bool {
+	if MaxFileSize > 0 && size >= MaxFileSize {
+		return true
+	}
+	return MaxFileAge > 0 && !openedAt.IsZero() && time.Since(openedAt) >= MaxFileAge
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func envInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return def
+}
@@ -0,0 +1,98 @@
+package logs
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFileLoggerRotationAndRead(t *testing.T) {
+	BaseDir = t.TempDir()
+	MaxFileSize = 400
+	MaxFilesPerDir = 50
+
+	l, err := NewFileLogger(1, ExecWatch)
+	if err != nil {
+		t.Fatalf("NewFileLogger: %v", err)
+	}
+	defer l.Close()
+
+	levels := []string{"INFO", "SUCCEED", "ERROR"}
+	for i := 0; i < 12; i++ {
+		l.Log(levels[i%3], fmt.Sprintf("message %d", i))
+	}
+
+	files, err := GetLogFiles(1)
+	if err != nil {
+		t.Fatalf("GetLogFiles: %v", err)
+	}
+	if len(files) < 2 {
+		t.Fatalf("expected watch log to rotate, got %d file(s)", len(files))
+	}
+	for _, f := range files {
+		if f.Type != ExecWatch {
+			t.Errorf("file %s: type = %s, want watch", f.Name, f.Type)
+		}
+	}
+
+	latest, err := GetLatestLogFile(1)
+	if err != nil || latest != files[0].Name {
+		t.Fatalf("GetLatestLogFile = %q, %v; want %q", latest, err, files[0].Name)
+	}
+
+	total := 0
+	for _, f := range files {
+		entries, n, err := ReadLogFile(1, f.Name, 1, 100, "success", "")
+		if err != nil {
+			t.Fatalf("ReadLogFile(%s): %v", f.Name, err)
+		}
+		for _, e := range entries {
+			if e.Level != "SUCCEED" {
+				t.Errorf("level filter returned %s entry", e.Level)
+			}
+		}
+		total += n
+	}
+	if total != 4 {
+		t.Errorf("SUCCEED entries across files = %d, want 4", total)
+	}
+}
+
+func TestReadLogFilePagingAndSearch(t *testing.T) {
+	BaseDir = t.TempDir()
+	MaxFileSize = 0
+
+	l, err := NewFileLogger(2, ExecRun)
+	if err != nil {
+		t.Fatalf("NewFileLogger: %v", err)
+	}
+	for i := 0; i < 25; i++ {
+		l.Log("INFO", fmt.Sprintf("file-%02d.mkv", i))
+	}
+	l.Close()
+
+	name, _ := GetLatestLogFile(2)
+
+	entries, total, err := ReadLogFile(2, name, 2, 10, "", "")
+	if err != nil {
+		t.Fatalf("ReadLogFile: %v", err)
+	}
+	if total != 25 || len(entries) != 10 || entries[0].Message != "file-10.mkv" {
+		t.Errorf("page 2: total=%d len=%d first=%q", total, len(entries), entries[0].Message)
+	}
+
+	entries, total, _ = ReadLogFile(2, name, 1, 10, "", "FILE-2")
+	if total != 5 || len(entries) != 5 {
+		t.Errorf("search: total=%d len=%d, want 5", total, len(entries))
+	}
+
+	if _, _, err := ReadLogFile(2, "../task_1/x.jsonl", 1, 10, "", ""); err == nil {
+		t.Errorf("expected path traversal to be rejected")
+	}
+
+	if err := ClearLogFile(2, ""); err != nil {
+		t.Fatalf("ClearLogFile: %v", err)
+	}
+	if files, _ := GetLogFiles(2); len(files) != 0 {
+		t.Errorf("expected no files after clear, got %d", len(files))
+	}
+}
@@ -0,0 +1,289 @@
+package logs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LogFileInfo describes a log file of a task
+type LogFileInfo struct {
+	Name    string        `json:"name"`
+	Type    ExecutionType `json:"type"`
+	Size    int64         `json:"size"`
+	ModTime time.Time     `json:"modTime"`
+}
+
+// GetLogFiles lists the log files of a task, newest first
+func GetLogFiles(taskID int) ([]LogFileInfo, error) {
+	entries, err := os.ReadDir(TaskDir(taskID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []LogFileInfo{}, nil
+		}
+		return nil, err
+	}
+
+	files := make([]LogFileInfo, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), logFileExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, LogFileInfo{
+			Name:    e.Name(),
+			Type:    fileType(e.Name()),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime.After(files[j].ModTime)
+	})
+	return files, nil
+}
+
+// GetLatestLogFile returns the name of the most recently written log file, or "" if none
+func GetLatestLogFile(taskID int) (string, error) {
+	files, err := GetLogFiles(taskID)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", nil
+	}
+	return files[0].Name, nil
+}
+
+// ReadLogFile reads one page of entries in chronological order.
+// levelFilter matches case-insensitively ("SUCCESS" also matches "SUCCEED"),
+// search is a case-insensitive substring match on the message.
+// The returned total is the number of entries matching the filters.
+func ReadLogFile(taskID int, filename string, page, pageSize int, levelFilter, search string) ([]LogEntry, int, error) {
+	path, err := resolveFile(taskID, filename)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []LogEntry{}, 0, nil
+		}
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 200
+	}
+	start := (page - 1) * pageSize
+	end := start + pageSize
+
+	level := normalizeLevel(levelFilter)
+	search = strings.ToLower(search)
+
+	entries := []LogEntry{}
+	total := 0
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var entry LogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			// Keep unparsable lines visible rather than dropping them
+			entry = LogEntry{Level: "INFO", Message: string(line)}
+		}
+
+		if level != "" && normalizeLevel(entry.Level) != level {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(entry.Message), search) {
+			continue
+		}
+
+		if total >= start && total < end {
+			entries = append(entries, entry)
+		}
+		total++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
+
+// ClearLogFile deletes one log file, or every log file of the task when filename is empty.
+// Files still being written are truncated instead of removed.
+func ClearLogFile(taskID int, filename string) error {
+	if filename != "" {
+		path, err := resolveFile(taskID, filename)
+		if err != nil {
+			return err
+		}
+		return removeLogFile(path)
+	}
+
+	files, err := GetLogFiles(taskID)
+	if err != nil {
+		return err
+	}
+	dir := TaskDir(taskID)
+	for _, f := range files {
+		if err := removeLogFile(filepath.Join(dir, f.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeLogFile(path string) error {
+	openLoggersMu.Lock()
+	l, open := openLoggers[path]
+	openLoggersMu.Unlock()
+
+	if open {
+		return l.truncate()
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// resolveFile validates a client supplied filename and returns its full path
+func resolveFile(taskID int, filename string) (string, error) {
+	if filename == "" || filename != filepath.Base(filename) || !strings.HasSuffix(filename, logFileExt) {
+		return "", fmt.Errorf("invalid log file name: %q", filename)
+	}
+	return filepath.Join(TaskDir(taskID), filename), nil
+}
+
+// fileType extracts the execution type from a "{type}_{time}.jsonl" name
+func fileType(name string) ExecutionType {
+	for _, t := range []ExecutionType{ExecWatch, ExecRun, ExecCron} {
+		if strings.HasPrefix(name, string(t)+"_") {
+			return t
+		}
+	}
+	return "unknown"
+}
+
+// parseFileTime extracts the creation time encoded in a log file name
+func parseFileTime(name string) (time.Time, bool) {
+	t := fileType(name)
+	if t == "unknown" {
+		return time.Time{}, false
+	}
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, string(t)+"_"), logFileExt)
+	if len(stamp) < len(fileTimeLayout) {
+		return time.Time{}, false
+	}
+	parsed, err := time.ParseInLocation(fileTimeLayout, stamp[:len(fileTimeLayout)], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return parsed, true
+}
+
+// latestFileOfType returns the most recently modified file of the given type in dir
+func latestFileOfType(dir string, t ExecutionType) (string, os.FileInfo) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", nil
+	}
+
+	var latestName string
+	var latestInfo os.FileInfo
+	for _, e := range entries {
+		if e.IsDir() || fileType(e.Name()) != t || !strings.HasSuffix(e.Name(), logFileExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if latestInfo == nil || info.ModTime().After(latestInfo.ModTime()) {
+			latestName, latestInfo = e.Name(), info
+		}
+	}
+	return latestName, latestInfo
+}
+
+// enforceRetention removes files older than RetentionAge and keeps at most
+// MaxFilesPerDir files in dir. The file at keep is never removed.
+func enforceRetention(dir, keep string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	type candidate struct {
+		path    string
+		modTime time.Time
+	}
+	var files []candidate
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), logFileExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, candidate{filepath.Join(dir, e.Name()), info.ModTime()})
+	}
+
+	// Newest first
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.After(files[j].modTime)
+	})
+
+	kept := 0
+	for _, f := range files {
+		expired := RetentionAge > 0 && time.Since(f.modTime) > RetentionAge
+		overLimit := MaxFilesPerDir > 0 && kept >= MaxFilesPerDir
+		if f.path != keep && (expired || overLimit) {
+			openLoggersMu.Lock()
+			_, open := openLoggers[f.path]
+			openLoggersMu.Unlock()
+			if !open {
+				os.Remove(f.path)
+				continue
+			}
+		}
+		kept++
+	}
+}
+
+// normalizeLevel maps level aliases to a canonical upper-case form
+func normalizeLevel(level string) string {
+	switch l := strings.ToUpper(strings.TrimSpace(level)); l {
+	case "", "ALL":
+		return ""
+	case "SUCCESS", "SUCCEED":
+		return "SUCCEED"
+	case "WARNING":
+		return "WARN"
+	default:
+		return l
+	}
+}
@@ -0,0 +1,247 @@
+package runs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fasaxi-linker/servergo/internal/db"
+	"github.com/fasaxi-linker/servergo/pkg/core"
+	"github.com/jackc/pgx/v5"
+)
+
+// Trigger identifies what started a run
+const (
+	TriggerManual     = "manual"
+	TriggerCron       = "cron"
+	TriggerLoop       = "loop"
+	TriggerWatchBatch = "watch-batch"
+	TriggerWatchStart = "watch-start"
+	TriggerCLI        = "cli"
+)
+
+// ErrNotFound is returned by Get when no run has the requested ID
+var ErrNotFound = errors.New("task run not found")
+
+// maxFilesPerReason bounds how many failed paths are kept per failure reason
+const maxFilesPerReason = 100
+
+// FailureGroup summarizes the files that failed for one reason
+type FailureGroup struct {
+	Reason string   `json:"reason"`
+	Count  int      `json:"count"`
+	Files  []string `json:"files"` // at most maxFilesPerReason entries
+}
+
+// Record is one finished execution of a task
+type Record struct {
+	ID           int            `json:"id"`
+	TaskID       int            `json:"taskId"`
+	TaskName     string         `json:"taskName"`
+	Trigger      string         `json:"trigger"`
+	StartTime    time.Time      `json:"startTime"`
+	EndTime      time.Time      `json:"endTime"`
+	DurationMs   int64          `json:"durationMs"`
+	SuccessCount int            `json:"successCount"`
+	FailCount    int            `json:"failCount"`
+	DeletedCount int            `json:"deletedCount"`
+	FreedBytes   int64          `json:"freedBytes"`
+	RemovedDirs  int            `json:"removedDirs"`
+	Cancelled    bool           `json:"cancelled"`
+	Error        string         `json:"error"`
+	Failures     []FailureGroup `json:"failures,omitempty"` // only filled by Get
+}
+
+// NewRecord builds a record from the stats of a finished run
+func NewRecord(taskID int, taskName, trigger string, start, end time.Time, stats core.Stats, runErr error) Record {
+	r := Record{
+		TaskID:       taskID,
+		TaskName:     taskName,
+		Trigger:      trigger,
+		StartTime:    start,
+		EndTime:      end,
+		DurationMs:   end.Sub(start).Milliseconds(),
+		SuccessCount: stats.SuccessCount,
+		FailCount:    stats.FailCount,
+		DeletedCount: stats.DeletedCount,
+		FreedBytes:   stats.FreedBytes,
+		RemovedDirs:  stats.RemovedDirs,
+		Cancelled:    stats.Cancelled,
+		Failures:     summarizeFailures(stats.FailFiles),
+	}
+	if runErr != nil && !stats.Cancelled {
+		r.Error = runErr.Error()
+	}
+	return r
+}
+
+// summarizeFailures groups failed files by reason, largest groups first
+func summarizeFailures(failFiles map[string][]string) []FailureGroup {
+	groups := make([]FailureGroup, 0, len(failFiles))
+	for reason, files := range failFiles {
+		g := FailureGroup{Reason: reason, Count: len(files), Files: files}
+		if len(g.Files) > maxFilesPerReason {
+			g.Files = g.Files[:maxFilesPerReason]
+		}
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Reason < groups[j].Reason
+	})
+	return groups
+}
+
+// Store manages run history in PostgreSQL
+type Store struct{}
+
+// Add inserts a finished run and returns its ID
+func (s *Store) Add(r Record) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pool := db.GetPool()
+	if pool == nil {
+		return 0, fmt.Errorf("database connection pool is not initialized")
+	}
+
+	failures := r.Failures
+	if failures == nil {
+		failures = []FailureGroup{}
+	}
+	failuresJSON, err := json.Marshal(failures)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal failure summary: %w", err)
+	}
+
+	query := `
+		INSERT INTO task_runs (task_id, task_name, trigger, start_time, end_time, duration_ms,
+		                       success_count, fail_count, deleted_count, freed_bytes, removed_dirs,
+		                       cancelled, error, fail_summary)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id
+	`
+	var id int
+	err = pool.QueryRow(ctx, query,
+		r.TaskID, r.TaskName, r.Trigger, r.StartTime, r.EndTime, r.DurationMs,
+		r.SuccessCount, r.FailCount, r.DeletedCount, r.FreedBytes, r.RemovedDirs,
+		r.Cancelled, r.Error, failuresJSON,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert task run: %w", err)
+	}
+	return id, nil
+}
+
+// ListFilter narrows down List results; zero values match everything
+type ListFilter struct {
+	TaskID  int
+	Trigger string
+}
+
+// List returns one page of runs, newest first, without failure details
+func (s *Store) List(filter ListFilter, page, pageSize int) ([]Record, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pool := db.GetPool()
+	if pool == nil {
+		return nil, 0, fmt.Errorf("database connection pool is not initialized")
+	}
+
+	var conds []string
+	var args []interface{}
+	if filter.TaskID > 0 {
+		args = append(args, filter.TaskID)
+		conds = append(conds, fmt.Sprintf("task_id = $%d", len(args)))
+	}
+	if filter.Trigger != "" {
+		args = append(args, filter.Trigger)
+		conds = append(conds, fmt.Sprintf("trigger = $%d", len(args)))
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := pool.QueryRow(ctx, `SELECT COUNT(*) FROM task_runs `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count task runs: %w", err)
+	}
+
+	offset := (page - 1) * pageSize
+	query := fmt.Sprintf(`
+		SELECT id, task_id, task_name, trigger, start_time, end_time, duration_ms,
+		       success_count, fail_count, deleted_count, freed_bytes, removed_dirs, cancelled, error
+		FROM task_runs %s
+		ORDER BY start_time DESC, id DESC
+		LIMIT $%d OFFSET $%d`, where, len(args)+1, len(args)+2)
+	args = append(args, pageSize, offset)
+
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query task runs: %w", err)
+	}
+	defer rows.Close()
+
+	list := []Record{}
+	for rows.Next() {
+		var r Record
+		if err := rows.Scan(
+			&r.ID, &r.TaskID, &r.TaskName, &r.Trigger, &r.StartTime, &r.EndTime, &r.DurationMs,
+			&r.SuccessCount, &r.FailCount, &r.DeletedCount, &r.FreedBytes, &r.RemovedDirs, &r.Cancelled, &r.Error,
+		); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan task run: %w", err)
+		}
+		list = append(list, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return list, total, nil
+}
+
+// Get returns a single run including its failure summary
+func (s *Store) Get(id int) (*Record, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pool := db.GetPool()
+	if pool == nil {
+		return nil, fmt.Errorf("database connection pool is not initialized")
+	}
+
+	query := `
+		SELECT id, task_id, task_name, trigger, start_time, end_time, duration_ms,
+		       success_count, fail_count, deleted_count, freed_bytes, removed_dirs, cancelled, error, fail_summary
+		FROM task_runs
+		WHERE id = $1
+	`
+	var r Record
+	var failuresJSON []byte
+	err := pool.QueryRow(ctx, query, id).Scan(
+		&r.ID, &r.TaskID, &r.TaskName, &r.Trigger, &r.StartTime, &r.EndTime, &r.DurationMs,
+		&r.SuccessCount, &r.FailCount, &r.DeletedCount, &r.FreedBytes, &r.RemovedDirs, &r.Cancelled, &r.Error, &failuresJSON,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query task run %d: %w", id, err)
+	}
+
+	r.Failures = []FailureGroup{}
+	if len(failuresJSON) > 0 {
+		if err := json.Unmarshal(failuresJSON, &r.Failures); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal fail_summary: %w", err)
+		}
+	}
+	return &r, nil
+}
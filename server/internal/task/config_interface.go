@@ -1,5 +1,11 @@
 package task
 
+import (
+	"fmt"
+
+	"github.com/fasaxi-linker/servergo/pkg/core"
+)
+
 // ConfigOptions represents configuration options that can be applied to a task
 type ConfigOptions interface {
 	GetIncludePatterns() []string
@@ -8,6 +14,168 @@ type ConfigOptions interface {
 	GetOpenCache() bool
 	GetMkdirIfSingle() bool
 	GetDeleteDir() bool
+	GetAdvancedOptions() AdvancedOptions
+}
+
+// AdvancedOptions holds optional linking behaviour set in the config detail.
+// It is embedded in RuntimeConfig, Task and config.ParsedConfig, and stored
+// as a single JSON column, so a new option is declared here and in applyTo only.
+type AdvancedOptions struct {
+	// ContentHash records an MD5 of each linked file so that a renamed or moved
+	// source file is recognised even when its inode changed
+	ContentHash bool `json:"contentHash,omitempty"`
+
+	// ScanOnStart makes a watcher link the files that appeared while it was not
+	// running with a full incremental pass when it starts
+	ScanOnStart bool `json:"scanOnStart,omitempty"`
+
+	// StableSeconds holds back a watched file until its size and mtime have not
+	// changed for this many seconds, so downloads are not linked mid-transfer
+	StableSeconds int `json:"stableSeconds,omitempty"`
+
+	// TempSuffixes lists download temp file suffixes such as ".part" or ".!qB".
+	// Such files are never linked by the watcher, and a file waits while a
+	// sibling with one of these suffixes exists
+	TempSuffixes []string `json:"tempSuffixes,omitempty"`
+
+	// LinkStrategy chooses what to do when a hard link fails because source and
+	// destination are on different filesystems: "hardlink" (fail, the default),
+	// "reflink", "symlink", "relative-symlink" or "copy"
+	LinkStrategy string `json:"linkStrategy,omitempty"`
+
+	// ConflictPolicy decides what happens when a destination file exists but is
+	// not the source: "skip" (report only, the default), "overwrite", "rename",
+	// "keep-larger" or "keep-newer"
+	ConflictPolicy string `json:"conflictPolicy,omitempty"`
+
+	// DestTemplate lays out linked files below the destination, replacing the
+	// keepDirStruct/mkdirIfSingle layout, e.g. "{show}/Season {season:02}/{filename}".
+	// DestPattern is a regexp on the source-relative path whose capture groups
+	// the template can use; files it does not match keep the default layout
+	DestTemplate string `json:"destTemplate,omitempty"`
+	DestPattern  string `json:"destPattern,omitempty"`
+
+	// Naming "media" parses release names such as "Show.S01E02.1080p.mkv" and
+	// links them into a Plex/Jellyfin library layout; names that do not parse
+	// keep the default layout
+	Naming string `json:"naming,omitempty"`
+
+	// Companions lists patterns such as "*.srt", "*.nfo" or "poster.jpg" of
+	// files that are linked together with a primary file in the same directory
+	// and renamed like it, even if include does not match them. CompanionPrimary
+	// lists the primary patterns, e.g. "*.mkv"; by default every other linked file
+	Companions       []string `json:"companions,omitempty"`
+	CompanionPrimary []string `json:"companionPrimary,omitempty"`
+
+	// Size and age filters evaluated alongside include/exclude, e.g. to skip
+	// sample files. Sizes are in bytes; ModifiedAfter/ModifiedBefore take a
+	// date ("2024-01-31") or an RFC 3339 timestamp
+	MinSize        int64  `json:"minSize,omitempty"`
+	MaxSize        int64  `json:"maxSize,omitempty"`
+	MinAgeSeconds  int    `json:"minAgeSeconds,omitempty"`
+	ModifiedAfter  string `json:"modifiedAfter,omitempty"`
+	ModifiedBefore string `json:"modifiedBefore,omitempty"`
+
+	// MatchCase sets the case handling of include/exclude: "" (includes ignore
+	// case, excludes do not), "sensitive" or "insensitive". MatchHidden lets
+	// the patterns match dot-files, which are otherwise never linked
+	MatchCase   string `json:"matchCase,omitempty"`
+	MatchHidden bool   `json:"matchHidden,omitempty"`
+
+	// Workers sets how many files a run processes at once (default: twice the
+	// CPU count, at most 16) and MaxOpsPerSecond how many it starts per second.
+	// LowPriorityIO runs the workers at the lowest I/O and CPU priority so
+	// other services on the same disks stay responsive (Linux only)
+	Workers         int  `json:"workers,omitempty"`
+	MaxOpsPerSecond int  `json:"maxOpsPerSecond,omitempty"`
+	LowPriorityIO   bool `json:"lowPriorityIO,omitempty"`
+
+	// RunReport writes a JSON Lines report with one line per handled file next
+	// to the log of each run, downloadable from the API
+	RunReport bool `json:"runReport,omitempty"`
+}
+
+func (a AdvancedOptions) GetAdvancedOptions() AdvancedOptions {
+	return a
+}
+
+// Validate checks the option values
+func (a AdvancedOptions) Validate() error {
+	if !core.ValidStrategy(a.LinkStrategy) {
+		return fmt.Errorf("invalid linkStrategy %q: expected hardlink, reflink, symlink, relative-symlink or copy", a.LinkStrategy)
+	}
+	if !core.ValidConflictPolicy(a.ConflictPolicy) {
+		return fmt.Errorf("invalid conflictPolicy %q: expected skip, overwrite, rename, keep-larger or keep-newer", a.ConflictPolicy)
+	}
+	if a.StableSeconds < 0 {
+		return fmt.Errorf("stableSeconds must not be negative")
+	}
+	if err := core.ValidateTemplate(a.DestTemplate, a.DestPattern); err != nil {
+		return err
+	}
+	if !core.ValidNaming(a.Naming) {
+		return fmt.Errorf("invalid naming %q: expected media or empty", a.Naming)
+	}
+	if a.Naming != "" && a.DestTemplate != "" {
+		return fmt.Errorf("naming and destTemplate cannot be used together")
+	}
+	if a.MinSize < 0 || a.MaxSize < 0 || a.MinAgeSeconds < 0 {
+		return fmt.Errorf("minSize, maxSize and minAgeSeconds must not be negative")
+	}
+	if a.MaxSize > 0 && a.MinSize > a.MaxSize {
+		return fmt.Errorf("minSize must not exceed maxSize")
+	}
+	after, err := core.ParseFilterTime(a.ModifiedAfter)
+	if err != nil {
+		return fmt.Errorf("modifiedAfter: %w", err)
+	}
+	before, err := core.ParseFilterTime(a.ModifiedBefore)
+	if err != nil {
+		return fmt.Errorf("modifiedBefore: %w", err)
+	}
+	if !after.IsZero() && !before.IsZero() && !after.Before(before) {
+		return fmt.Errorf("modifiedAfter must be before modifiedBefore")
+	}
+	if !core.ValidMatchCase(a.MatchCase) {
+		return fmt.Errorf("invalid matchCase %q: expected sensitive, insensitive or empty", a.MatchCase)
+	}
+	if err := core.ValidatePatterns(a.Companions); err != nil {
+		return fmt.Errorf("companions: %w", err)
+	}
+	if err := core.ValidatePatterns(a.CompanionPrimary); err != nil {
+		return fmt.Errorf("companionPrimary: %w", err)
+	}
+	if a.Workers < 0 || a.MaxOpsPerSecond < 0 {
+		return fmt.Errorf("workers and maxOpsPerSecond must not be negative")
+	}
+	return nil
+}
+
+// applyTo copies the options onto core options
+func (a AdvancedOptions) applyTo(opts *core.Options) {
+	opts.ContentHash = a.ContentHash
+	opts.ScanOnStart = a.ScanOnStart
+	opts.StableSeconds = a.StableSeconds
+	opts.TempSuffixes = a.TempSuffixes
+	opts.LinkStrategy = a.LinkStrategy
+	opts.ConflictPolicy = a.ConflictPolicy
+	opts.DestTemplate = a.DestTemplate
+	opts.DestPattern = a.DestPattern
+	opts.Naming = a.Naming
+	opts.Companions = a.Companions
+	opts.CompanionPrimary = a.CompanionPrimary
+	opts.MinSize = a.MinSize
+	opts.MaxSize = a.MaxSize
+	opts.MinAgeSeconds = a.MinAgeSeconds
+	// Checked by Validate when the options were saved
+	opts.ModifiedAfter, _ = core.ParseFilterTime(a.ModifiedAfter)
+	opts.ModifiedBefore, _ = core.ParseFilterTime(a.ModifiedBefore)
+	opts.MatchCase = a.MatchCase
+	opts.MatchHidden = a.MatchHidden
+	opts.Workers = a.Workers
+	opts.MaxOpsPerSecond = a.MaxOpsPerSecond
+	opts.LowPriorityIO = a.LowPriorityIO
+	opts.RunReport = a.RunReport
 }
 
 // RuntimeConfig represents the parsed configuration used at runtime
@@ -18,6 +186,7 @@ type RuntimeConfig struct {
 	OpenCache     bool     `json:"openCache"`
 	MkdirIfSingle bool     `json:"mkdirIfSingle"`
 	DeleteDir     bool     `json:"deleteDir"`
+	AdvancedOptions
 }
 
 // Ensure RuntimeConfig implements ConfigOptions interface
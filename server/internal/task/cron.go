@@ -0,0 +1,251 @@
+package task
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron expression.
+// Supports the standard 5-field form (minute hour dom month dow) and the
+// 6-field form with a leading seconds field, as produced by most crontab generators.
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+}
+
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	secondField = cronField{0, 59, nil}
+	minuteField = cronField{0, 59, nil}
+	hourField   = cronField{0, 23, nil}
+	domField    = cronField{1, 31, nil}
+	monthField  = cronField{1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = cronField{0, 6, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// starBit marks a field that was given as "*" or "?"
+const starBit = 1 << 63
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// parseCron parses a cron expression
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if d, ok := cronDescriptors[strings.ToLower(expr)]; ok {
+		expr = d
+	}
+
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("cron 表达式应为 5 或 6 段, 实际 %d 段: %q", len(fields), expr)
+	}
+
+	var err error
+	c := &cronSchedule{}
+	if c.second, err = parseCronField(fields[0], secondField); err != nil {
+		return nil, err
+	}
+	if c.minute, err = parseCronField(fields[1], minuteField); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fields[2], hourField); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseCronField(fields[3], domField); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fields[4], monthField); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseCronField(fields[5], dowField); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseCronField parses a comma separated list of ranges into a bit set
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		b, err := parseCronRange(part, f)
+		if err != nil {
+			return 0, err
+		}
+		bits |= b
+	}
+	return bits, nil
+}
+
+func parseCronRange(expr string, f cronField) (uint64, error) {
+	rangeAndStep := strings.SplitN(expr, "/", 2)
+	lowAndHigh := strings.SplitN(rangeAndStep[0], "-", 2)
+
+	var start, end int
+	var extra uint64
+	var err error
+
+	if lowAndHigh[0] == "*" || lowAndHigh[0] == "?" {
+		start, end = f.min, f.max
+		extra = starBit
+	} else {
+		if start, err = parseCronValue(lowAndHigh[0], f); err != nil {
+			return 0, err
+		}
+		end = start
+		if len(lowAndHigh) == 2 {
+			if end, err = parseCronValue(lowAndHigh[1], f); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	step := 1
+	if len(rangeAndStep) == 2 {
+		if step, err = strconv.Atoi(rangeAndStep[1]); err != nil || step <= 0 {
+			return 0, fmt.Errorf("cron 步长无效: %q", expr)
+		}
+		// "N/step" means "N-max/step"
+		if len(lowAndHigh) == 1 && extra == 0 {
+			end = f.max
+		}
+		if step > 1 {
+			extra = 0
+		}
+	}
+
+	// Sunday may be written as 7
+	if f.max == 6 && end == 7 {
+		if start == 7 {
+			start, end = 0, 0
+		} else {
+			end = 6
+			extra |= 1 << 0
+		}
+	}
+
+	if start < f.min || end > f.max || start > end {
+		return 0, fmt.Errorf("cron 取值超出范围 [%d-%d]: %q", f.min, f.max, expr)
+	}
+
+	var bits uint64
+	for i := start; i <= end; i += step {
+		bits |= 1 << uint(i)
+	}
+	return bits | extra, nil
+}
+
+func parseCronValue(s string, f cronField) (int, error) {
+	if f.names != nil {
+		if v, ok := f.names[strings.ToLower(s)]; ok {
+			return v, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("cron 取值无效: %q", s)
+	}
+	return v, nil
+}
+
+// Next returns the first activation time strictly after t,
+// or the zero time if none is found within five years
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Add(time.Second - time.Duration(t.Nanosecond())*time.Nanosecond)
+	added := false
+	yearLimit := t.Year() + 5
+
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for 1<<uint(t.Month())&c.month == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+
+	for !c.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		}
+		t = t.AddDate(0, 0, 1)
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Hour())&c.hour == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+		}
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Minute())&c.minute == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Minute)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Second())&c.second == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Second)
+		}
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto WRAP
+		}
+	}
+
+	return t
+}
+
+// dayMatches applies the usual cron rule: if both day-of-month and day-of-week
+// are restricted, a day matches when either of them matches
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := 1<<uint(t.Day())&c.dom > 0
+	dowMatch := 1<<uint(t.Weekday())&c.dow > 0
+	if c.dom&starBit > 0 || c.dow&starBit > 0 {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
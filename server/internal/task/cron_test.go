@@ -0,0 +1,57 @@
+package task
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	base := time.Date(2024, 1, 31, 23, 59, 30, 0, time.Local) // Wednesday
+
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.Local)},
+		{"*/15 * * * * *", time.Date(2024, 1, 31, 23, 59, 45, 0, time.Local)},
+		{"0 3 * * *", time.Date(2024, 2, 1, 3, 0, 0, 0, time.Local)},
+		{"30 2 1 * *", time.Date(2024, 2, 1, 2, 30, 0, 0, time.Local)},
+		{"0 0 * * 0", time.Date(2024, 2, 4, 0, 0, 0, 0, time.Local)},
+		{"0 0 * * 7", time.Date(2024, 2, 4, 0, 0, 0, 0, time.Local)},
+		{"0 0 * * mon-fri", time.Date(2024, 2, 1, 0, 0, 0, 0, time.Local)},
+		{"0 0 0 29 2 ?", time.Date(2024, 2, 29, 0, 0, 0, 0, time.Local)},
+		{"@hourly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.Local)},
+	}
+
+	for _, tc := range cases {
+		c, err := parseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", tc.expr, err)
+		}
+		if got := c.Next(base); !got.Equal(tc.want) {
+			t.Errorf("%q: next = %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	cases := []struct{ typ, value string }{
+		{ScheduleLoop, ""},
+		{ScheduleLoop, "0"},
+		{ScheduleLoop, "abc"},
+		{ScheduleCron, "* * *"},
+		{ScheduleCron, "61 * * * *"},
+		{ScheduleCron, "*/0 * * * *"},
+		{"weekly", "1"},
+	}
+
+	for _, tc := range cases {
+		if err := ValidateSchedule(tc.typ, tc.value); err == nil {
+			t.Errorf("expected error for %s %q", tc.typ, tc.value)
+		}
+	}
+
+	if err := ValidateSchedule("", ""); err != nil {
+		t.Errorf("empty schedule should be valid: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package task
 
 import (
 	"fmt"
+	"path/filepath"
 	"sync"
 
 	"github.com/fasaxi-linker/servergo/internal/logs"
@@ -54,6 +55,16 @@ func GetLoggerWithType(taskID int, execType logs.ExecutionType) func(level, msg
 	}
 }
 
+// LogPath returns the file the active logger of a task writes to, or "" if none
+func LogPath(taskID int) string {
+	loggersMu.RLock()
+	defer loggersMu.RUnlock()
+	if logger, ok := activeLoggers[taskID]; ok {
+		return logger.Path()
+	}
+	return ""
+}
+
 // CloseLogger closes the logger for a specific task
 func CloseLogger(taskID int) {
 	loggersMu.Lock()
@@ -70,21 +81,22 @@ func GetLogFiles(taskID int) ([]logs.LogFileInfo, error) {
 	return logs.GetLogFiles(taskID)
 }
 
-// GetLogEntries reads the log entries from file with pagination and filtering
-func GetLogEntries(taskID int, filename string, page, pageSize int, levelFilter, search string) ([]logs.LogEntry, int, error) {
+// GetLogEntries reads the log entries from file with pagination and filtering.
+// An empty filename reads the latest log; file is the name of the log read.
+func GetLogEntries(taskID int, filename string, page, pageSize int, levelFilter, search string) (entries []logs.LogEntry, total int, file string, err error) {
 	// If no filename specified, use the latest
 	if filename == "" {
-		var err error
 		filename, err = logs.GetLatestLogFile(taskID)
 		if err != nil {
-			return nil, 0, err
+			return nil, 0, "", err
 		}
 		if filename == "" {
-			return []logs.LogEntry{}, 0, nil
+			return []logs.LogEntry{}, 0, "", nil
 		}
 	}
 
-	return logs.ReadLogFile(taskID, filename, page, pageSize, levelFilter, search)
+	entries, total, err = logs.ReadLogFile(taskID, filename, page, pageSize, levelFilter, search)
+	return entries, total, filepath.Base(filename), err
 }
 
 // ClearLog clears log files for a specific task
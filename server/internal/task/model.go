@@ -1,10 +1,15 @@
 package task
 
 import (
-	"fmt"
 	"github.com/fasaxi-linker/servergo/pkg/core"
 )
 
+// Task types
+const (
+	TypeMain  = "main"
+	TypePrune = "prune"
+)
+
 // Task represents a task configuration
 type Task struct {
 	ID            int           `json:"id"`
@@ -25,6 +30,8 @@ type Task struct {
 	ConfigID      int           `json:"configId"`          // db id for association
 	IsWatching    bool          `json:"isWatching"`
 	WatchError    string        `json:"watchError,omitempty"` // Watch failure reason
+	Priority      int           `json:"priority,omitempty"`   // run queue order, higher first
+	AdvancedOptions
 }
 
 type PathMapping struct {
@@ -54,11 +61,9 @@ func (t *Task) ToCoreOptions() core.Options {
 		MkdirIfSingle: t.MkdirIfSingle,
 		DeleteDir:     t.DeleteDir,
 		KeepDirStruct: t.KeepDirStruct,
+		Priority:      t.Priority,
 	}
-	// Debug: print cache status
-	if opts.OpenCache {
-		fmt.Printf("DEBUG: Cache is enabled for task %s\n", t.Name)
-	}
+	t.AdvancedOptions.applyTo(&opts)
 	return opts
 }
 
@@ -95,6 +100,10 @@ func (t *Task) ToCoreOptionsWithConfig(config ConfigOptions) core.Options {
 		MkdirIfSingle: config != nil && config.GetMkdirIfSingle(),
 		DeleteDir:     config != nil && config.GetDeleteDir(),
 		KeepDirStruct: config != nil && config.GetKeepDirStruct(),
+		Priority:      t.Priority,
+	}
+	if config != nil {
+		config.GetAdvancedOptions().applyTo(&opts)
 	}
 
 	return opts
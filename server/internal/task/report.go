@@ -0,0 +1,110 @@
+package task
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fasaxi-linker/servergo/internal/logs"
+	"github.com/fasaxi-linker/servergo/pkg/core"
+)
+
+// ReportDir returns where the run reports of a task are saved. A report has
+// the name of the log file of its run and is removed together with it.
+func ReportDir(taskID int) string {
+	return filepath.Join(logs.TaskDir(taskID), "reports")
+}
+
+// ReportFile returns the path of a run report; an empty name selects the newest
+func ReportFile(taskID int, name string) (string, error) {
+	if name == "" {
+		return latestReport(taskID)
+	}
+	if name != filepath.Base(name) || !strings.HasSuffix(name, ".jsonl") {
+		return "", fmt.Errorf("invalid report name: %q", name)
+	}
+	path := filepath.Join(ReportDir(taskID), name)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("report %s not found", name)
+	}
+	return path, nil
+}
+
+func latestReport(taskID int) (string, error) {
+	entries, err := os.ReadDir(ReportDir(taskID))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	var latest string
+	var latestTime time.Time
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || e.IsDir() || !strings.HasSuffix(e.Name(), ".jsonl") {
+			continue
+		}
+		if latest == "" || info.ModTime().After(latestTime) {
+			latest, latestTime = e.Name(), info.ModTime()
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("no report found")
+	}
+	return filepath.Join(ReportDir(taskID), latest), nil
+}
+
+// runReport is the report file of one run
+type runReport struct {
+	*core.Report
+	name string
+	file *os.File
+	buf  *bufio.Writer
+}
+
+// newRunReport creates the report file of a run next to its log file
+func newRunReport(taskID int) (*runReport, error) {
+	dir := ReportDir(taskID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	pruneReports(taskID)
+
+	name := filepath.Base(LogPath(taskID))
+	if name == "." {
+		name = fmt.Sprintf("run_%s.jsonl", time.Now().Format("20060102_150405"))
+	}
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(f)
+	return &runReport{Report: core.NewReport(buf), name: name, file: f, buf: buf}, nil
+}
+
+// close flushes the report to disk
+func (r *runReport) close() error {
+	err := r.Err()
+	if flushErr := r.buf.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// pruneReports removes the reports whose log file was removed by log retention
+// or cleared by the user
+func pruneReports(taskID int) {
+	entries, err := os.ReadDir(ReportDir(taskID))
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if _, err := os.Stat(filepath.Join(logs.TaskDir(taskID), e.Name())); os.IsNotExist(err) {
+			os.Remove(filepath.Join(ReportDir(taskID), e.Name()))
+		}
+	}
+}
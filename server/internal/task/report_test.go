@@ -0,0 +1,97 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fasaxi-linker/servergo/internal/logs"
+)
+
+func TestReportFile(t *testing.T) {
+	logs.BaseDir = t.TempDir()
+	dir := ReportDir(1)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "run_1.jsonl"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Readable through a traversal if the name were not checked
+	if err := os.WriteFile(filepath.Join(logs.BaseDir, "secret.jsonl"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "", want: "run_1.jsonl"},
+		{name: "run_1.jsonl", want: "run_1.jsonl"},
+		{name: "missing.jsonl", wantErr: true},
+		{name: "run_1.log", wantErr: true},
+		{name: "../../secret.jsonl", wantErr: true},
+		{name: "reports/run_1.jsonl", wantErr: true},
+		{name: filepath.Join(logs.BaseDir, "secret.jsonl"), wantErr: true},
+	}
+	for _, c := range cases {
+		path, err := ReportFile(1, c.name)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%q: err = %v, wantErr %v", c.name, err, c.wantErr)
+			continue
+		}
+		if !c.wantErr && path != filepath.Join(dir, c.want) {
+			t.Errorf("%q: path = %s, want %s", c.name, path, filepath.Join(dir, c.want))
+		}
+	}
+
+	if _, err := ReportFile(2, ""); err == nil {
+		t.Error("task without reports: want an error")
+	}
+}
+
+func TestRunReportFollowsLogFile(t *testing.T) {
+	logs.BaseDir = t.TempDir()
+	const taskID = 3
+
+	// A report whose log file is gone is removed when the next one is created
+	if err := os.MkdirAll(ReportDir(taskID), 0755); err != nil {
+		t.Fatal(err)
+	}
+	stale := filepath.Join(ReportDir(taskID), "run_old.jsonl")
+	if err := os.WriteFile(stale, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	GetLoggerWithType(taskID, logs.ExecRun)("INFO", "started")
+	defer CloseLogger(taskID)
+
+	r, err := newRunReport(taskID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := filepath.Base(LogPath(taskID)); r.name != want || !strings.HasSuffix(r.name, ".jsonl") {
+		t.Errorf("report name %q, want the log file's %q", r.name, want)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("report without a log file was kept")
+	}
+	if path, err := ReportFile(taskID, ""); err != nil || filepath.Base(path) != r.name {
+		t.Errorf("latest report = %s (%v), want %s", path, err, r.name)
+	}
+
+	// Removing the log file takes the report with it
+	if err := os.Remove(filepath.Join(logs.TaskDir(taskID), r.name)); err != nil {
+		t.Fatal(err)
+	}
+	pruneReports(taskID)
+	if _, err := ReportFile(taskID, r.name); err == nil {
+		t.Error("report outlived its log file")
+	}
+}
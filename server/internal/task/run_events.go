@@ -0,0 +1,180 @@
+package task
+
+import (
+	"time"
+
+	"github.com/fasaxi-linker/servergo/pkg/core"
+)
+
+// Run event types pushed to stream subscribers
+const (
+	EventProgress = "progress"
+	EventLog      = "log"
+	EventDone     = "done"
+	EventQueued   = "queued"
+)
+
+// subscriberBuffer bounds how far a slow subscriber may fall behind before events
+// are dropped. The last slot is kept free for the done event.
+const subscriberBuffer = 256
+
+// RunEvent is a progress update, log line or completion notice of a running task
+type RunEvent struct {
+	Type     string         `json:"type"`
+	Time     time.Time      `json:"time"`
+	Progress *core.Progress `json:"progress,omitempty"`
+	Level    string         `json:"level,omitempty"`
+	Message  string         `json:"message,omitempty"`
+	Result   *RunResult     `json:"result,omitempty"`
+	Queue    *QueuedRun     `json:"queue,omitempty"`
+}
+
+// setProgress stores the latest snapshot and forwards it to subscribers
+func (r *RunState) setProgress(p core.Progress) {
+	r.eventsMu.Lock()
+	r.progress = p
+	r.eventsMu.Unlock()
+	r.publish(RunEvent{Type: EventProgress, Time: time.Now(), Progress: &p})
+}
+
+// Progress returns the latest progress snapshot
+func (r *RunState) Progress() core.Progress {
+	r.eventsMu.Lock()
+	defer r.eventsMu.Unlock()
+	return r.progress
+}
+
+// publish delivers an event without blocking; slow subscribers miss events.
+// Sends only happen under eventsMu, so a channel seen with a free slot besides
+// the one reserved for done cannot fill up before the send.
+func (r *RunState) publish(ev RunEvent) {
+	r.eventsMu.Lock()
+	defer r.eventsMu.Unlock()
+	for ch := range r.subscribers {
+		if len(ch) < cap(ch)-1 {
+			ch <- ev
+		}
+	}
+}
+
+// closeSubscribers sends the final event and closes every subscriber channel
+func (r *RunState) closeSubscribers(result *RunResult) {
+	r.eventsMu.Lock()
+	defer r.eventsMu.Unlock()
+	ev := RunEvent{Type: EventDone, Time: time.Now(), Result: result}
+	for ch := range r.subscribers {
+		ch <- ev // never blocks, publish leaves a slot free
+		close(ch)
+	}
+	r.subscribers = nil
+	r.finished = true
+}
+
+// SubscribeRun registers a listener for a running or queued task.
+// It returns the event channel (closed when the run ends) and an unsubscribe
+// function; ok is false if the task is neither running nor queued. The first
+// event is the current progress snapshot, or a queued event with the queue
+// entry when the run waits in the queue; its events follow once it starts.
+func SubscribeRun(taskID int) (events <-chan RunEvent, unsubscribe func(), ok bool) {
+	ch := make(chan RunEvent, subscriberBuffer)
+
+	runManager.mu.Lock()
+	state, running := runManager.running[taskID]
+	if !running {
+		defer runManager.mu.Unlock()
+		q, queued := runManager.queueEntry(taskID)
+		if !queued {
+			return nil, nil, false
+		}
+		if runManager.waiting == nil {
+			runManager.waiting = make(map[int]map[chan RunEvent]struct{})
+		}
+		if runManager.waiting[taskID] == nil {
+			runManager.waiting[taskID] = make(map[chan RunEvent]struct{})
+		}
+		runManager.waiting[taskID][ch] = struct{}{}
+		ch <- RunEvent{Type: EventQueued, Time: time.Now(), Queue: &q}
+		return ch, func() { unsubscribeRun(taskID, ch) }, true
+	}
+	runManager.mu.Unlock()
+
+	state.eventsMu.Lock()
+	defer state.eventsMu.Unlock()
+	if state.finished {
+		return nil, nil, false
+	}
+	state.addSubscriber(ch)
+	return ch, func() { unsubscribeRun(taskID, ch) }, true
+}
+
+// addSubscriber registers ch and sends it the current progress; the caller holds eventsMu
+func (r *RunState) addSubscriber(ch chan RunEvent) {
+	if r.subscribers == nil {
+		r.subscribers = make(map[chan RunEvent]struct{})
+	}
+	r.subscribers[ch] = struct{}{}
+	p := r.progress
+	ch <- RunEvent{Type: EventProgress, Time: time.Now(), Progress: &p}
+}
+
+// unsubscribeRun removes ch from the queued or running task it listens to and
+// closes it, unless the run already closed it
+func unsubscribeRun(taskID int, ch chan RunEvent) {
+	runManager.mu.Lock()
+	if _, ok := runManager.waiting[taskID][ch]; ok {
+		delete(runManager.waiting[taskID], ch)
+		runManager.mu.Unlock()
+		close(ch)
+		return
+	}
+	state := runManager.running[taskID]
+	runManager.mu.Unlock()
+	if state == nil {
+		return
+	}
+
+	state.eventsMu.Lock()
+	defer state.eventsMu.Unlock()
+	if _, ok := state.subscribers[ch]; ok {
+		delete(state.subscribers, ch)
+		close(ch)
+	}
+}
+
+// attachWaiting moves the subscribers of a queued task to its run when it
+// starts; the caller holds mu
+func (m *RunManager) attachWaiting(state *RunState) {
+	waiting := m.waiting[state.TaskID]
+	if len(waiting) == 0 {
+		return
+	}
+	delete(m.waiting, state.TaskID)
+
+	state.eventsMu.Lock()
+	defer state.eventsMu.Unlock()
+	for ch := range waiting {
+		state.addSubscriber(ch)
+	}
+}
+
+// closeWaiting ends the streams of a queued task that was removed from the
+// queue without running; the caller holds mu
+func (m *RunManager) closeWaiting(taskID int) {
+	ev := RunEvent{Type: EventDone, Time: time.Now(), Message: "已取消排队"}
+	for ch := range m.waiting[taskID] {
+		ch <- ev // the buffer only holds the queued event
+		close(ch)
+	}
+	delete(m.waiting, taskID)
+}
+
+// GetProgress returns the latest progress snapshot of a running task
+func GetProgress(taskID int) (core.Progress, bool) {
+	runManager.mu.RLock()
+	state, ok := runManager.running[taskID]
+	runManager.mu.RUnlock()
+	if !ok {
+		return core.Progress{}, false
+	}
+	return state.Progress(), true
+}
@@ -0,0 +1,83 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/fasaxi-linker/servergo/pkg/core"
+)
+
+func TestDoneDeliveredToSlowSubscriber(t *testing.T) {
+	ch := make(chan RunEvent, subscriberBuffer)
+	state := &RunState{subscribers: map[chan RunEvent]struct{}{ch: {}}}
+
+	// Nobody reads while the run floods the buffer
+	for i := 0; i < subscriberBuffer*2; i++ {
+		state.setProgress(core.Progress{Scanned: i})
+	}
+	state.closeSubscribers(&RunResult{TaskID: 1})
+
+	var last RunEvent
+	n := 0
+	for ev := range ch {
+		last = ev
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("got %d events, want %d", n, subscriberBuffer)
+	}
+	if last.Type != EventDone || last.Result == nil || last.Result.TaskID != 1 {
+		t.Fatalf("last event %+v, want done with the result", last)
+	}
+}
+
+func TestSubscribeQueuedRun(t *testing.T) {
+	runManager.mu.Lock()
+	runManager.queue = []*queuedRun{queued(42, 0, 1, nil), queued(43, 0, 2, nil)}
+	runManager.mu.Unlock()
+	defer func() {
+		runManager.mu.Lock()
+		runManager.queue = nil
+		delete(runManager.running, 42)
+		runManager.mu.Unlock()
+	}()
+
+	events, unsubscribe, ok := SubscribeRun(42)
+	if !ok {
+		t.Fatal("queued task: not subscribed")
+	}
+	defer unsubscribe()
+	if ev := <-events; ev.Type != EventQueued || ev.Queue == nil || ev.Queue.Position != 1 {
+		t.Fatalf("first event %+v, want queued at position 1", ev)
+	}
+
+	// The run is dispatched: the subscriber receives its events
+	state := &RunState{TaskID: 42}
+	runManager.mu.Lock()
+	runManager.queue = runManager.queue[1:]
+	runManager.running[42] = state
+	runManager.attachWaiting(state)
+	runManager.mu.Unlock()
+	if ev := <-events; ev.Type != EventProgress {
+		t.Fatalf("after start got %+v, want the progress snapshot", ev)
+	}
+	state.closeSubscribers(&RunResult{TaskID: 42})
+	if ev := <-events; ev.Type != EventDone || ev.Result == nil {
+		t.Fatalf("got %+v, want done with the result", ev)
+	}
+
+	// A run removed from the queue ends the stream
+	events, _, ok = SubscribeRun(43)
+	if !ok {
+		t.Fatal("queued task: not subscribed")
+	}
+	<-events
+	if err := StopRun(43); err != nil {
+		t.Fatal(err)
+	}
+	if ev := <-events; ev.Type != EventDone {
+		t.Fatalf("got %+v, want done", ev)
+	}
+	if _, open := <-events; open {
+		t.Fatal("channel still open after the queued run was removed")
+	}
+}
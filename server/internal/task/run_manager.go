@@ -2,11 +2,15 @@ package task
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/fasaxi-linker/servergo/internal/logs"
+	"github.com/fasaxi-linker/servergo/internal/runs"
 	"github.com/fasaxi-linker/servergo/pkg/core"
 )
 
@@ -15,18 +19,46 @@ type RunState struct {
 	TaskID    int                `json:"taskId"`
 	StartTime time.Time          `json:"startTime"`
 	Cancel    context.CancelFunc `json:"-"`
+
+	roots       []string // source and destination directories, see runRoots
+	progress    core.Progress
+	subscribers map[chan RunEvent]struct{}
+	finished    bool
+	eventsMu    sync.Mutex
+}
+
+// RunResult is the outcome of the most recent finished run of a task
+type RunResult struct {
+	TaskID    int        `json:"taskId"`
+	StartTime time.Time  `json:"startTime"`
+	EndTime   time.Time  `json:"endTime"`
+	Stats     core.Stats `json:"stats"`
+	Error     string     `json:"error,omitempty"`
+	Report    string     `json:"report,omitempty"` // name of the run report, see ReportFile
 }
 
-// RunManager manages running task instances
+// RunManager manages running task instances and the queue of runs waiting
+// for a free slot, see maxConcurrentRuns
 type RunManager struct {
 	running map[int]*RunState
+	last    map[int]*RunResult
+	queue   []*queuedRun                       // ordered by priority, then FIFO
+	waiting map[int]map[chan RunEvent]struct{} // stream subscribers of queued runs, see SubscribeRun
+	seq     uint64
 	mu      sync.RWMutex
 }
 
 var runManager = &RunManager{
 	running: make(map[int]*RunState),
+	last:    make(map[int]*RunResult),
 }
 
+// globalLimiter caps the file operations of all runs and watcher catch-up
+// scans together, so concurrent tasks cannot saturate the same disks:
+//   - RUN_MAX_WORKERS: files processed at once across all tasks (default 0, unlimited)
+//   - RUN_MAX_OPS_PER_SECOND: files started per second across all tasks (default 0, unlimited)
+var globalLimiter = core.NewLimiter(envInt("RUN_MAX_WORKERS", 0), envInt("RUN_MAX_OPS_PER_SECOND", 0))
+
 // IsRunning checks if a task is currently running
 func IsRunning(taskID int) bool {
 	runManager.mu.RLock()
@@ -35,46 +67,164 @@ func IsRunning(taskID int) bool {
 	return ok
 }
 
-// StartRun starts a task asynchronously
+// StartRun starts a manually triggered task asynchronously
 func StartRun(taskID int, opts core.Options) error {
+	return StartRunWithTrigger(taskID, opts, runs.TriggerManual)
+}
+
+// StartRunWithTrigger queues a task and records it in the run history under the
+// given trigger once it ran. The run starts as soon as fewer than
+// maxConcurrentRuns runs execute and no running task shares a source or
+// destination directory with it. Scheduled runs log to cron files, everything
+// else to run files.
+func StartRunWithTrigger(taskID int, opts core.Options, trigger string) error {
 	runManager.mu.Lock()
+	defer runManager.mu.Unlock()
+
 	if _, ok := runManager.running[taskID]; ok {
-		runManager.mu.Unlock()
 		return fmt.Errorf("任务正在执行中")
 	}
+	if runManager.queuedIndex(taskID) >= 0 {
+		return fmt.Errorf("任务已在排队中")
+	}
+
+	runManager.seq++
+	runManager.queue = enqueue(runManager.queue, &queuedRun{
+		taskID:   taskID,
+		opts:     opts,
+		trigger:  trigger,
+		seq:      runManager.seq,
+		queuedAt: time.Now(),
+		roots:    runRoots(opts),
+	})
+	runManager.dispatch()
+
+	if runManager.queuedIndex(taskID) >= 0 {
+		fmt.Printf("⏳ [Queue] 任务已加入执行队列: %s (排队 %d 个)\n", opts.Name, len(runManager.queue))
+	}
+	return nil
+}
+
+// dispatch starts queued runs while slots are free; the caller holds mu
+func (m *RunManager) dispatch() {
+	for maxConcurrentRuns <= 0 || len(m.running) < maxConcurrentRuns {
+		busy := make([][]string, 0, len(m.running))
+		for _, state := range m.running {
+			busy = append(busy, state.roots)
+		}
+		i := nextRunnable(m.queue, busy)
+		if i < 0 {
+			return
+		}
+		q := m.queue[i]
+		m.queue = append(m.queue[:i], m.queue[i+1:]...)
+		m.start(q)
+	}
+}
+
+// queuedIndex returns the queue position of a task, or -1; the caller holds mu
+func (m *RunManager) queuedIndex(taskID int) int {
+	for i, q := range m.queue {
+		if q.taskID == taskID {
+			return i
+		}
+	}
+	return -1
+}
+
+// start runs a dequeued task asynchronously; the caller holds mu
+func (m *RunManager) start(q *queuedRun) {
+	taskID, opts, trigger := q.taskID, q.opts, q.trigger
+	execType := logs.ExecRun
+	if trigger == runs.TriggerCron || trigger == runs.TriggerLoop {
+		execType = logs.ExecCron
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
-	runManager.running[taskID] = &RunState{
+	state := &RunState{
 		TaskID:    taskID,
 		StartTime: time.Now(),
 		Cancel:    cancel,
+		roots:     q.roots,
 	}
-	runManager.mu.Unlock()
+	m.running[taskID] = state
+	m.attachWaiting(state)
+
+	opts.OnProgress = state.setProgress
+	opts.Shared = globalLimiter
 
 	// Start async execution
 	go func() {
+		var stats core.Stats
+		var err error
+		var reportName string
+
 		defer func() {
-			runManager.mu.Lock()
-			delete(runManager.running, taskID)
-			runManager.mu.Unlock()
+			cancel()
+			result := &RunResult{
+				TaskID:    taskID,
+				StartTime: state.StartTime,
+				EndTime:   time.Now(),
+				Stats:     stats,
+				Report:    reportName,
+			}
+			if err != nil && !stats.Cancelled {
+				result.Error = err.Error()
+			}
+
+			m.mu.Lock()
+			delete(m.running, taskID)
+			m.last[taskID] = result
+			m.dispatch()
+			m.mu.Unlock()
+
+			state.closeSubscribers(result)
+			recordRun(runs.NewRecord(taskID, opts.Name, trigger, result.StartTime, result.EndTime, stats, err))
 		}()
 
-		// Get file logger
-		fileLogger := GetLoggerWithType(taskID, logs.ExecRun)
+		// Get file logger, mirrored to stream subscribers
+		taskLogger := GetLoggerWithType(taskID, execType)
+		fileLogger := func(level, msg string) {
+			taskLogger(level, msg)
+			state.publish(RunEvent{Type: EventLog, Time: time.Now(), Level: level, Message: msg})
+		}
+		if waited := state.StartTime.Sub(q.queuedAt); waited >= time.Second {
+			fileLogger("INFO", fmt.Sprintf("⏳ 排队等待 %.1f 秒", waited.Seconds()))
+		}
 		fileLogger("INFO", "🚀 任务开始执行...")
 
+		var report *runReport
+		if opts.RunReport && opts.Type != TypePrune {
+			var reportErr error
+			if report, reportErr = newRunReport(taskID); reportErr != nil {
+				fileLogger("WARN", fmt.Sprintf("⚠️ 无法创建运行报告: %v", reportErr))
+			} else {
+				opts.Report = report.Report
+			}
+		}
+
 		// Run with context for cancellation support
-		stats, err := runWithContext(ctx, opts, func(level, msg string) {
+		stats, err = runWithContext(ctx, opts, func(level, msg string) {
 			fileLogger(level, msg)
 		})
 
-		if ctx.Err() == context.Canceled {
-			fileLogger("WARN", "⚠️ 任务已被手动停止")
-			return
+		if report != nil {
+			if reportErr := report.close(); reportErr != nil {
+				fileLogger("WARN", fmt.Sprintf("⚠️ 运行报告写入失败: %v", reportErr))
+			} else {
+				reportName = report.name
+				fileLogger("INFO", fmt.Sprintf("📄 运行报告已生成: %s (%d 条记录)", report.name, report.Count()))
+			}
 		}
 
-		if err != nil {
+		if stats.Cancelled || errors.Is(err, context.Canceled) {
+			fileLogger("WARN", fmt.Sprintf("⚠️ 任务已被手动停止 (已完成: 成功 %d, 失败 %d)", stats.SuccessCount, stats.FailCount))
+		} else if err != nil {
 			fileLogger("ERROR", fmt.Sprintf("❌ 任务失败: %s", err.Error()))
+		} else if opts.Type == TypePrune {
+			fileLogger("SUCCEED", fmt.Sprintf("✅ 清理完成 (删除: %d, 释放: %s, 空目录: %d, 失败: %d)",
+				stats.DeletedCount, formatBytes(stats.FreedBytes), stats.RemovedDirs, stats.FailCount))
+			logFailures(fileLogger, stats)
 		} else {
 			fileLogger("SUCCEED", fmt.Sprintf("✅ 任务完成 (成功: %d, 失败: %d)", stats.SuccessCount, stats.FailCount))
 		}
@@ -82,15 +232,57 @@ func StartRun(taskID int, opts core.Options) error {
 		// Close log file
 		CloseLogger(taskID)
 	}()
+}
 
-	return nil
+// LastRun returns the result of the most recent finished run of a task
+func LastRun(taskID int) (*RunResult, bool) {
+	runManager.mu.RLock()
+	defer runManager.mu.RUnlock()
+	r, ok := runManager.last[taskID]
+	return r, ok
+}
+
+// IsQueued checks if a task is waiting in the run queue
+func IsQueued(taskID int) bool {
+	runManager.mu.RLock()
+	defer runManager.mu.RUnlock()
+	return runManager.queuedIndex(taskID) >= 0
 }
 
-// StopRun stops a running task
+// QueueStatus returns the queue entry of a waiting task
+func QueueStatus(taskID int) (QueuedRun, bool) {
+	runManager.mu.RLock()
+	defer runManager.mu.RUnlock()
+	return runManager.queueEntry(taskID)
+}
+
+// queueEntry describes the queue entry of a waiting task; the caller holds mu
+func (m *RunManager) queueEntry(taskID int) (QueuedRun, bool) {
+	i := m.queuedIndex(taskID)
+	if i < 0 {
+		return QueuedRun{}, false
+	}
+	q := m.queue[i]
+	return QueuedRun{
+		TaskID:   q.taskID,
+		Priority: q.opts.Priority,
+		Position: i + 1,
+		Trigger:  q.trigger,
+		QueuedAt: q.queuedAt,
+	}, true
+}
+
+// StopRun stops a running task or removes it from the queue
 func StopRun(taskID int) error {
 	runManager.mu.Lock()
 	defer runManager.mu.Unlock()
 
+	if i := runManager.queuedIndex(taskID); i >= 0 {
+		runManager.queue = append(runManager.queue[:i], runManager.queue[i+1:]...)
+		runManager.closeWaiting(taskID)
+		return nil
+	}
+
 	state, ok := runManager.running[taskID]
 	if !ok {
 		return fmt.Errorf("任务未在执行")
@@ -100,17 +292,10 @@ func StopRun(taskID int) error {
 	return nil
 }
 
-// runWithContext wraps core.Run with context cancellation support
+// runWithContext dispatches to core.Run / core.Prune by task type.
+// Log lines emitted after cancellation are suppressed.
 func runWithContext(ctx context.Context, opts core.Options, logger func(string, string)) (core.Stats, error) {
-	// Check if already cancelled
-	select {
-	case <-ctx.Done():
-		return core.Stats{}, ctx.Err()
-	default:
-	}
-
-	// Run the task (core.Run doesn't support context yet, but we can check periodically)
-	return core.Run(opts, func(level, msg string) {
+	ctxLogger := func(level, msg string) {
 		// Check cancellation before each log
 		select {
 		case <-ctx.Done():
@@ -120,5 +305,63 @@ func runWithContext(ctx context.Context, opts core.Options, logger func(string,
 				logger(level, msg)
 			}
 		}
-	})
+	}
+
+	if opts.Type == TypePrune {
+		return core.Prune(ctx, opts, ctxLogger)
+	}
+	return core.Run(ctx, opts, ctxLogger)
+}
+
+// recordRun persists a finished run; failures are only reported since the run itself is over
+func recordRun(r runs.Record) {
+	store := &runs.Store{}
+	if _, err := store.Add(r); err != nil {
+		fmt.Printf("⚠️ 保存执行记录失败 (任务 %d): %v\n", r.TaskID, err)
+	}
+}
+
+// watchBatchRecorder returns a watcher hook that records each processed batch as a run
+func watchBatchRecorder(taskID int, taskName string) func(start, end time.Time, stats core.Stats) {
+	return func(start, end time.Time, stats core.Stats) {
+		recordRun(runs.NewRecord(taskID, taskName, runs.TriggerWatchBatch, start, end, stats, nil))
+	}
+}
+
+// watchScanRecorder returns an OnScan hook that stores the catch-up scan of a watcher
+func watchScanRecorder(taskID int, taskName string) func(start, end time.Time, stats core.Stats, err error) {
+	return func(start, end time.Time, stats core.Stats, err error) {
+		recordRun(runs.NewRecord(taskID, taskName, runs.TriggerWatchStart, start, end, stats, err))
+	}
+}
+
+// logFailures writes a per-reason summary of failed files
+func logFailures(logger func(string, string), stats core.Stats) {
+	for reason, files := range stats.FailFiles {
+		logger("ERROR", fmt.Sprintf("❌ 失败原因 [%s]: %d 个文件", reason, len(files)))
+	}
+}
+
+// envInt reads a non-negative integer from the environment
+func envInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return def
+}
+
+// formatBytes renders a byte count in human readable units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
 }
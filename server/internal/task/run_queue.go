@@ -0,0 +1,92 @@
+package task
+
+import (
+	"sort"
+	"time"
+
+	"github.com/fasaxi-linker/servergo/pkg/core"
+)
+
+// maxConcurrentRuns bounds how many runs execute at once; further runs wait in
+// the queue. RUN_MAX_CONCURRENT sets it (default 0, unlimited); runs sharing a
+// directory still wait for each other.
+var maxConcurrentRuns = envInt("RUN_MAX_CONCURRENT", 0)
+
+// queuedRun is a run waiting for a free slot
+type queuedRun struct {
+	taskID   int
+	opts     core.Options
+	trigger  string
+	seq      uint64
+	queuedAt time.Time
+	roots    []string
+}
+
+// QueuedRun describes a run waiting in the queue
+type QueuedRun struct {
+	TaskID   int       `json:"taskId"`
+	Priority int       `json:"priority"`
+	Position int       `json:"position"` // 1 is the next run to start
+	Trigger  string    `json:"trigger"`
+	QueuedAt time.Time `json:"queuedAt"`
+}
+
+// enqueue inserts q keeping the queue ordered by priority, then FIFO
+func enqueue(queue []*queuedRun, q *queuedRun) []*queuedRun {
+	i := sort.Search(len(queue), func(i int) bool {
+		return runsBefore(q, queue[i])
+	})
+	queue = append(queue, nil)
+	copy(queue[i+1:], queue[i:])
+	queue[i] = q
+	return queue
+}
+
+// runsBefore reports whether a is started before b
+func runsBefore(a, b *queuedRun) bool {
+	if a.opts.Priority != b.opts.Priority {
+		return a.opts.Priority > b.opts.Priority
+	}
+	return a.seq < b.seq
+}
+
+// nextRunnable returns the index of the first queued run whose paths do not
+// overlap those of a running task, or -1. A run blocked by a running task
+// does not hold back the runs behind it.
+func nextRunnable(queue []*queuedRun, busy [][]string) int {
+	for i, q := range queue {
+		free := true
+		for _, roots := range busy {
+			if rootsOverlap(q.roots, roots) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return i
+		}
+	}
+	return -1
+}
+
+// runRoots lists the source and destination directories of a run
+func runRoots(opts core.Options) []string {
+	var roots []string
+	for src, dests := range opts.PathsMapping {
+		roots = append(roots, src)
+		roots = append(roots, dests...)
+	}
+	return roots
+}
+
+// rootsOverlap reports whether a directory of a is, contains or lies below one of b
+func rootsOverlap(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if pathsOverlap(x, y) {
+				return true
+			}
+		}
+	}
+	return false
+}
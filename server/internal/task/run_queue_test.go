@@ -0,0 +1,57 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/fasaxi-linker/servergo/pkg/core"
+)
+
+func queued(taskID, priority int, seq uint64, paths map[string][]string) *queuedRun {
+	opts := core.Options{TaskID: taskID, Priority: priority, PathsMapping: paths}
+	return &queuedRun{taskID: taskID, opts: opts, seq: seq, roots: runRoots(opts)}
+}
+
+func TestEnqueueOrder(t *testing.T) {
+	var queue []*queuedRun
+	queue = enqueue(queue, queued(1, 0, 1, nil))
+	queue = enqueue(queue, queued(2, 5, 2, nil))
+	queue = enqueue(queue, queued(3, 0, 3, nil))
+	queue = enqueue(queue, queued(4, 5, 4, nil))
+	queue = enqueue(queue, queued(5, -1, 5, nil))
+
+	// Higher priority first, FIFO within the same priority
+	want := []int{2, 4, 1, 3, 5}
+	for i, q := range queue {
+		if q.taskID != want[i] {
+			t.Fatalf("position %d: task %d, want %d", i+1, q.taskID, want[i])
+		}
+	}
+}
+
+func TestNextRunnable(t *testing.T) {
+	queue := []*queuedRun{
+		queued(1, 0, 1, map[string][]string{"/data/tv": {"/media/tv"}}),
+		queued(2, 0, 2, map[string][]string{"/data/movies": {"/media/movies"}}),
+	}
+
+	if i := nextRunnable(queue, nil); i != 0 {
+		t.Errorf("nothing running: got %d, want 0", i)
+	}
+
+	// A running task on the same source blocks task 1 but not task 2 behind it
+	busy := [][]string{{"/data/tv", "/backup/tv"}}
+	if i := nextRunnable(queue, busy); i != 1 {
+		t.Errorf("source shared: got %d, want 1", i)
+	}
+
+	// Nested directories count as shared
+	busy = [][]string{{"/other", "/media"}}
+	if i := nextRunnable(queue, busy); i != -1 {
+		t.Errorf("destination parent running: got %d, want -1", i)
+	}
+
+	busy = [][]string{{"/data/tv-old", "/media/tv-old"}}
+	if i := nextRunnable(queue, busy); i != 0 {
+		t.Errorf("sibling with common prefix: got %d, want 0", i)
+	}
+}
@@ -0,0 +1,170 @@
+package task
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ScheduleLoop = "loop"
+	ScheduleCron = "cron"
+)
+
+// schedule computes the next activation time after a given instant
+type schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// loopSchedule fires at a fixed interval
+type loopSchedule struct {
+	interval time.Duration
+}
+
+func (l loopSchedule) Next(t time.Time) time.Time {
+	return t.Add(l.interval)
+}
+
+// parseSchedule parses a task's schedule_type / schedule_value pair
+func parseSchedule(scheduleType, scheduleValue string) (schedule, error) {
+	value := strings.TrimSpace(scheduleValue)
+	switch scheduleType {
+	case ScheduleLoop:
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("执行周期必须为正整数秒: %q", scheduleValue)
+		}
+		return loopSchedule{interval: time.Duration(seconds) * time.Second}, nil
+	case ScheduleCron:
+		return parseCron(value)
+	default:
+		return nil, fmt.Errorf("未知的定时任务类型: %q", scheduleType)
+	}
+}
+
+// ValidateSchedule checks a schedule definition; an empty type means "no schedule"
+func ValidateSchedule(scheduleType, scheduleValue string) error {
+	if scheduleType == "" {
+		return nil
+	}
+	_, err := parseSchedule(scheduleType, scheduleValue)
+	return err
+}
+
+type scheduleEntry struct {
+	scheduleType  string
+	scheduleValue string
+	schedule      schedule
+	next          time.Time
+	timer         *time.Timer
+}
+
+func (e *scheduleEntry) stop() {
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+}
+
+// Scheduler fires scheduled tasks according to their loop interval or cron expression
+type Scheduler struct {
+	entries map[int]*scheduleEntry
+	fire    func(taskID int)
+	mu      sync.Mutex
+}
+
+func newScheduler(fire func(taskID int)) *Scheduler {
+	return &Scheduler{
+		entries: make(map[int]*scheduleEntry),
+		fire:    fire,
+	}
+}
+
+// Set (re)schedules a task from its current definition.
+// Tasks without a schedule are removed; an unchanged schedule keeps its pending timer.
+func (s *Scheduler) Set(t Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.entries[t.ID]; ok {
+		if existing.scheduleType == t.ScheduleType && existing.scheduleValue == t.ScheduleValue {
+			return nil
+		}
+		existing.stop()
+		delete(s.entries, t.ID)
+	}
+
+	if t.ScheduleType == "" {
+		return nil
+	}
+
+	sched, err := parseSchedule(t.ScheduleType, t.ScheduleValue)
+	if err != nil {
+		return err
+	}
+
+	entry := &scheduleEntry{
+		scheduleType:  t.ScheduleType,
+		scheduleValue: t.ScheduleValue,
+		schedule:      sched,
+	}
+	s.entries[t.ID] = entry
+	s.arm(t.ID, entry, time.Now())
+	return nil
+}
+
+// Remove cancels the schedule of a task
+func (s *Scheduler) Remove(taskID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[taskID]; ok {
+		entry.stop()
+		delete(s.entries, taskID)
+	}
+}
+
+// Next returns the next fire time of a task
+func (s *Scheduler) Next(taskID int) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[taskID]
+	if !ok || entry.next.IsZero() {
+		return time.Time{}, false
+	}
+	return entry.next, true
+}
+
+// Stop cancels all pending timers
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, entry := range s.entries {
+		entry.stop()
+		delete(s.entries, id)
+	}
+}
+
+// arm computes the next activation and starts its timer; callers hold s.mu
+func (s *Scheduler) arm(taskID int, entry *scheduleEntry, now time.Time) {
+	entry.next = entry.schedule.Next(now)
+	if entry.next.IsZero() {
+		return
+	}
+
+	entry.timer = time.AfterFunc(entry.next.Sub(now), func() {
+		s.mu.Lock()
+		// The entry may have been replaced or removed while the timer was pending
+		if current, ok := s.entries[taskID]; !ok || current != entry {
+			s.mu.Unlock()
+			return
+		}
+		s.arm(taskID, entry, time.Now())
+		s.mu.Unlock()
+
+		s.fire(taskID)
+	})
+}
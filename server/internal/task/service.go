@@ -24,6 +24,8 @@ type Service struct {
 	// Easier: Just load fresh every time we save? Or cache.
 	watchers map[int]*core.Watcher
 	wMu      sync.RWMutex
+
+	scheduler *Scheduler
 }
 
 func NewService() (*Service, error) {
@@ -39,6 +41,7 @@ func NewService() (*Service, error) {
 		tasksMap: make(map[int]Task),
 		watchers: make(map[int]*core.Watcher),
 	}
+	s.scheduler = newScheduler(s.runScheduled)
 	s.rebuildMap()
 
 	// Restore watching state
@@ -47,6 +50,9 @@ func NewService() (*Service, error) {
 		fmt.Printf("Warning: RESTORE WATCH STATE FAILED: %v\n", err)
 	}
 
+	// Start scheduled (loop/cron) tasks
+	s.loadSchedules()
+
 	return s, nil
 }
 
@@ -93,6 +99,7 @@ func (s *Service) Add(t Task) error {
 
 	s.tasks = append(s.tasks, t)
 	s.rebuildMap()
+	s.reschedule(t)
 	return nil
 }
 
@@ -128,6 +135,7 @@ func (s *Service) Update(taskID int, t Task) error {
 		}
 	}
 	s.rebuildMap()
+	s.reschedule(t)
 	return nil
 }
 
@@ -155,6 +163,9 @@ func (s *Service) Delete(taskID int) error {
 
 	s.tasks = newTasks
 	s.rebuildMap()
+	if s.scheduler != nil {
+		s.scheduler.Remove(taskID)
+	}
 	return nil
 }
 
@@ -176,6 +187,9 @@ func (s *Service) StartWatch(taskID int, logger func(string, string)) error {
 	}
 
 	opts := s.getTaskOptions(task)
+	opts.OnBatch = watchBatchRecorder(taskID, opts.Name)
+	opts.OnScan = watchScanRecorder(taskID, opts.Name)
+	opts.Shared = globalLimiter
 
 	w, err := core.NewWatcher(opts, logger)
 	if err != nil {
@@ -214,6 +228,9 @@ func (s *Service) StartWatchWithOptions(taskID int, logger func(string, string),
 		return nil // Already watching
 	}
 
+	opts.OnBatch = watchBatchRecorder(taskID, opts.Name)
+	opts.OnScan = watchScanRecorder(taskID, opts.Name)
+	opts.Shared = globalLimiter
 	w, err := core.NewWatcher(opts, logger)
 	if err != nil {
 		// Update task state: set error message
@@ -270,6 +287,18 @@ func (s *Service) StopWatch(taskID int) error {
 	return nil
 }
 
+// GetPendingFiles returns the files a running watcher is waiting to link
+func (s *Service) GetPendingFiles(taskID int) ([]core.PendingFile, error) {
+	s.wMu.RLock()
+	w, ok := s.watchers[taskID]
+	s.wMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("task %d is not being watched", taskID)
+	}
+	return w.Pending(), nil
+}
+
 func (s *Service) IsWatching(taskID int) bool {
 	s.wMu.RLock()
 	defer s.wMu.RUnlock()
@@ -297,6 +326,9 @@ func (s *Service) restoreWatchState() error {
 
 			logger := GetLogger(task.ID)
 			opts := s.getTaskOptions(task)
+			opts.OnBatch = watchBatchRecorder(task.ID, opts.Name)
+			opts.OnScan = watchScanRecorder(task.ID, opts.Name)
+			opts.Shared = globalLimiter
 
 			s.wMu.Lock()
 			if _, ok := s.watchers[task.ID]; ok {
@@ -359,6 +391,7 @@ func (s *Service) SyncConfigToTasks(configID int, configName string, configDetai
 			s.tasks[i].OpenCache = rc.OpenCache
 			s.tasks[i].MkdirIfSingle = rc.MkdirIfSingle
 			s.tasks[i].DeleteDir = rc.DeleteDir
+			s.tasks[i].AdvancedOptions = rc.AdvancedOptions
 			updated = true
 		}
 	}
@@ -0,0 +1,72 @@
+package task
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fasaxi-linker/servergo/internal/logs"
+	"github.com/fasaxi-linker/servergo/pkg/core"
+)
+
+// PlanFile returns where the latest plan of a task is saved for download
+func PlanFile(taskID int) string {
+	return filepath.Join(logs.TaskDir(taskID), "plans", "latest.jsonl")
+}
+
+// BuildPlan computes what running the task would do without touching the
+// filesystem, and saves the full action list as JSON Lines for download.
+// With repair set it plans a repair run, see core.Options.Repair.
+func (s *Service) BuildPlan(ctx context.Context, taskID int, repair bool) (*core.Plan, error) {
+	opts, err := s.GetOptions(taskID)
+	if err != nil {
+		return nil, err
+	}
+	opts.Repair = repair
+
+	plan, err := core.BuildPlan(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := savePlan(PlanFile(taskID), plan); err != nil {
+		return nil, fmt.Errorf("failed to save plan: %w", err)
+	}
+	return plan, nil
+}
+
+func savePlan(path string, plan *core.Plan) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temp file first so a concurrent download never sees a partial
+	// plan; each save has its own, so concurrent saves do not write into one file
+	f, err := os.CreateTemp(filepath.Dir(path), "plan-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	w := bufio.NewWriter(f)
+	if err := plan.WriteJSONL(w); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
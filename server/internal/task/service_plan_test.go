@@ -0,0 +1,58 @@
+package task
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/fasaxi-linker/servergo/pkg/core"
+)
+
+func TestSavePlanConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plans", "latest.jsonl")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			plan := &core.Plan{Type: TypeMain}
+			for j := range 100 {
+				plan.Actions = append(plan.Actions, core.PlanAction{Action: core.ActionLink, Source: fmt.Sprintf("/src/%d-%d.mkv", i, j)})
+			}
+			errs <- savePlan(path, plan)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// One complete plan is left, without temp files next to it
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := 0
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		lines++
+	}
+	if lines != 100 {
+		t.Errorf("plan has %d lines, want one whole plan", lines)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("files left in the plan directory: %v", entries)
+	}
+}
@@ -0,0 +1,86 @@
+package task
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fasaxi-linker/servergo/internal/runs"
+)
+
+// loadSchedules registers every scheduled task with the scheduler
+func (s *Service) loadSchedules() {
+	for _, t := range s.GetAll() {
+		if t.ScheduleType == "" {
+			continue
+		}
+		s.reschedule(t)
+		if next, ok := s.scheduler.Next(t.ID); ok {
+			fmt.Printf("⏰ [Schedule] 已加载定时任务: %s (下次执行: %s)\n", t.Name, next.Format("2006-01-02 15:04:05"))
+		}
+	}
+}
+
+// reschedule applies a task's current schedule definition to the scheduler
+func (s *Service) reschedule(t Task) {
+	if s.scheduler == nil {
+		return
+	}
+	if err := s.scheduler.Set(t); err != nil {
+		fmt.Printf("⚠️ [Schedule] 定时配置无效 %s: %v\n", t.Name, err)
+	}
+}
+
+// runScheduled is invoked by the scheduler when a task is due
+func (s *Service) runScheduled(taskID int) {
+	t, ok := s.Get(taskID)
+	if !ok {
+		s.scheduler.Remove(taskID)
+		return
+	}
+
+	if IsRunning(taskID) || IsQueued(taskID) {
+		fmt.Printf("⏭️ [Schedule] 上次执行尚未结束，跳过本次触发: %s\n", t.Name)
+		return
+	}
+
+	opts, err := s.GetOptions(taskID)
+	if err != nil {
+		fmt.Printf("❌ [Schedule] 获取任务配置失败 %s: %v\n", t.Name, err)
+		return
+	}
+
+	trigger := runs.TriggerCron
+	if t.ScheduleType == ScheduleLoop {
+		trigger = runs.TriggerLoop
+	}
+	if err := StartRunWithTrigger(taskID, opts, trigger); err != nil {
+		fmt.Printf("❌ [Schedule] 启动任务失败 %s: %v\n", t.Name, err)
+	}
+}
+
+// SetSchedule updates the schedule of a task; an empty type cancels it
+func (s *Service) SetSchedule(taskID int, scheduleType, scheduleValue string) error {
+	if err := ValidateSchedule(scheduleType, scheduleValue); err != nil {
+		return err
+	}
+
+	t, ok := s.Get(taskID)
+	if !ok {
+		return fmt.Errorf("task %d not found", taskID)
+	}
+
+	t.ScheduleType = scheduleType
+	t.ScheduleValue = scheduleValue
+	if scheduleType == "" {
+		t.ScheduleValue = ""
+	}
+	return s.Update(taskID, t)
+}
+
+// NextRun returns the next scheduled fire time of a task
+func (s *Service) NextRun(taskID int) (time.Time, bool) {
+	if s.scheduler == nil {
+		return time.Time{}, false
+	}
+	return s.scheduler.Next(taskID)
+}
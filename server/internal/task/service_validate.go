@@ -0,0 +1,212 @@
+package task
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fasaxi-linker/servergo/pkg/core"
+)
+
+// Validation severities: errors block saving a task, warnings are only reported
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Validation issue codes
+const (
+	IssueSourceMissing   = "source-missing"
+	IssueDestMissing     = "dest-missing"
+	IssueCrossDevice     = "cross-device"
+	IssueDestNotWritable = "dest-not-writable"
+	IssueSamePath        = "same-path"
+	IssueDestInSource    = "dest-inside-source"
+	IssueSourceInDest    = "source-inside-dest"
+	IssueOverlap         = "overlap"
+	IssueInvalidSchedule = "invalid-schedule"
+	IssueInvalidOptions  = "invalid-options"
+)
+
+// ValidationIssue is one problem found in a task
+type ValidationIssue struct {
+	Severity      string `json:"severity"`
+	Code          string `json:"code"`
+	Source        string `json:"source,omitempty"`
+	Dest          string `json:"dest,omitempty"`
+	OtherTaskID   int    `json:"otherTaskId,omitempty"` // only for issues with another task
+	OtherTaskName string `json:"otherTaskName,omitempty"`
+	Message       string `json:"message"`
+}
+
+// ValidationResult lists the issues of a task; Valid is false if any is an error
+type ValidationResult struct {
+	Valid  bool              `json:"valid"`
+	Issues []ValidationIssue `json:"issues"`
+}
+
+// Errors returns the messages of the blocking issues
+func (r ValidationResult) Errors() []string {
+	var msgs []string
+	for _, issue := range r.Issues {
+		if issue.Severity == SeverityError {
+			msgs = append(msgs, issue.Message)
+		}
+	}
+	return msgs
+}
+
+func (r *ValidationResult) add(issue ValidationIssue) {
+	if issue.Severity == SeverityError {
+		r.Valid = false
+	}
+	r.Issues = append(r.Issues, issue)
+}
+
+// Validate checks a task before it is saved or run: every path mapping must point
+// at existing directories on one device with a writable destination that is not
+// inside its source, and mappings shared with other tasks are reported; a
+// destination overlapping another task's source, or the reverse, is an error.
+// t.ID identifies the task being edited and is 0 for a new one.
+func (s *Service) Validate(t Task) ValidationResult {
+	result := ValidationResult{Valid: true, Issues: []ValidationIssue{}}
+
+	if err := ValidateSchedule(t.ScheduleType, t.ScheduleValue); err != nil {
+		result.add(ValidationIssue{Severity: SeverityError, Code: IssueInvalidSchedule, Message: err.Error()})
+	}
+	if err := t.AdvancedOptions.Validate(); err != nil {
+		result.add(ValidationIssue{Severity: SeverityError, Code: IssueInvalidOptions, Message: err.Error()})
+	}
+	for _, list := range [][]string{t.Include, t.Exclude} {
+		if err := core.ValidatePatterns(list); err != nil {
+			result.add(ValidationIssue{Severity: SeverityError, Code: IssueInvalidOptions, Message: err.Error()})
+		}
+	}
+
+	for _, m := range t.PathsMapping {
+		validateMapping(t, m, &result)
+	}
+
+	for _, other := range s.GetAll() {
+		if other.ID == t.ID {
+			continue
+		}
+		for _, m := range t.PathsMapping {
+			for _, om := range other.PathsMapping {
+				validateAgainst(m, other, om, &result)
+			}
+		}
+	}
+
+	return result
+}
+
+// validateAgainst compares a mapping with a mapping of another task. Links
+// created in the other task's source are processed again by that task, and the
+// other task's links in this source by this one, so both are errors.
+func validateAgainst(m PathMapping, other Task, om PathMapping, result *ValidationResult) {
+	issue := func(severity, code, msg string) {
+		result.add(ValidationIssue{
+			Severity:      severity,
+			Code:          code,
+			Source:        m.Source,
+			Dest:          m.Dest,
+			OtherTaskID:   other.ID,
+			OtherTaskName: other.Name,
+			Message:       msg,
+		})
+	}
+
+	if pathsOverlap(m.Dest, om.Source) {
+		issue(SeverityError, IssueDestInSource, fmt.Sprintf("目标路径与任务「%s」的源路径 %s 重叠，链接结果会被再次处理: %s", other.Name, om.Source, m.Dest))
+	}
+	if pathsOverlap(m.Source, om.Dest) {
+		issue(SeverityError, IssueSourceInDest, fmt.Sprintf("源路径与任务「%s」的目标路径 %s 重叠，对方的链接结果会被再次处理: %s", other.Name, om.Dest, m.Source))
+	}
+	if pathsOverlap(m.Dest, om.Dest) {
+		issue(SeverityWarning, IssueOverlap, fmt.Sprintf("目标路径与任务「%s」的目标路径 %s 重叠，同步 (prune) 时可能删除对方创建的链接", other.Name, om.Dest))
+	}
+}
+
+// Filesystem checks of validateMapping, replaced in tests
+var (
+	checkWritable = dirWritable
+	deviceOf      = fileDevice
+)
+
+// validateMapping checks a single source/destination pair
+func validateMapping(t Task, m PathMapping, result *ValidationResult) {
+	issue := func(severity, code, msg string) {
+		result.add(ValidationIssue{Severity: severity, Code: code, Source: m.Source, Dest: m.Dest, Message: msg})
+	}
+
+	srcInfo, srcErr := os.Stat(m.Source)
+	if srcErr != nil {
+		issue(SeverityError, IssueSourceMissing, fmt.Sprintf("源路径不存在: %s", m.Source))
+	}
+	destInfo, destErr := os.Stat(m.Dest)
+	if destErr != nil {
+		issue(SeverityError, IssueDestMissing, fmt.Sprintf("目标路径不存在: %s", m.Dest))
+	}
+
+	switch {
+	case pathsEqual(m.Source, m.Dest):
+		issue(SeverityError, IssueSamePath, fmt.Sprintf("源路径与目标路径相同: %s", m.Source))
+	case isWithin(m.Dest, m.Source):
+		issue(SeverityError, IssueDestInSource, fmt.Sprintf("目标路径位于源路径内，链接结果会被再次处理: %s", m.Dest))
+	case isWithin(m.Source, m.Dest):
+		issue(SeverityWarning, IssueSourceInDest, fmt.Sprintf("源路径位于目标路径内: %s", m.Source))
+	}
+
+	if destErr != nil {
+		return
+	}
+
+	if err := checkWritable(m.Dest); err != nil {
+		issue(SeverityError, IssueDestNotWritable, fmt.Sprintf("目标路径不可写: %s (%v)", m.Dest, err))
+	}
+
+	if srcErr != nil {
+		return
+	}
+	srcDev, ok1 := deviceOf(srcInfo)
+	destDev, ok2 := deviceOf(destInfo)
+	if ok1 && ok2 && srcDev != destDev {
+		// A fallback strategy still gets the files across, just not as hard links
+		if t.LinkStrategy != "" && t.LinkStrategy != core.StrategyHardlink {
+			issue(SeverityWarning, IssueCrossDevice, fmt.Sprintf("源路径与目标路径不在同一设备，将使用 %s 代替硬链接: %s → %s", t.LinkStrategy, m.Source, m.Dest))
+		} else {
+			issue(SeverityError, IssueCrossDevice, fmt.Sprintf("源路径与目标路径不在同一设备，无法创建硬链接: %s → %s", m.Source, m.Dest))
+		}
+	}
+}
+
+// cleanPath resolves symlinks where possible so that aliases of a directory compare equal
+func cleanPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(p); err == nil {
+		p = resolved
+	}
+	return filepath.Clean(p)
+}
+
+func pathsEqual(a, b string) bool {
+	return cleanPath(a) == cleanPath(b)
+}
+
+// isWithin reports whether child is strictly below parent
+func isWithin(child, parent string) bool {
+	c, p := cleanPath(child), cleanPath(parent)
+	if c == p {
+		return false
+	}
+	return strings.HasPrefix(c, strings.TrimSuffix(p, string(os.PathSeparator))+string(os.PathSeparator))
+}
+
+// pathsOverlap reports whether a and b are the same directory or one contains the other
+func pathsOverlap(a, b string) bool {
+	return pathsEqual(a, b) || isWithin(a, b) || isWithin(b, a)
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package task
+
+import "os"
+
+// dirWritable is only implemented on Unix; elsewhere linking reports the error
+func dirWritable(dir string) error {
+	return nil
+}
+
+// fileDevice is only implemented on Unix, so the cross-device check is skipped
+func fileDevice(info os.FileInfo) (device uint64, ok bool) {
+	return 0, false
+}
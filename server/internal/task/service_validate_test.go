@@ -0,0 +1,120 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fasaxi-linker/servergo/pkg/core"
+)
+
+func TestValidateAgainstOtherTasks(t *testing.T) {
+	base := t.TempDir()
+	dir := func(name string) string {
+		p := filepath.Join(base, name)
+		if err := os.MkdirAll(p, 0755); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	downloads, media, backup := dir("downloads"), dir("media"), dir("backup")
+	s := &Service{tasks: []Task{{ID: 1, Name: "other", PathsMapping: []PathMapping{{Source: media, Dest: backup}}}}}
+
+	cases := []struct {
+		name     string
+		mapping  PathMapping
+		code     string
+		severity string
+	}{
+		{"dest inside other source", PathMapping{Source: downloads, Dest: dir("media/links")}, IssueDestInSource, SeverityError},
+		{"source is other dest", PathMapping{Source: backup, Dest: downloads}, IssueSourceInDest, SeverityError},
+		{"shared dest", PathMapping{Source: downloads, Dest: backup}, IssueOverlap, SeverityWarning},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result := s.Validate(Task{ID: 2, PathsMapping: []PathMapping{c.mapping}})
+			for _, issue := range result.Issues {
+				if issue.Code == c.code && issue.OtherTaskID == 1 {
+					if issue.Severity != c.severity {
+						t.Fatalf("%s: severity %s, want %s", c.code, issue.Severity, c.severity)
+					}
+					return
+				}
+			}
+			t.Fatalf("no %s issue with task 1 in %+v", c.code, result.Issues)
+		})
+	}
+}
+
+func TestValidateMapping(t *testing.T) {
+	base := t.TempDir()
+	dir := func(name string) string {
+		p := filepath.Join(base, name)
+		if err := os.MkdirAll(p, 0755); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	src, dest, other, readOnly := dir("src"), dir("dest"), dir("other"), dir("readonly")
+
+	// "other" is on a device of its own and "readonly" cannot be written to
+	deviceOf = func(info os.FileInfo) (uint64, bool) {
+		if info.Name() == "other" {
+			return 2, true
+		}
+		return 1, true
+	}
+	checkWritable = func(dir string) error {
+		if dir == readOnly {
+			return os.ErrPermission
+		}
+		return nil
+	}
+	t.Cleanup(func() {
+		deviceOf = fileDevice
+		checkWritable = dirWritable
+	})
+
+	cases := []struct {
+		name     string
+		mapping  PathMapping
+		strategy string
+		code     string // "" when the mapping has no issues
+		severity string
+	}{
+		{"valid", PathMapping{Source: src, Dest: dest}, "", "", ""},
+		{"same path", PathMapping{Source: src, Dest: src}, "", IssueSamePath, SeverityError},
+		{"dest inside source", PathMapping{Source: src, Dest: dir("src/links")}, "", IssueDestInSource, SeverityError},
+		{"source inside dest", PathMapping{Source: dir("dest/in"), Dest: dest}, "", IssueSourceInDest, SeverityWarning},
+		{"source missing", PathMapping{Source: filepath.Join(base, "gone"), Dest: dest}, "", IssueSourceMissing, SeverityError},
+		{"dest missing", PathMapping{Source: src, Dest: filepath.Join(base, "gone")}, "", IssueDestMissing, SeverityError},
+		{"dest not writable", PathMapping{Source: src, Dest: readOnly}, "", IssueDestNotWritable, SeverityError},
+		{"cross device", PathMapping{Source: src, Dest: other}, "", IssueCrossDevice, SeverityError},
+		{"cross device with hardlink", PathMapping{Source: src, Dest: other}, core.StrategyHardlink, IssueCrossDevice, SeverityError},
+		{"cross device with fallback", PathMapping{Source: src, Dest: other}, core.StrategyCopy, IssueCrossDevice, SeverityWarning},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := &Service{}
+			result := s.Validate(Task{PathsMapping: []PathMapping{c.mapping}, AdvancedOptions: AdvancedOptions{LinkStrategy: c.strategy}})
+			if c.code == "" {
+				if len(result.Issues) != 0 || !result.Valid {
+					t.Fatalf("unexpected issues: %+v", result.Issues)
+				}
+				return
+			}
+			for _, issue := range result.Issues {
+				if issue.Code == c.code {
+					if issue.Severity != c.severity {
+						t.Fatalf("%s: severity %s, want %s", c.code, issue.Severity, c.severity)
+					}
+					if want := c.severity != SeverityError; result.Valid != want {
+						t.Fatalf("valid = %v, want %v", result.Valid, want)
+					}
+					return
+				}
+			}
+			t.Fatalf("no %s issue in %+v", c.code, result.Issues)
+		})
+	}
+}
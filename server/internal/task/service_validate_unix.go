@@ -0,0 +1,24 @@
+//go:build unix
+
+package task
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// dirWritable reports whether the current user may create files in dir
+func dirWritable(dir string) error {
+	return unix.Access(dir, unix.W_OK)
+}
+
+// fileDevice returns the device a file lives on; ok is false if unknown
+func fileDevice(info os.FileInfo) (device uint64, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(stat.Dev), true
+}
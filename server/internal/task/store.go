@@ -73,7 +73,8 @@ func (s *Store) loadTasks(ctx context.Context) ([]Task, error) {
 	query := `
 		SELECT id, name, type, paths_mapping, include_patterns, exclude_patterns,
 		       save_mode, open_cache, mkdir_if_single, delete_dir, keep_dir_struct,
-		       schedule_type, schedule_value, reverse, config, config_id, is_watching, watch_error
+		       schedule_type, schedule_value, reverse, config, config_id, is_watching, watch_error,
+		       advanced_options, priority
 		FROM tasks
 		ORDER BY id
 	`
@@ -87,12 +88,13 @@ func (s *Store) loadTasks(ctx context.Context) ([]Task, error) {
 	var tasks []Task
 	for rows.Next() {
 		var t Task
-		var pathsMappingJSON, includeJSON, excludeJSON []byte
+		var pathsMappingJSON, includeJSON, excludeJSON, advancedJSON []byte
 
 		err := rows.Scan(
 			&t.ID, &t.Name, &t.Type, &pathsMappingJSON, &includeJSON, &excludeJSON,
 			&t.SaveMode, &t.OpenCache, &t.MkdirIfSingle, &t.DeleteDir, &t.KeepDirStruct,
 			&t.ScheduleType, &t.ScheduleValue, &t.Reverse, &t.Config, &t.ConfigID, &t.IsWatching, &t.WatchError,
+			&advancedJSON, &t.Priority,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan task row: %w", err)
@@ -110,6 +112,10 @@ func (s *Store) loadTasks(ctx context.Context) ([]Task, error) {
 			return nil, fmt.Errorf("failed to unmarshal exclude_patterns: %w", err)
 		}
 
+		if err := json.Unmarshal(advancedJSON, &t.AdvancedOptions); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal advanced_options: %w", err)
+		}
+
 		tasks = append(tasks, t)
 	}
 
@@ -273,19 +279,25 @@ func (s *Store) insertTask(ctx context.Context, tx pgx.Tx, t Task, configID int,
 		return fmt.Errorf("failed to marshal exclude: %w", err)
 	}
 
+	advancedJSON, err := json.Marshal(t.AdvancedOptions)
+	if err != nil {
+		return fmt.Errorf("failed to marshal advanced_options: %w", err)
+	}
+
 	query := `
 		INSERT INTO tasks (
 			name, type, paths_mapping, include_patterns, exclude_patterns,
 			save_mode, open_cache, mkdir_if_single, delete_dir, keep_dir_struct,
 			schedule_type, schedule_value, reverse, config, config_id, is_watching, watch_error,
-			updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, CURRENT_TIMESTAMP)
+			advanced_options, priority, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, CURRENT_TIMESTAMP)
 	`
 
 	_, err = tx.Exec(ctx, query,
 		t.Name, t.Type, pathsMappingJSON, includeJSON, excludeJSON,
 		t.SaveMode, t.OpenCache, t.MkdirIfSingle, t.DeleteDir, t.KeepDirStruct,
 		t.ScheduleType, t.ScheduleValue, t.Reverse, configName, configID, t.IsWatching, t.WatchError,
+		advancedJSON, t.Priority,
 	)
 
 	return err
@@ -338,13 +350,18 @@ func (s *Store) AddTask(t Task) (int, error) {
 		return 0, fmt.Errorf("failed to marshal exclude: %w", err)
 	}
 
+	advancedJSON, err := json.Marshal(t.AdvancedOptions)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal advanced_options: %w", err)
+	}
+
 	query := `
 		INSERT INTO tasks (
 			name, type, paths_mapping, include_patterns, exclude_patterns,
 			save_mode, open_cache, mkdir_if_single, delete_dir, keep_dir_struct,
 			schedule_type, schedule_value, reverse, config, config_id, is_watching, watch_error,
-			updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, CURRENT_TIMESTAMP)
+			advanced_options, priority, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, CURRENT_TIMESTAMP)
 		RETURNING id
 	`
 
@@ -353,6 +370,7 @@ func (s *Store) AddTask(t Task) (int, error) {
 		t.Name, t.Type, pathsMappingJSON, includeJSON, excludeJSON,
 		t.SaveMode, t.OpenCache, t.MkdirIfSingle, t.DeleteDir, t.KeepDirStruct,
 		t.ScheduleType, t.ScheduleValue, t.Reverse, t.Config, t.ConfigID, t.IsWatching, t.WatchError,
+		advancedJSON, t.Priority,
 	).Scan(&id)
 
 	if err != nil {
@@ -390,20 +408,25 @@ func (s *Store) UpdateTask(t Task) error {
 		return fmt.Errorf("failed to marshal exclude: %w", err)
 	}
 
+	advancedJSON, err := json.Marshal(t.AdvancedOptions)
+	if err != nil {
+		return fmt.Errorf("failed to marshal advanced_options: %w", err)
+	}
+
 	query := `
 		UPDATE tasks SET
 			name = $1, type = $2, paths_mapping = $3, include_patterns = $4, exclude_patterns = $5,
 			save_mode = $6, open_cache = $7, mkdir_if_single = $8, delete_dir = $9, keep_dir_struct = $10,
 			schedule_type = $11, schedule_value = $12, reverse = $13, config = $14, config_id = $15,
-			is_watching = $16, watch_error = $17, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $18
+			is_watching = $16, watch_error = $17, advanced_options = $18, priority = $19, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $20
 	`
 
 	result, err := pool.Exec(ctx, query,
 		t.Name, t.Type, pathsMappingJSON, includeJSON, excludeJSON,
 		t.SaveMode, t.OpenCache, t.MkdirIfSingle, t.DeleteDir, t.KeepDirStruct,
 		t.ScheduleType, t.ScheduleValue, t.Reverse, t.Config, t.ConfigID,
-		t.IsWatching, t.WatchError, t.ID,
+		t.IsWatching, t.WatchError, advancedJSON, t.Priority, t.ID,
 	)
 
 	if err != nil {
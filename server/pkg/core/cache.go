@@ -1,9 +1,14 @@
 package core
 
 import (
+	"os"
+
 	"github.com/fasaxi-linker/servergo/internal/cache"
 )
 
+// FileMeta is the cached metadata of a source file
+type FileMeta = cache.FileMeta
+
 // Cache manages the list of processed files to avoid duplicates
 // Now uses PostgreSQL instead of file storage
 type Cache struct {
@@ -58,3 +63,156 @@ func (c *Cache) Add(newFiles []string) error {
 func (c *Cache) Has(file string) (bool, error) {
 	return c.store.Has(c.taskID, file)
 }
+
+// HasMany checks a batch of files with one query and returns the cached ones
+func (c *Cache) HasMany(files []string) (map[string]bool, error) {
+	return c.store.HasMany(c.taskID, files)
+}
+
+// EachPath calls fn for every file cached for this task
+func (c *Cache) EachPath(fn func(file string)) error {
+	return c.store.EachPath(c.taskID, fn)
+}
+
+// AddMeta adds files together with their size, mtime, inode and content hash
+func (c *Cache) AddMeta(metas []FileMeta) error {
+	return c.store.AddMeta(c.taskID, metas)
+}
+
+// Remove removes files from the cache for this task
+func (c *Cache) Remove(files []string) error {
+	return c.store.Remove(c.taskID, files)
+}
+
+// GetMeta returns the metadata recorded when file was last linked, or nil if it is not cached
+func (c *Cache) GetMeta(file string) (*FileMeta, error) {
+	return c.store.GetMeta(c.taskID, file)
+}
+
+// GetMetaMany returns the metadata of a batch of files with one query, keyed by path
+func (c *Cache) GetMetaMany(files []string) (map[string]*FileMeta, error) {
+	return c.store.GetMetaMany(c.taskID, files)
+}
+
+// FindUnder returns cached files located below dir
+func (c *Cache) FindUnder(dir string) ([]string, error) {
+	return c.store.FindByPrefix(c.taskID, dir)
+}
+
+// FindMoved returns a cached path whose file no longer exists but which has the
+// same identity as meta: the same device/inode, or the same content hash and size
+// when meta carries a hash. sameInode reports which of the two matched.
+func (c *Cache) FindMoved(meta FileMeta) (oldPath string, sameInode bool, found bool, err error) {
+	if meta.Inode != 0 {
+		paths, err := c.store.FindByInode(c.taskID, meta.Device, meta.Inode)
+		if err != nil {
+			return "", false, false, err
+		}
+		if p, ok := firstMissing(paths, meta.Path); ok {
+			return p, true, true, nil
+		}
+	}
+	if meta.Hash != "" {
+		paths, err := c.store.FindByHash(c.taskID, meta.Hash, meta.Size)
+		if err != nil {
+			return "", false, false, err
+		}
+		if p, ok := firstMissing(paths, meta.Path); ok {
+			return p, false, true, nil
+		}
+	}
+	return "", false, false, nil
+}
+
+// cacheLookup holds the cache entries fetched for one file by Prefetch
+type cacheLookup struct {
+	prev    *FileMeta // entry of the file itself, fetched in repair mode only
+	key     cache.InodeKey
+	size    int64
+	byInode []string   // paths cached with the file's device/inode
+	bySize  []FileMeta // hashed entries with the file's size
+}
+
+// Prefetch fetches what FindMoved, and GetMeta in repair mode, would look up
+// for each file with one query per kind for the whole batch. Files that cannot
+// be read are missing from the result.
+func (c *Cache) Prefetch(files []string, repair, withHash bool) (map[string]*cacheLookup, error) {
+	lookups := make(map[string]*cacheLookup, len(files))
+	var keys []cache.InodeKey
+	var sizes []int64
+	seenSize := make(map[int64]bool)
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		l := &cacheLookup{size: info.Size()}
+		l.key.Device, l.key.Inode = inodeOf(info)
+		if l.key.Inode != 0 {
+			keys = append(keys, l.key)
+		}
+		if withHash && !seenSize[l.size] {
+			seenSize[l.size] = true
+			sizes = append(sizes, l.size)
+		}
+		lookups[f] = l
+	}
+
+	byInode, err := c.store.FindByInodes(c.taskID, keys)
+	if err != nil {
+		return nil, err
+	}
+	var bySize map[int64][]FileMeta
+	if withHash {
+		if bySize, err = c.store.FindHashedBySizes(c.taskID, sizes); err != nil {
+			return nil, err
+		}
+	}
+	var prevs map[string]*FileMeta
+	if repair {
+		if prevs, err = c.store.GetMetaMany(c.taskID, files); err != nil {
+			return nil, err
+		}
+	}
+	for f, l := range lookups {
+		l.byInode = byInode[l.key]
+		l.bySize = bySize[l.size]
+		l.prev = prevs[f]
+	}
+	return lookups, nil
+}
+
+// findMoved is FindMoved answered from the prefetched entries. An identity
+// that changed since the prefetch is not looked up again.
+func (l *cacheLookup) findMoved(meta FileMeta) (oldPath string, sameInode bool, found bool) {
+	if meta.Inode != 0 && meta.Device == l.key.Device && meta.Inode == l.key.Inode {
+		if p, ok := firstMissing(l.byInode, meta.Path); ok {
+			return p, true, true
+		}
+	}
+	if meta.Hash != "" {
+		var paths []string
+		for _, m := range l.bySize {
+			if m.Hash == meta.Hash && m.Size == meta.Size {
+				paths = append(paths, m.Path)
+			}
+		}
+		if p, ok := firstMissing(paths, meta.Path); ok {
+			return p, false, true
+		}
+	}
+	return "", false, false
+}
+
+// firstMissing returns the first path other than self that no longer exists on disk
+func firstMissing(paths []string, self string) (string, bool) {
+	for _, p := range paths {
+		if p == self {
+			continue
+		}
+		if _, err := os.Lstat(p); os.IsNotExist(err) {
+			return p, true
+		}
+	}
+	return "", false
+}
@@ -1,53 +1,99 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"syscall"
+	"strings"
 )
 
 // FileInfo holds path and inode
 type FileInfo struct {
 	Path  string
 	Inode uint64
+	Size  int64
+	Nlink uint64
 }
 
 // GetInodes scans directories and returns map of inodes
-func GetInodes(paths []string) (map[uint64]bool, error) {
+func GetInodes(ctx context.Context, paths []string) (map[uint64]bool, error) {
+	mapping := make(map[string][]string, len(paths))
+	for _, p := range paths {
+		mapping[p] = nil
+	}
+	inodes, _, err := scanSources(ctx, mapping, Options{})
+	return inodes, err
+}
+
+// scanSources returns the inodes of the files below the sources of mapping,
+// and the size of each file keyed by every target DestPath gives it. A copied
+// or cloned destination file (see LinkWith) shares only its path and size with
+// its source.
+//
+// A source that is missing or cannot be walked completely is an error rather
+// than an empty source: pruning against a partial set would take every link
+// of an unmounted or unreadable source for an orphan.
+func scanSources(ctx context.Context, mapping map[string][]string, opts Options) (map[uint64]bool, map[string]int64, error) {
 	inodes := make(map[uint64]bool)
-	for _, root := range paths {
-		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+	targets := make(map[string]int64)
+	for root, dests := range mapping {
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, nil, fmt.Errorf("source unavailable: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, nil, fmt.Errorf("source %s is not a directory", root)
+		}
+
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
 			if err != nil {
-				return err // or ignore?
+				return err
 			}
 			if !d.IsDir() {
 				info, err := d.Info()
 				if err != nil {
-					return nil
+					// Removed since it was listed: its links are orphans indeed
+					if os.IsNotExist(err) {
+						return nil
+					}
+					return err
+				}
+				if _, inode := inodeOf(info); inode != 0 {
+					inodes[inode] = true
 				}
-				stat, ok := info.Sys().(*syscall.Stat_t)
-				if ok {
-					inodes[stat.Ino] = true
+				for _, dest := range dests {
+					if target, err := DestPath(path, root, dest, opts); err == nil {
+						targets[target] = info.Size()
+					}
 				}
 			}
 			return nil
 		})
-		if err != nil && !os.IsNotExist(err) {
-			// Log error but continue?
-			fmt.Printf("Error scanning %s: %v\n", root, err)
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("scan source %s: %w", root, err)
 		}
 	}
-	return inodes, nil
+	return inodes, targets, nil
 }
 
 // ScanFiles returns all files in directories with metadata
-func ScanFiles(paths []string) ([]FileInfo, error) {
+func ScanFiles(ctx context.Context, paths []string) ([]FileInfo, error) {
 	var files []FileInfo
 	for _, root := range paths {
 		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			// An unreadable or missing destination entry is never pruned
 			if err != nil {
 				return nil
 			}
@@ -56,31 +102,37 @@ func ScanFiles(paths []string) ([]FileInfo, error) {
 				if err != nil {
 					return nil
 				}
-				stat, ok := info.Sys().(*syscall.Stat_t)
-				if ok {
+				// A symlink counts as the file it points to; a dangling one keeps its own inode
+				if info.Mode()&os.ModeSymlink != 0 {
+					if target, err := os.Stat(path); err == nil {
+						info = target
+					}
+				}
+				if _, inode := inodeOf(info); inode != 0 {
 					files = append(files, FileInfo{
 						Path:  path,
-						Inode: stat.Ino,
+						Inode: inode,
+						Size:  info.Size(),
+						Nlink: linkCount(info),
 					})
 				}
 			}
 			return nil
 		})
-		if err != nil && !os.IsNotExist(err) {
-			fmt.Printf("Error scanning %s: %v\n", root, err)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("scan %s: %w", root, err)
 		}
 	}
 	return files, nil
 }
 
 // GetPruneFiles identifies files to be deleted
-func GetPruneFiles(opts Options) ([]string, error) {
-	// Source paths = keys of PathsMapping
-	var sourcePaths []string
-	for k := range opts.PathsMapping {
-		sourcePaths = append(sourcePaths, k)
-	}
-	
+func GetPruneFiles(ctx context.Context, opts Options) ([]string, error) {
+	opts.largest = newLargestFiles()
+
 	// Dest paths = values of PathsMapping
 	var destPaths []string
 	for _, v := range opts.PathsMapping {
@@ -88,13 +140,13 @@ func GetPruneFiles(opts Options) ([]string, error) {
 	}
 
 	// 1. Get Source Inodes
-	sourceInodes, err := GetInodes(sourcePaths)
+	sourceInodes, sourceTargets, err := scanSources(ctx, opts.PathsMapping, opts)
 	if err != nil {
 		return nil, err
 	}
 
 	// 2. Scan Dest Files
-	destFiles, err := ScanFiles(destPaths)
+	destFiles, err := ScanFiles(ctx, destPaths)
 	if err != nil {
 		return nil, err
 	}
@@ -115,8 +167,14 @@ func GetPruneFiles(opts Options) ([]string, error) {
 		// If it is Orphan but "Excluded" (e.g. .DS_Store), we leave it alone.
 		
 		isOrphan := !sourceInodes[f.Inode]
+
+		// Copies and clones made across filesystems never share an inode with their
+		// source; keep a single-link file where a source of the same size is placed
+		if size, ok := sourceTargets[f.Path]; ok && isOrphan && f.Nlink == 1 && size == f.Size {
+			isOrphan = false
+		}
 		if isOrphan {
-			if Supported(f.Path, opts.Include, opts.Exclude) {
+			if opts.matches(f.Path) {
 				toDelete = append(toDelete, f.Path)
 			}
 		}
@@ -152,10 +210,147 @@ func DeleteEmptyDirs(paths []string) error {
 	return nil // Placeholder. The "find" approach is robust.
 }
 
+// PruneEmptyDirs removes empty directories below each root (the roots themselves are kept)
 func PruneEmptyDirs(roots []string) error {
-    for _, root := range roots {
-        cmd := exec.Command("find", root, "-type", "d", "-empty", "-delete")
-        _ = cmd.Run() 
-    }
-    return nil
+	for _, root := range roots {
+		if _, err := removeEmptyDirs(root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeEmptyDirs deletes empty directories under root bottom-up and returns how many were removed
+func removeEmptyDirs(root string) (int, error) {
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && path != root {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	// WalkDir visits parents before children, so iterate in reverse
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries, err := os.ReadDir(dirs[i])
+		if err != nil || len(entries) > 0 {
+			continue
+		}
+		if err := os.Remove(dirs[i]); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// removeEmptyParents removes dir and its ancestors while they are empty, stopping at root
+func removeEmptyParents(dir, root string) {
+	root = filepath.Clean(root)
+	for d := filepath.Clean(dir); d != root && strings.HasPrefix(d, root+string(os.PathSeparator)); d = filepath.Dir(d) {
+		entries, err := os.ReadDir(d)
+		if err != nil || len(entries) > 0 {
+			return
+		}
+		if err := os.Remove(d); err != nil {
+			return
+		}
+	}
+}
+
+// Prune deletes destination files whose inode no longer exists in any source,
+// and removes emptied destination directories when DeleteDir is set.
+// Cancellation behaves like Run: partial stats are returned with Cancelled set.
+func Prune(ctx context.Context, opts Options, logger func(string, string)) (Stats, error) {
+	stats := Stats{
+		FailFiles: make(map[string][]string),
+	}
+
+	progress := newProgressTracker(opts.OnProgress)
+	defer progress.stop()
+
+	files, err := GetPruneFiles(ctx, opts)
+	if err != nil {
+		if ctx.Err() != nil {
+			stats.Cancelled = true
+		} else if logger != nil {
+			logger("ERROR", fmt.Sprintf("⛔ 已中止清理，未删除任何文件: %v", err))
+		}
+		return stats, err
+	}
+
+	if logger != nil {
+		logger("INFO", fmt.Sprintf("🔍 发现待清理文件: %d 个", len(files)))
+	}
+	progress.update(func(p *Progress) { p.Queued = len(files) })
+	progress.setPhase(PhasePruning)
+
+	for _, f := range files {
+		if ctx.Err() != nil {
+			stats.Cancelled = true
+			return stats, ctx.Err()
+		}
+
+		info, err := os.Lstat(f)
+		if err == nil {
+			err = os.Remove(f)
+		}
+		if err != nil {
+			recordFailure(&stats, err, f)
+			if logger != nil {
+				logger("ERROR", fmt.Sprintf("❌ 删除失败: %s (%v)", f, err))
+			}
+			progress.finish(f, func(p *Progress) { p.Failed++ })
+			continue
+		}
+
+		progress.finish(f, func(p *Progress) { p.Deleted++ })
+		stats.DeletedCount++
+		stats.SuccessCount++
+		// Removing one of several hard links frees no space
+		if linkCount(info) <= 1 {
+			stats.FreedBytes += info.Size()
+		}
+		if logger != nil {
+			logger("SUCCEED", fmt.Sprintf("🗑️ 已删除: %s", f))
+		}
+	}
+
+	if opts.DeleteDir && ctx.Err() == nil {
+		for _, dests := range opts.PathsMapping {
+			for _, dest := range dests {
+				n, err := removeEmptyDirs(dest)
+				if err != nil {
+					if logger != nil {
+						logger("ERROR", fmt.Sprintf("❌ 清理空目录失败: %s (%v)", dest, err))
+					}
+					continue
+				}
+				stats.RemovedDirs += n
+			}
+		}
+		if logger != nil && stats.RemovedDirs > 0 {
+			logger("INFO", fmt.Sprintf("📁 已删除空目录: %d 个", stats.RemovedDirs))
+		}
+	}
+
+	return stats, nil
+}
+
+// recordFailure groups a failed path under the underlying error reason
+// (e.g. "permission denied") rather than the full message that embeds the path
+func recordFailure(stats *Stats, err error, path string) {
+	reason := err.Error()
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		reason = pathErr.Err.Error()
+	}
+	stats.FailFiles[reason] = append(stats.FailFiles[reason], path)
+	stats.FailCount++
 }
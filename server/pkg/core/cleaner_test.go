@@ -0,0 +1,220 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestPruneFilesCopiesAtTheirTargets(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(src, "a.mkv"), "source")
+	if err := os.MkdirAll(filepath.Join(dest, "Movies"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A copy placed by the template, and an unrelated file sharing its source's name and size
+	copied := filepath.Join(dest, "Movies", "a-copy.mkv")
+	orphan := filepath.Join(dest, "a.mkv")
+	writeFile(t, copied, "source")
+	writeFile(t, orphan, "orphan")
+
+	opts := Options{
+		PathsMapping: map[string][]string{src: {dest}},
+		DestTemplate: "Movies/{name}-copy.{ext}",
+	}
+	files, err := GetPruneFiles(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != orphan {
+		t.Fatalf("prune files = %v, want only %s", files, orphan)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	cases := []struct {
+		name string
+		// setup fills src and dest and returns another directory outside both
+		// for files that must not count as sources
+		setup     func(t *testing.T, src, dest, other string)
+		deleteDir bool
+		noSource  bool
+
+		wantErr     bool
+		wantDeleted int
+		wantFreed   int64
+		wantDirs    int
+		wantGone    []string // relative to dest
+		wantKept    []string // relative to dest
+	}{
+		{
+			name: "orphan deleted, linked kept",
+			setup: func(t *testing.T, src, dest, other string) {
+				writeFile(t, filepath.Join(src, "a.mkv"), "linked")
+				link(t, filepath.Join(src, "a.mkv"), filepath.Join(dest, "a.mkv"))
+				writeFile(t, filepath.Join(dest, "b.mkv"), "orphan")
+			},
+			wantDeleted: 1,
+			wantFreed:   int64(len("orphan")),
+			wantGone:    []string{"b.mkv"},
+			wantKept:    []string{"a.mkv"},
+		},
+		{
+			name: "orphan with another link frees nothing",
+			setup: func(t *testing.T, src, dest, other string) {
+				writeFile(t, filepath.Join(other, "b.mkv"), "shared")
+				link(t, filepath.Join(other, "b.mkv"), filepath.Join(dest, "b.mkv"))
+			},
+			wantDeleted: 1,
+			wantFreed:   0,
+			wantGone:    []string{"b.mkv"},
+		},
+		{
+			name: "excluded orphan kept",
+			setup: func(t *testing.T, src, dest, other string) {
+				writeFile(t, filepath.Join(dest, "b.txt"), "orphan")
+			},
+			wantKept: []string{"b.txt"},
+		},
+		{
+			name: "emptied directories removed",
+			setup: func(t *testing.T, src, dest, other string) {
+				mkdir(t, filepath.Join(src, "keep"))
+				writeFile(t, filepath.Join(src, "keep", "a.mkv"), "linked")
+				mkdir(t, filepath.Join(dest, "keep"))
+				link(t, filepath.Join(src, "keep", "a.mkv"), filepath.Join(dest, "keep", "a.mkv"))
+				mkdir(t, filepath.Join(dest, "gone", "deeper"))
+				writeFile(t, filepath.Join(dest, "gone", "deeper", "b.mkv"), "orphan")
+			},
+			deleteDir:   true,
+			wantDeleted: 1,
+			wantFreed:   int64(len("orphan")),
+			wantDirs:    2,
+			wantGone:    []string{"gone"},
+			wantKept:    []string{"keep/a.mkv"},
+		},
+		{
+			name: "emptied directories kept without DeleteDir",
+			setup: func(t *testing.T, src, dest, other string) {
+				mkdir(t, filepath.Join(dest, "gone"))
+				writeFile(t, filepath.Join(dest, "gone", "b.mkv"), "orphan")
+			},
+			wantDeleted: 1,
+			wantFreed:   int64(len("orphan")),
+			wantGone:    []string{"gone/b.mkv"},
+			wantKept:    []string{"gone"},
+		},
+		{
+			name: "missing source deletes nothing",
+			setup: func(t *testing.T, src, dest, other string) {
+				writeFile(t, filepath.Join(dest, "a.mkv"), "linked")
+			},
+			noSource: true,
+			wantErr:  true,
+			wantKept: []string{"a.mkv"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			src, dest, other := t.TempDir(), t.TempDir(), t.TempDir()
+			tc.setup(t, src, dest, other)
+			if tc.noSource {
+				if err := os.RemoveAll(src); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			opts := Options{
+				PathsMapping: map[string][]string{src: {dest}},
+				Include:      []string{"**/*.mkv"},
+				DeleteDir:    tc.deleteDir,
+			}
+			var logged []string
+			stats, err := Prune(context.Background(), opts, func(level, msg string) {
+				if level == "ERROR" {
+					logged = append(logged, msg)
+				}
+			})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr && len(logged) == 0 {
+				t.Error("failure was not reported through the logger")
+			}
+			if stats.DeletedCount != tc.wantDeleted || stats.FreedBytes != tc.wantFreed || stats.RemovedDirs != tc.wantDirs {
+				t.Errorf("deleted %d, freed %d, dirs %d; want %d, %d, %d",
+					stats.DeletedCount, stats.FreedBytes, stats.RemovedDirs, tc.wantDeleted, tc.wantFreed, tc.wantDirs)
+			}
+			for _, p := range tc.wantGone {
+				if _, err := os.Lstat(filepath.Join(dest, p)); !os.IsNotExist(err) {
+					t.Errorf("%s still exists", p)
+				}
+			}
+			for _, p := range tc.wantKept {
+				if _, err := os.Lstat(filepath.Join(dest, p)); err != nil {
+					t.Errorf("%s was removed: %v", p, err)
+				}
+			}
+		})
+	}
+}
+
+func TestPruneFailuresGroupedByReason(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root ignores directory permissions")
+	}
+	src, dest := t.TempDir(), t.TempDir()
+	locked := filepath.Join(dest, "locked")
+	mkdir(t, locked)
+	writeFile(t, filepath.Join(locked, "a.mkv"), "orphan")
+	writeFile(t, filepath.Join(locked, "b.mkv"), "orphan")
+	if err := os.Chmod(locked, 0555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(locked, 0755) })
+
+	opts := Options{PathsMapping: map[string][]string{src: {dest}}}
+	stats, err := Prune(context.Background(), opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.FailCount != 2 || len(stats.FailFiles) != 1 || len(stats.FailFiles["permission denied"]) != 2 {
+		t.Fatalf("fail count %d, fail files %v; want both under permission denied", stats.FailCount, stats.FailFiles)
+	}
+}
+
+func TestRecordFailure(t *testing.T) {
+	stats := Stats{FailFiles: make(map[string][]string)}
+	recordFailure(&stats, &fs.PathError{Op: "remove", Path: "/d/a", Err: syscall.EACCES}, "/d/a")
+	recordFailure(&stats, &fs.PathError{Op: "lstat", Path: "/d/b", Err: syscall.EACCES}, "/d/b")
+	recordFailure(&stats, errors.New("boom"), "/d/c")
+
+	if stats.FailCount != 3 {
+		t.Errorf("fail count = %d, want 3", stats.FailCount)
+	}
+	if got := stats.FailFiles[syscall.EACCES.Error()]; len(got) != 2 {
+		t.Errorf("%q = %v, want both path errors", syscall.EACCES.Error(), got)
+	}
+	if got := stats.FailFiles["boom"]; len(got) != 1 {
+		t.Errorf("boom = %v, want the plain error", got)
+	}
+}
+
+func mkdir(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func link(t *testing.T, src, dest string) {
+	t.Helper()
+	if err := os.Link(src, dest); err != nil {
+		t.Fatal(err)
+	}
+}
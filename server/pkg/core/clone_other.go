@@ -0,0 +1,13 @@
+//go:build !linux
+
+package core
+
+import (
+	"errors"
+	"os"
+)
+
+// cloneFile is only implemented on Linux
+func cloneFile(dst, src *os.File) error {
+	return errors.New("reflink is not supported on this platform")
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Companions are files such as subtitles, .nfo files and artwork that belong to
+// a primary (video) file. They are linked next to the primary's target and
+// renamed along with it: for "Movie.2019.mkv" linked as "Movie (2019).mkv",
+// "Movie.2019.en.srt" becomes "Movie (2019).en.srt". Files without the
+// primary's stem, such as "poster.jpg", follow only a primary that is alone in
+// its directory and keep their name. Run links companions together with their
+// primary, so a companion is not linked when its primary is excluded by the
+// patterns, filters or minimum age, or ends up not linked itself.
+
+// isCompanion reports whether path matches the companion patterns
+func isCompanion(path string, opts Options) bool {
+	return len(opts.Companions) > 0 && SupportedWith(path, opts.Companions, opts.Exclude, opts.matchOptions())
+}
+
+// isPrimary reports whether path is a file companions can belong to
+func isPrimary(path string, opts Options) bool {
+	if isCompanion(path, opts) || !opts.matches(path) {
+		return false
+	}
+	return len(opts.CompanionPrimary) == 0 || SupportedWith(path, opts.CompanionPrimary, nil, opts.matchOptions())
+}
+
+// linkable reports whether the watcher should link path, whose info may be nil
+// if unknown
+func linkable(path string, info os.FileInfo, opts Options) bool {
+	return exclusion(path, info, opts) == ""
+}
+
+// exclusion returns why path is not linked, see Excluded*, or "" if it is. A
+// companion is linked when its primary is: the primary passes the patterns and
+// filters itself.
+func exclusion(path string, info os.FileInfo, opts Options) string {
+	if isCompanion(path, opts) {
+		primary := findPrimary(path, opts)
+		if primary == "" {
+			return ExcludedNoPrimary
+		}
+		primaryInfo, err := os.Stat(primary)
+		if err != nil || exclusion(primary, primaryInfo, opts) != "" {
+			return ExcludedNoPrimary
+		}
+		return ""
+	}
+	if !opts.matches(path) {
+		return ExcludedPattern
+	}
+	if !passesFilters(info, opts) {
+		return ExcludedFilter
+	}
+	return ""
+}
+
+// stem is a file name without its extension
+func stem(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// companionIndex pairs the companions of one directory with their primaries
+type companionIndex struct {
+	owner     map[string]string   // companion -> its primary, "" if it has none
+	byPrimary map[string][]string // primary -> its companions
+}
+
+// indexCompanions reads dir once and assigns each companion in it to its primary
+func indexCompanions(dir string, opts Options) companionIndex {
+	idx := companionIndex{owner: make(map[string]string), byPrimary: make(map[string][]string)}
+	if len(opts.Companions) == 0 {
+		return idx
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return idx
+	}
+	var primaries, companions []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		p := filepath.Join(dir, e.Name())
+		switch {
+		case isCompanion(p, opts):
+			companions = append(companions, p)
+		case isPrimary(p, opts):
+			primaries = append(primaries, p)
+		}
+	}
+	for _, c := range companions {
+		primary := ownerOf(c, primaries)
+		idx.owner[c] = primary
+		if primary != "" {
+			idx.byPrimary[primary] = append(idx.byPrimary[primary], c)
+		}
+	}
+	return idx
+}
+
+// ownerOf returns the primary a companion belongs to: the one with the longest
+// stem that the companion name starts with, or the only primary in the
+// directory. It returns "" if there is none.
+func ownerOf(companion string, primaries []string) string {
+	name := filepath.Base(companion)
+	best := ""
+	for _, p := range primaries {
+		s := stem(filepath.Base(p))
+		if strings.HasPrefix(name, s+".") && len(s) > len(stem(filepath.Base(best))) {
+			best = p
+		}
+	}
+	if best == "" && len(primaries) == 1 {
+		best = primaries[0]
+	}
+	return best
+}
+
+// findPrimary returns the primary a companion belongs to, or "" if there is none
+func findPrimary(companion string, opts Options) string {
+	return indexCompanions(filepath.Dir(companion), opts).owner[companion]
+}
+
+// companionsOf lists the companions that belong to primary
+func companionsOf(primary string, opts Options) []string {
+	return indexCompanions(filepath.Dir(primary), opts).byPrimary[primary]
+}
+
+// companionTarget places a companion next to primaryTarget, replacing the
+// primary's stem in its name with the stem of the target
+func companionTarget(companion, primary, primaryTarget string) string {
+	name := filepath.Base(companion)
+	oldStem := stem(filepath.Base(primary))
+	if strings.HasPrefix(name, oldStem+".") {
+		name = stem(filepath.Base(primaryTarget)) + strings.TrimPrefix(name, oldStem)
+	}
+	return filepath.Join(filepath.Dir(primaryTarget), name)
+}
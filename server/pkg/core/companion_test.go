@@ -0,0 +1,66 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunCompanionsFollowPrimary(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(src, "A.mkv"), string(make([]byte, 4096)))
+	writeFile(t, filepath.Join(src, "A.en.srt"), "subs")
+	writeFile(t, filepath.Join(src, "B.mkv"), "tiny")
+	writeFile(t, filepath.Join(src, "B.en.srt"), "subs")
+	writeFile(t, filepath.Join(dest, "A.mkv"), "someone else's file")
+
+	opts := Options{
+		PathsMapping:   map[string][]string{src: {dest}},
+		Include:        []string{"*.mkv"},
+		Companions:     []string{"*.srt"},
+		MinSize:        1024,
+		ConflictPolicy: ConflictRename,
+	}
+	if _, err := Run(context.Background(), opts, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The subtitle goes next to the renamed link of its primary
+	for _, name := range []string{"A (1).mkv", "A (1).en.srt"} {
+		if _, err := os.Stat(filepath.Join(dest, name)); err != nil {
+			t.Errorf("%s not linked: %v", name, err)
+		}
+	}
+	// Nothing follows a primary excluded by the size filter
+	for _, name := range []string{"A.en.srt", "B.mkv", "B.en.srt"} {
+		if _, err := os.Stat(filepath.Join(dest, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should not exist: %v", name, err)
+		}
+	}
+}
+
+func TestWatcherCompanionWaitsForPrimary(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	primary := filepath.Join(src, "Movie.mkv")
+	companion := filepath.Join(src, "Movie.en.srt")
+
+	w := newTestWatcher(t, src, dest, ConflictSkip)
+	w.options.Include = []string{"*.mkv"}
+	w.options.Companions = []string{"*.srt"}
+	stats := Stats{FailFiles: make(map[string][]string)}
+
+	writeFile(t, companion, "subs")
+	w.handleAdd(companion, &stats)
+	if _, err := os.Stat(filepath.Join(dest, "Movie.en.srt")); !os.IsNotExist(err) {
+		t.Fatalf("companion linked without its primary: %v", err)
+	}
+
+	writeFile(t, primary, "movie")
+	w.handleAdd(primary, &stats)
+	for _, name := range []string{"Movie.mkv", "Movie.en.srt"} {
+		if _, err := os.Stat(filepath.Join(dest, name)); err != nil {
+			t.Errorf("%s not linked: %v", name, err)
+		}
+	}
+}
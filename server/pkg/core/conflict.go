@@ -0,0 +1,267 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Conflict policies decide what happens when the destination file already exists
+// and is not the source file itself
+const (
+	ConflictSkip       = "skip"        // leave it and report the conflict (default)
+	ConflictOverwrite  = "overwrite"   // replace it with a link to the source
+	ConflictRename     = "rename"      // link the source next to it as "name (1).ext"
+	ConflictKeepLarger = "keep-larger" // overwrite only if the source is larger
+	ConflictKeepNewer  = "keep-newer"  // overwrite only if the source is newer
+)
+
+// ValidConflictPolicy reports whether p names a conflict policy; "" means skip
+func ValidConflictPolicy(p string) bool {
+	switch p {
+	case "", ConflictSkip, ConflictOverwrite, ConflictRename, ConflictKeepLarger, ConflictKeepNewer:
+		return true
+	}
+	return false
+}
+
+// Outcomes of linking one file into one destination
+const (
+	OutcomeLinked      = "linked"      // a new link was created
+	OutcomeExisting    = "existing"    // the destination already is the source file
+	OutcomeSkipped     = "skipped"     // a different file is in the way and was left alone
+	OutcomeOverwritten = "overwritten" // a different file was replaced
+	OutcomeRenamed     = "renamed"     // linked under a suffixed name next to a different file
+	OutcomeKept        = "kept"        // a larger or newer different file was kept
+	OutcomeRepaired    = "repaired"    // a link whose inode diverged from the source was replaced
+)
+
+// maxRenameSuffix bounds the "name (n).ext" candidates tried by ConflictRename
+const maxRenameSuffix = 100
+
+// linkResult describes how a source file ended up in one destination
+type linkResult struct {
+	Target  string
+	Method  string // how a new link was made, see Method*
+	Outcome string
+}
+
+// created reports whether a new link to the source now exists
+func (r linkResult) created() bool {
+	switch r.Outcome {
+	case OutcomeLinked, OutcomeOverwritten, OutcomeRenamed, OutcomeRepaired:
+		return true
+	}
+	return false
+}
+
+// settled reports whether the destination needs no further work, so that the
+// file can be cached; skipped conflicts are reported again on the next run
+func (r linkResult) settled() bool {
+	return r.Outcome != OutcomeSkipped
+}
+
+// linkFile links source to target like LinkAs and resolves an existing
+// destination file according to opts.ConflictPolicy, or opts.Repair. prev is the
+// cache entry of source from its last run, if any.
+func linkFile(source, target string, opts Options, prev *FileMeta) (linkResult, error) {
+	method, err := LinkAs(source, target, opts.LinkStrategy)
+	if err == nil {
+		return linkResult{Target: target, Method: method, Outcome: OutcomeLinked}, nil
+	}
+	if errors.Is(err, ErrAlreadyLinked) {
+		return linkResult{Target: target, Outcome: OutcomeExisting}, nil
+	}
+	if !errors.Is(err, ErrTargetExists) && !errors.Is(err, os.ErrExist) {
+		return linkResult{Target: target}, err
+	}
+
+	outcome, finalTarget, err := decideConflict(source, target, opts, prev)
+	if err != nil {
+		return linkResult{Target: target}, err
+	}
+	res := linkResult{Target: finalTarget, Outcome: outcome}
+
+	switch outcome {
+	case OutcomeOverwritten, OutcomeRepaired:
+		res.Method, err = replaceWithLink(source, target, opts.LinkStrategy)
+	case OutcomeRenamed:
+		res.Method, err = linkPath(source, finalTarget, opts.LinkStrategy)
+	}
+	return res, err
+}
+
+// decideConflict works out what the policy does with source and the existing
+// target without changing anything. For OutcomeRenamed it also returns the free
+// suffixed name; for OutcomeExisting the path that already is the source.
+func decideConflict(source, target string, opts Options, prev *FileMeta) (string, string, error) {
+	return decideConflictIn(source, target, opts, prev, os.Lstat)
+}
+
+// decideConflictIn is decideConflict looking up destination files with lstat,
+// so that a plan can see the links it has already planned
+func decideConflictIn(source, target string, opts Options, prev *FileMeta, lstat func(string) (os.FileInfo, error)) (string, string, error) {
+	srcInfo, err := os.Stat(source)
+	if err != nil {
+		return "", target, err
+	}
+	dstInfo, err := lstat(target)
+	if err != nil {
+		return "", target, err
+	}
+
+	if isSameFile(source, srcInfo, target, dstInfo) {
+		return OutcomeExisting, target, nil
+	}
+	// A directory in the way is never replaced
+	if dstInfo.IsDir() {
+		return OutcomeSkipped, target, nil
+	}
+
+	if opts.Repair && isDiverged(dstInfo, prev) {
+		return OutcomeRepaired, target, nil
+	}
+
+	switch opts.ConflictPolicy {
+	case ConflictOverwrite:
+		return OutcomeOverwritten, target, nil
+	case ConflictKeepLarger:
+		if srcInfo.Size() > dstInfo.Size() {
+			return OutcomeOverwritten, target, nil
+		}
+		return OutcomeKept, target, nil
+	case ConflictKeepNewer:
+		if srcInfo.ModTime().After(dstInfo.ModTime()) {
+			return OutcomeOverwritten, target, nil
+		}
+		return OutcomeKept, target, nil
+	case ConflictRename:
+		ext := filepath.Ext(target)
+		stem := strings.TrimSuffix(target, ext)
+		for i := 1; i <= maxRenameSuffix; i++ {
+			candidate := fmt.Sprintf("%s (%d)%s", stem, i, ext)
+			info, err := lstat(candidate)
+			if os.IsNotExist(err) {
+				return OutcomeRenamed, candidate, nil
+			}
+			// Linked under this name by an earlier run
+			if err == nil && isSameFile(source, srcInfo, candidate, info) {
+				return OutcomeExisting, candidate, nil
+			}
+		}
+		return "", target, fmt.Errorf("no free name for %s after %d attempts", target, maxRenameSuffix)
+	}
+	return OutcomeSkipped, target, nil
+}
+
+// isSameFile reports whether target already provides source: a hard link to it,
+// a symlink pointing at it, or, on another filesystem where only the fallback
+// strategies work, a file with identical content (a copy or clone)
+func isSameFile(source string, srcInfo os.FileInfo, target string, dstInfo os.FileInfo) bool {
+	if os.SameFile(srcInfo, dstInfo) {
+		return true
+	}
+	if dstInfo.Mode()&os.ModeSymlink != 0 {
+		resolved, err := os.Stat(target)
+		return err == nil && os.SameFile(srcInfo, resolved)
+	}
+	if !dstInfo.Mode().IsRegular() || dstInfo.Size() != srcInfo.Size() {
+		return false
+	}
+	// On the same device a different inode is a collision or a diverged link
+	if deviceOf(srcInfo) == deviceOf(dstInfo) {
+		return false
+	}
+	srcHash, err := hashFile(source)
+	if err != nil {
+		return false
+	}
+	dstHash, err := hashFile(target)
+	return err == nil && srcHash == dstHash
+}
+
+// isDiverged reports whether target is a stale link left behind after the
+// source was rewritten: it still has the inode the source had when it was
+// linked (prev, from the cache). Without a cache entry nothing tells a stale
+// link from an unrelated file, so the conflict policy decides.
+func isDiverged(dstInfo os.FileInfo, prev *FileMeta) bool {
+	if !dstInfo.Mode().IsRegular() || prev == nil || prev.Inode == 0 {
+		return false
+	}
+	device, inode := inodeOf(dstInfo)
+	return inode != 0 && device == prev.Device && inode == prev.Inode
+}
+
+// deviceOf returns the device a file lives on, or 0 if unknown
+func deviceOf(info os.FileInfo) uint64 {
+	device, _ := inodeOf(info)
+	return device
+}
+
+// replaceWithLink atomically replaces target with a link to source
+func replaceWithLink(source, target, strategy string) (string, error) {
+	tmp := filepath.Join(filepath.Dir(target), "."+filepath.Base(target)+".hlink-replace")
+	os.Remove(tmp) // left over from an interrupted run
+	method, err := linkPath(source, tmp, strategy)
+	if err != nil {
+		return method, err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return method, err
+	}
+	return method, nil
+}
+
+// logLink writes the outcome of linking one file
+func logLink(logger func(string, string), source string, r linkResult) {
+	if logger == nil {
+		return
+	}
+	switch r.Outcome {
+	case OutcomeLinked:
+		logger("SUCCEED", fmt.Sprintf("✅ %s成功: %s → %s", methodLabel(r.Method), source, r.Target))
+	case OutcomeExisting:
+		logger("INFO", fmt.Sprintf("⏭️ 已链接，跳过: %s → %s", source, r.Target))
+	case OutcomeSkipped:
+		logger("WARN", fmt.Sprintf("⚠️ 目标已存在不同文件，跳过: %s → %s", source, r.Target))
+	case OutcomeOverwritten:
+		logger("SUCCEED", fmt.Sprintf("♻️ 已覆盖目标文件: %s → %s", source, r.Target))
+	case OutcomeRenamed:
+		logger("SUCCEED", fmt.Sprintf("✅ 目标冲突，已改名链接: %s → %s", source, r.Target))
+	case OutcomeKept:
+		logger("INFO", fmt.Sprintf("📌 保留已有文件: %s (源文件: %s)", r.Target, source))
+	case OutcomeRepaired:
+		logger("SUCCEED", fmt.Sprintf("🔧 已修复链接（源文件已被替换）: %s → %s", source, r.Target))
+	}
+}
+
+// countLink adds the outcome of linking one file to stats. The caller counts
+// SuccessCount, whose unit differs between Run (files) and Watcher (links).
+func countLink(stats *Stats, source string, r linkResult) {
+	recordFallback(stats, r.Method, source, r.Target)
+
+	switch r.Outcome {
+	case OutcomeExisting:
+		stats.AlreadyLinked++
+		return
+	case OutcomeSkipped:
+		stats.ConflictSkipped++
+	case OutcomeOverwritten:
+		stats.ConflictOverwritten++
+	case OutcomeRenamed:
+		stats.ConflictRenamed++
+	case OutcomeKept:
+		stats.ConflictKept++
+	case OutcomeRepaired:
+		stats.Repaired++
+	default:
+		return
+	}
+	if stats.Conflicts == nil {
+		stats.Conflicts = make(map[string][]string)
+	}
+	stats.Conflicts[r.Outcome] = append(stats.Conflicts[r.Outcome], source+" -> "+r.Target)
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLinkFileConflictPolicies(t *testing.T) {
+	older := time.Now().Add(-time.Hour)
+	cases := []struct {
+		name   string
+		policy string
+		source string // content; the destination holds "existing"
+		// srcOlder dates the source before the destination file
+		srcOlder bool
+		// setup prepares further files next to the destination
+		setup func(t *testing.T, src, target string)
+
+		wantOutcome string
+		wantTarget  string // base name of the returned target
+		wantLinked  string // base name that must be the source afterwards, "" for none
+		wantErr     bool
+	}{
+		{name: "skip by default", policy: "", source: "new", wantOutcome: OutcomeSkipped, wantTarget: "a.mkv"},
+		{name: "skip", policy: ConflictSkip, source: "new", wantOutcome: OutcomeSkipped, wantTarget: "a.mkv"},
+		{name: "overwrite", policy: ConflictOverwrite, source: "new", wantOutcome: OutcomeOverwritten, wantTarget: "a.mkv", wantLinked: "a.mkv"},
+		{name: "keep-larger replaces smaller", policy: ConflictKeepLarger, source: "much larger source", wantOutcome: OutcomeOverwritten, wantTarget: "a.mkv", wantLinked: "a.mkv"},
+		{name: "keep-larger keeps larger", policy: ConflictKeepLarger, source: "tiny", wantOutcome: OutcomeKept, wantTarget: "a.mkv"},
+		{name: "keep-larger keeps equal", policy: ConflictKeepLarger, source: "12345678", wantOutcome: OutcomeKept, wantTarget: "a.mkv"},
+		{name: "keep-newer replaces older", policy: ConflictKeepNewer, source: "new", wantOutcome: OutcomeOverwritten, wantTarget: "a.mkv", wantLinked: "a.mkv"},
+		{name: "keep-newer keeps newer", policy: ConflictKeepNewer, source: "new", srcOlder: true, wantOutcome: OutcomeKept, wantTarget: "a.mkv"},
+		{name: "rename", policy: ConflictRename, source: "new", wantOutcome: OutcomeRenamed, wantTarget: "a (1).mkv", wantLinked: "a (1).mkv"},
+		{
+			name: "rename past taken names", policy: ConflictRename, source: "new",
+			setup: func(t *testing.T, src, target string) {
+				writeFile(t, filepath.Join(filepath.Dir(target), "a (1).mkv"), "other")
+			},
+			wantOutcome: OutcomeRenamed, wantTarget: "a (2).mkv", wantLinked: "a (2).mkv",
+		},
+		{
+			name: "rename finds an earlier link", policy: ConflictRename, source: "new",
+			setup: func(t *testing.T, src, target string) {
+				link(t, src, filepath.Join(filepath.Dir(target), "a (1).mkv"))
+			},
+			wantOutcome: OutcomeExisting, wantTarget: "a (1).mkv", wantLinked: "a (1).mkv",
+		},
+		{
+			name: "rename gives up after the limit", policy: ConflictRename, source: "new",
+			setup: func(t *testing.T, src, target string) {
+				for i := 1; i <= maxRenameSuffix; i++ {
+					writeFile(t, filepath.Join(filepath.Dir(target), fmt.Sprintf("a (%d).mkv", i)), "other")
+				}
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "src.mkv")
+			target := filepath.Join(dir, "dest", "a.mkv")
+			mkdir(t, filepath.Dir(target))
+			writeFile(t, src, tc.source)
+			writeFile(t, target, "existing")
+			if tc.srcOlder {
+				if err := os.Chtimes(src, older, older); err != nil {
+					t.Fatal(err)
+				}
+			} else if err := os.Chtimes(target, older, older); err != nil {
+				t.Fatal(err)
+			}
+			if tc.setup != nil {
+				tc.setup(t, src, target)
+			}
+
+			res, err := linkFile(src, target, Options{ConflictPolicy: tc.policy}, nil)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && (res.Outcome != tc.wantOutcome || filepath.Base(res.Target) != tc.wantTarget) {
+				t.Errorf("got %s %s, want %s %s", res.Outcome, filepath.Base(res.Target), tc.wantOutcome, tc.wantTarget)
+			}
+
+			if tc.wantLinked != "" && !sameInode(t, src, filepath.Join(dir, "dest", tc.wantLinked)) {
+				t.Errorf("%s is not a link of the source", tc.wantLinked)
+			}
+			// The original destination file survives unless it was replaced
+			if tc.wantLinked != "a.mkv" {
+				if data, err := os.ReadFile(target); err != nil || string(data) != "existing" {
+					t.Errorf("destination file changed: %q, %v", data, err)
+				}
+			}
+			if tc.wantErr {
+				if _, err := os.Lstat(filepath.Join(dir, "dest", fmt.Sprintf("a (%d).mkv", maxRenameSuffix+1))); !os.IsNotExist(err) {
+					t.Error("linked past the suffix limit")
+				}
+			}
+		})
+	}
+}
+
+func TestLinkFileDirectoryInTheWay(t *testing.T) {
+	for _, policy := range []string{ConflictSkip, ConflictOverwrite, ConflictRename, ConflictKeepLarger, ConflictKeepNewer} {
+		t.Run(policy, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "src.mkv")
+			target := filepath.Join(dir, "a.mkv")
+			writeFile(t, src, "source")
+			mkdir(t, target)
+			writeFile(t, filepath.Join(target, "inside"), "kept")
+
+			res, err := linkFile(src, target, Options{ConflictPolicy: policy}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Outcome != OutcomeSkipped || res.Target != target {
+				t.Errorf("got %s %s, want skipped %s", res.Outcome, res.Target, target)
+			}
+			if _, err := os.Stat(filepath.Join(target, "inside")); err != nil {
+				t.Errorf("directory contents touched: %v", err)
+			}
+		})
+	}
+}
+
+func sameInode(t *testing.T, a, b string) bool {
+	t.Helper()
+	ai, err := os.Stat(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ai, bi)
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// fileMeta collects the cache metadata of a source file.
+// The MD5 is only computed when withHash is set since it reads the whole file.
+func fileMeta(path string, withHash bool) (FileMeta, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return FileMeta{}, err
+	}
+
+	meta := FileMeta{
+		Path:    path,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	meta.Device, meta.Inode = inodeOf(info)
+
+	if withHash {
+		if meta.Hash, err = hashFile(path); err != nil {
+			return meta, err
+		}
+	}
+	return meta, nil
+}
+
+// hashFile returns the hex encoded MD5 of a file's content
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// relinkMoved updates the destination links of a source file that was renamed or
+// moved from oldPath to newPath within the source root src, instead of linking it
+// again as a new file.
+//
+// When the inode is unchanged the old link is renamed to the new destination.
+// When only the content hash matched, the new file is linked and the stale link
+// to the old copy removed. It returns the destinations that were handled; the
+// caller links the remaining ones as usual.
+func relinkMoved(oldPath, newPath, src string, dests []string, sameInode bool, opts Options, logger func(string, string)) map[string]bool {
+	handled := make(map[string]bool)
+	if !inDir(oldPath, src) {
+		return handled
+	}
+
+	newInfo, err := os.Stat(newPath)
+	if err != nil {
+		return handled
+	}
+
+	for _, dest := range dests {
+		oldTarget, err := DestPath(oldPath, src, dest, opts)
+		if err != nil {
+			continue
+		}
+		newTarget, err := DestPath(newPath, src, dest, opts)
+		if err != nil {
+			continue
+		}
+		newDir := filepath.Dir(newTarget)
+
+		oldInfo, err := os.Lstat(oldTarget)
+		if err != nil {
+			continue // nothing to carry over, link as a new file
+		}
+		if oldTarget == newTarget {
+			handled[dest] = true
+			continue
+		}
+		if _, err := os.Lstat(newTarget); err == nil {
+			continue // let the normal path report the conflict
+		}
+
+		if sameInode {
+			// Only move a link that really points at this file
+			if !os.SameFile(oldInfo, newInfo) {
+				continue
+			}
+			if err := os.MkdirAll(newDir, 0755); err != nil {
+				continue
+			}
+			if err := os.Rename(oldTarget, newTarget); err != nil {
+				if logger != nil {
+					logger("ERROR", fmt.Sprintf("❌ 同步重命名失败: %s → %s (%v)", oldTarget, newTarget, err))
+				}
+				continue
+			}
+		} else {
+			if _, err := LinkAs(newPath, newTarget, opts.LinkStrategy); err != nil {
+				continue
+			}
+			if err := os.Remove(oldTarget); err != nil && logger != nil {
+				logger("WARN", fmt.Sprintf("⚠️ 删除旧链接失败: %s (%v)", oldTarget, err))
+			}
+		}
+
+		if logger != nil {
+			logger("SUCCEED", fmt.Sprintf("🔁 检测到重命名: %s → %s (目标: %s)", oldPath, newPath, newTarget))
+		}
+		handled[dest] = true
+	}
+	return handled
+}
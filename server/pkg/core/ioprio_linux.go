@@ -0,0 +1,25 @@
+package core
+
+import "golang.org/x/sys/unix"
+
+// I/O priority of low-priority workers: the lowest level of the best-effort
+// class (ionice -c2 -n7), which still progresses on a busy disk unlike the
+// idle class, together with the lowest CPU priority (nice 19)
+const (
+	ioprioWhoProcess   = 1
+	ioprioClassBE      = 2
+	ioprioClassShift   = 13
+	ioprioLowestLevel  = 7
+	lowestNiceness     = 19
+	lowPriorityIOValue = ioprioClassBE<<ioprioClassShift | ioprioLowestLevel
+)
+
+// lowerThreadPriority lowers the I/O and CPU priority of the calling OS thread.
+// The caller must be locked to its thread, see runtime.LockOSThread.
+func lowerThreadPriority() error {
+	tid := unix.Gettid()
+	if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), lowPriorityIOValue); errno != 0 {
+		return errno
+	}
+	return unix.Setpriority(unix.PRIO_PROCESS, tid, lowestNiceness)
+}
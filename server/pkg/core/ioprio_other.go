@@ -0,0 +1,10 @@
+//go:build !linux
+
+package core
+
+import "errors"
+
+// lowerThreadPriority is only implemented on Linux
+func lowerThreadPriority() error {
+	return errors.New("low-priority I/O is not supported on this platform")
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -55,6 +56,21 @@ func GetOriginalDestPath(sourceFile, source, dest string, keepDirStruct bool, mk
 	return filepath.Join(dest, filepath.Join(finalParts...)), nil
 }
 
+// ErrTargetExists is returned by Link and LinkWith when the destination file already exists
+var ErrTargetExists = errors.New("file exists")
+
+// ErrAlreadyLinked is returned instead when the existing destination is the source
+// file itself (same device and inode). It matches ErrTargetExists with errors.Is.
+var ErrAlreadyLinked = fmt.Errorf("%w (same inode)", ErrTargetExists)
+
+// existsError reports an existing target, telling a link to sourceFile apart from a name collision
+func existsError(sourceFile, targetFile string, targetInfo os.FileInfo) error {
+	if srcInfo, err := os.Stat(sourceFile); err == nil && os.SameFile(srcInfo, targetInfo) {
+		return fmt.Errorf("%w: %s", ErrAlreadyLinked, targetFile)
+	}
+	return fmt.Errorf("%w: %s", ErrTargetExists, targetFile)
+}
+
 // Link creates a hard link
 func Link(sourceFile, destDir string) (string, error) {
 	// Ensure destination directory exists
@@ -65,8 +81,8 @@ func Link(sourceFile, destDir string) (string, error) {
 	targetFile := filepath.Join(destDir, filepath.Base(sourceFile))
 
 	// Check if target exists
-	if _, err := os.Stat(targetFile); err == nil {
-		return targetFile, fmt.Errorf("file exists: %s", targetFile)
+	if info, err := os.Stat(targetFile); err == nil {
+		return targetFile, existsError(sourceFile, targetFile, info)
 	}
 
 	// Create hard link
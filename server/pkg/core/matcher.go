@@ -1,43 +1,177 @@
 package core
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bmatcuk/doublestar/v4"
 )
 
-// Supported checks if a file path is supported based on include and exclude patterns.
-// It tries to mimic micromatch behavior:
+// Pattern syntax for include/exclude lists:
+//
+//	*.mkv           doublestar glob; matched against the base name unless it contains "/"
+//	**/Season*/**   glob with "/", matched against the full path
+//	re:\.S\d+E\d+\.  regular expression, matched against the full path with "/" separators
+//	!*.sample.mkv   negation: a later matching "!" pattern undoes an earlier match
+//
+// Patterns are evaluated in order and the last one that matches decides, as in
+// .gitignore. An include list made only of negations starts from "everything".
+
+// Case modes for MatchOptions.Case
+const (
+	MatchCaseDefault     = ""            // includes ignore case, excludes do not (historical behaviour)
+	MatchCaseSensitive   = "sensitive"   // both lists are case-sensitive
+	MatchCaseInsensitive = "insensitive" // both lists ignore case
+)
+
+// MatchOptions controls how Supported matches file paths
+type MatchOptions struct {
+	Case   string // see MatchCase*
+	Hidden bool   // also match files whose name starts with "."
+}
+
+// pattern is one compiled include/exclude entry
+type pattern struct {
+	negate bool
+	re     *regexp.Regexp // for "re:" patterns
+	glob   string
+	path   bool // the glob contains "/" and is matched against the full path
+	fold   bool // ignore case
+}
+
+var patternCache sync.Map // patternKey -> compiled pattern or error
+
+type patternKey struct {
+	text string
+	fold bool
+}
+
+// compilePattern parses and caches a single pattern
+func compilePattern(text string, fold bool) (*pattern, error) {
+	key := patternKey{text, fold}
+	if cached, ok := patternCache.Load(key); ok {
+		if err, isErr := cached.(error); isErr {
+			return nil, err
+		}
+		return cached.(*pattern), nil
+	}
+
+	p := &pattern{fold: fold}
+	body := text
+	if strings.HasPrefix(body, "!") {
+		p.negate = true
+		body = body[1:]
+	}
+
+	var err error
+	if expr, ok := strings.CutPrefix(body, "re:"); ok {
+		if fold {
+			expr = "(?i)" + expr
+		}
+		p.re, err = regexp.Compile(expr)
+		if err != nil {
+			err = fmt.Errorf("invalid pattern %q: %w", text, err)
+		}
+	} else {
+		p.path = strings.Contains(body, "/")
+		p.glob = body
+		if fold {
+			p.glob = strings.ToLower(body)
+		}
+		if !doublestar.ValidatePattern(p.glob) {
+			err = fmt.Errorf("invalid pattern %q", text)
+		}
+	}
+
+	if err != nil {
+		patternCache.Store(key, err)
+		return nil, err
+	}
+	patternCache.Store(key, p)
+	return p, nil
+}
+
+// ValidatePatterns checks that every pattern of an include/exclude list compiles
+func ValidatePatterns(patterns []string) error {
+	for _, text := range patterns {
+		if _, err := compilePattern(text, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidMatchCase reports whether c names a case mode
+func ValidMatchCase(c string) bool {
+	return c == MatchCaseDefault || c == MatchCaseSensitive || c == MatchCaseInsensitive
+}
+
+// matches reports whether p matches path, whose base name is base
+func (p *pattern) matches(path, base string) bool {
+	if p.re != nil {
+		return p.re.MatchString(filepath.ToSlash(path))
+	}
+	if p.path {
+		if p.fold {
+			path = strings.ToLower(path)
+		}
+		match, _ := doublestar.PathMatch(p.glob, path)
+		return match
+	}
+	if p.fold {
+		base = strings.ToLower(base)
+	}
+	match, _ := doublestar.Match(p.glob, base)
+	return match
+}
+
+// matchList evaluates patterns in order, the last matching one deciding.
+// Invalid patterns never match. onlyNegated reports a list without positive patterns.
+func matchList(patterns []string, path, base string, fold bool) (matched, onlyNegated bool) {
+	onlyNegated = true
+	for _, text := range patterns {
+		if !strings.HasPrefix(text, "!") {
+			onlyNegated = false
+		}
+		p, err := compilePattern(text, fold)
+		if err != nil {
+			continue
+		}
+		if p.matches(path, base) {
+			matched = !p.negate
+		}
+	}
+	return matched, onlyNegated
+}
+
+// Supported checks if a file path is supported based on include and exclude
+// patterns with the default MatchOptions:
 // 1. Filter out hidden files (starting with .)
 // 2. If include is empty, it assumes match all (unless excluded).
-// 3. Path must match at least one include pattern.
-// 4. Path must NOT match any exclude pattern.
+// 3. Path must match include: includes ignore case.
+// 4. Path must NOT match exclude: excludes are case-sensitive.
 func Supported(path string, include []string, exclude []string) bool {
-	// Filter out hidden files (files and directories starting with .)
+	return SupportedWith(path, include, exclude, MatchOptions{})
+}
+
+// SupportedWith is Supported with explicit case and hidden-file handling
+func SupportedWith(path string, include []string, exclude []string, opts MatchOptions) bool {
 	base := filepath.Base(path)
-	if strings.HasPrefix(base, ".") {
+	if !opts.Hidden && strings.HasPrefix(base, ".") {
 		return false
 	}
 
-	// Normalize path separators to forward slashes for globbing
-	// path = filepath.ToSlash(path) // Optional, doublestar handles OS separators usually, but consistent is better.
-	// Actually doublestar recommends forward slashes for patterns.
+	excludeFold := opts.Case == MatchCaseInsensitive
+	includeFold := opts.Case != MatchCaseSensitive
 
 	// Check exclusion first
-	for _, pattern := range exclude {
-		// For patterns without path separators, match against basename
-		// For patterns with path separators, match against full path
-		if strings.Contains(pattern, "/") {
-			if match, _ := doublestar.PathMatch(pattern, path); match {
-				return false
-			}
-		} else {
-			// Match against basename for simple patterns like *.tmp
-			if match, _ := doublestar.Match(pattern, base); match {
-				return false
-			}
-		}
+	if excluded, _ := matchList(exclude, path, base, excludeFold); excluded {
+		return false
 	}
 
 	// If no include patterns are provided, we assume everything is included (unless excluded above)
@@ -46,20 +180,78 @@ func Supported(path string, include []string, exclude []string) bool {
 		return true
 	}
 
-	for _, pattern := range include {
-		// For patterns without path separators, match against basename
-		// For patterns with path separators, match against full path
-		if strings.Contains(pattern, "/") {
-			if match, _ := doublestar.PathMatch(strings.ToLower(pattern), strings.ToLower(path)); match {
-				return true
-			}
-		} else {
-			// Match against basename for simple patterns like *.js
-			if match, _ := doublestar.Match(strings.ToLower(pattern), strings.ToLower(base)); match {
-				return true
-			}
-		}
+	included, onlyNegated := matchList(include, path, base, includeFold)
+	if onlyNegated {
+		// ["!*.txt"] means everything but text files
+		negated, _ := matchList(stripNegation(include), path, base, includeFold)
+		return !negated
 	}
+	return included
+}
 
-	return false
+// stripNegation returns the patterns without their "!" prefix
+func stripNegation(patterns []string) []string {
+	list := make([]string, len(patterns))
+	for i, p := range patterns {
+		list[i] = strings.TrimPrefix(p, "!")
+	}
+	return list
+}
+
+// matches reports whether path passes the include/exclude patterns of o
+func (o Options) matches(path string) bool {
+	return SupportedWith(path, o.Include, o.Exclude, o.matchOptions())
+}
+
+func (o Options) matchOptions() MatchOptions {
+	return MatchOptions{Case: o.MatchCase, Hidden: o.MatchHidden}
+}
+
+// passesFilters reports whether a file's size and modification time are within
+// the size and date limits of opts; a nil info passes
+func passesFilters(info os.FileInfo, opts Options) bool {
+	if info == nil {
+		return true
+	}
+	if opts.MinSize > 0 && info.Size() < opts.MinSize {
+		return false
+	}
+	if opts.MaxSize > 0 && info.Size() > opts.MaxSize {
+		return false
+	}
+	mtime := info.ModTime()
+	if !opts.ModifiedAfter.IsZero() && mtime.Before(opts.ModifiedAfter) {
+		return false
+	}
+	if !opts.ModifiedBefore.IsZero() && !mtime.Before(opts.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// oldEnough reports whether a file was last modified at least MinAgeSeconds,
+// and StableSeconds, before now. The watcher waits for such files instead, see
+// checkStable.
+func oldEnough(info os.FileInfo, opts Options, now time.Time) bool {
+	age := max(opts.MinAgeSeconds, opts.StableSeconds)
+	if age <= 0 || info == nil {
+		return true
+	}
+	return now.Sub(info.ModTime()) >= time.Duration(age)*time.Second
+}
+
+// ParseFilterTime parses a modifiedAfter/modifiedBefore value: a date such as
+// "2024-01-31" in local time, or an RFC 3339 timestamp. Empty is the zero time.
+func ParseFilterTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: expected YYYY-MM-DD or RFC 3339", s)
+	}
+	return t, nil
 }
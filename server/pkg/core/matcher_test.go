@@ -0,0 +1,336 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type matchCase struct {
+	path    string
+	include []string
+	exclude []string
+	want    bool
+}
+
+func runMatchCases(t *testing.T, opts MatchOptions, cases []matchCase) {
+	t.Helper()
+	for _, tc := range cases {
+		if got := SupportedWith(tc.path, tc.include, tc.exclude, opts); got != tc.want {
+			t.Errorf("%s include=%q exclude=%q: got %v, want %v", tc.path, tc.include, tc.exclude, got, tc.want)
+		}
+	}
+}
+
+// The historical behaviour that existing configs rely on
+func TestSupportedLegacy(t *testing.T) {
+	cases := []matchCase{
+		// Empty include matches everything that is not excluded
+		{"/data/movie.mkv", nil, nil, true},
+		{"/data/movie.mkv", nil, []string{"*.txt"}, true},
+		{"/data/notes.txt", nil, []string{"*.txt"}, false},
+
+		// Hidden files are never matched, hidden directories are
+		{"/data/.DS_Store", nil, nil, false},
+		{"/data/.hidden.mkv", []string{"*.mkv"}, nil, false},
+		{"/data/.config/movie.mkv", []string{"*.mkv"}, nil, true},
+
+		// Patterns without "/" match the base name
+		{"/data/a/b/movie.mkv", []string{"*.mkv"}, nil, true},
+		{"/data/a/b/movie.mp4", []string{"*.mkv"}, nil, false},
+		{"/data/movie.mkv", []string{"*.mp4", "*.mkv"}, nil, true},
+		{"/data/movie.mkv", []string{"movie.*"}, nil, true},
+		{"/data/movie.mkv", []string{"*.{mkv,mp4}"}, nil, true},
+
+		// Patterns with "/" match the full path
+		{"/data/tv/show.mkv", []string{"/data/tv/**"}, nil, true},
+		{"/data/movies/film.mkv", []string{"/data/tv/**"}, nil, false},
+		{"/data/tv/sample/show.mkv", nil, []string{"**/sample/**"}, false},
+		{"/data/tv/show.mkv", nil, []string{"**/sample/**"}, true},
+
+		// Includes ignore case
+		{"/data/MOVIE.MKV", []string{"*.mkv"}, nil, true},
+		{"/data/movie.mkv", []string{"*.MKV"}, nil, true},
+		{"/DATA/TV/show.mkv", []string{"/data/tv/**"}, nil, true},
+
+		// Excludes are case-sensitive
+		{"/data/NOTES.TXT", nil, []string{"*.txt"}, true},
+		{"/data/notes.txt", nil, []string{"*.TXT"}, true},
+		{"/data/Sample/show.mkv", nil, []string{"**/sample/**"}, true},
+
+		// Exclude wins over include
+		{"/data/sample.mkv", []string{"*.mkv"}, []string{"sample*"}, false},
+
+		// Invalid patterns never match
+		{"/data/movie.mkv", []string{"[*.mkv"}, nil, false},
+		{"/data/movie.mkv", nil, []string{"[*.mkv"}, true},
+	}
+
+	runMatchCases(t, MatchOptions{}, cases)
+
+	// Supported is SupportedWith the default options
+	for _, tc := range cases {
+		if got := Supported(tc.path, tc.include, tc.exclude); got != tc.want {
+			t.Errorf("Supported(%s, %q, %q) = %v, want %v", tc.path, tc.include, tc.exclude, got, tc.want)
+		}
+	}
+}
+
+func TestSupportedRegex(t *testing.T) {
+	runMatchCases(t, MatchOptions{}, []matchCase{
+		{"/tv/Show.S01E02.mkv", []string{`re:\.S\d+E\d+\.`}, nil, true},
+		{"/tv/Show.Special.mkv", []string{`re:\.S\d+E\d+\.`}, nil, false},
+		// Matched against the full path, anchors work on it
+		{"/tv/Show/extras/a.mkv", nil, []string{`re:/extras/`}, false},
+		{"/tv/Show/a.mkv", []string{`re:^/tv/`}, nil, true},
+		{"/movies/Show/a.mkv", []string{`re:^/tv/`}, nil, false},
+		// Case follows the list's mode: includes ignore case, excludes do not
+		{"/tv/SHOW.s01e02.MKV", []string{`re:\.s\d+e\d+\.mkv$`}, nil, true},
+		{"/tv/SAMPLE.mkv", nil, []string{`re:sample`}, true},
+		{"/tv/sample.mkv", nil, []string{`re:sample`}, false},
+		// An invalid expression never matches
+		{"/tv/a.mkv", []string{`re:(`}, nil, false},
+		// Mixed with globs
+		{"/tv/a.mp4", []string{"*.mkv", `re:\.mp4$`}, nil, true},
+	})
+}
+
+func TestSupportedNegation(t *testing.T) {
+	runMatchCases(t, MatchOptions{}, []matchCase{
+		// Last match wins
+		{"/tv/show.mkv", []string{"*.mkv", "!*sample*"}, nil, true},
+		{"/tv/show.sample.mkv", []string{"*.mkv", "!*sample*"}, nil, false},
+		{"/tv/show.sample.mkv", []string{"!*sample*", "*.mkv"}, nil, true},
+		{"/tv/keep.sample.mkv", []string{"*.mkv", "!*sample*", "keep.*"}, nil, true},
+
+		// Only negations: everything except
+		{"/tv/show.mkv", []string{"!*.txt"}, nil, true},
+		{"/tv/notes.txt", []string{"!*.txt"}, nil, false},
+		{"/tv/notes.nfo", []string{"!*.txt", "!*.nfo"}, nil, false},
+
+		// Negation in exclude re-includes
+		{"/tv/notes.txt", nil, []string{"*.txt", "!readme.txt"}, false},
+		{"/tv/readme.txt", nil, []string{"*.txt", "!readme.txt"}, true},
+		{"/tv/readme.txt", []string{"*.mkv"}, []string{"*.txt", "!readme.txt"}, false},
+
+		// Negated regex
+		{"/tv/a/extras/b.mkv", []string{"*.mkv", `!re:/extras/`}, nil, false},
+	})
+}
+
+func TestSupportedCaseModes(t *testing.T) {
+	runMatchCases(t, MatchOptions{Case: MatchCaseSensitive}, []matchCase{
+		{"/data/MOVIE.MKV", []string{"*.mkv"}, nil, false},
+		{"/data/movie.mkv", []string{"*.mkv"}, nil, true},
+		{"/data/NOTES.TXT", nil, []string{"*.txt"}, true},
+		{"/tv/SHOW.S01E02.mkv", []string{`re:\.s\d+e\d+\.`}, nil, false},
+	})
+
+	runMatchCases(t, MatchOptions{Case: MatchCaseInsensitive}, []matchCase{
+		{"/data/MOVIE.MKV", []string{"*.mkv"}, nil, true},
+		{"/data/NOTES.TXT", nil, []string{"*.txt"}, false},
+		{"/data/Sample/show.mkv", nil, []string{"**/sample/**"}, false},
+		{"/tv/SAMPLE.mkv", nil, []string{`re:sample`}, false},
+	})
+}
+
+func TestSupportedHidden(t *testing.T) {
+	runMatchCases(t, MatchOptions{Hidden: true}, []matchCase{
+		{"/data/.hidden.mkv", []string{"*.mkv"}, nil, true},
+		{"/data/.hidden.mkv", nil, nil, true},
+		{"/data/.DS_Store", nil, []string{".DS_Store"}, false},
+		{"/data/.hidden.mkv", []string{"*.mkv", "!.*"}, nil, false},
+	})
+}
+
+func TestValidatePatterns(t *testing.T) {
+	valid := []string{"*.mkv", "**/sample/**", "!*.txt", `re:\.S\d+E\d+`, `!re:^/tv/`}
+	if err := ValidatePatterns(valid); err != nil {
+		t.Errorf("valid patterns rejected: %v", err)
+	}
+	for _, p := range []string{"[*.mkv", `re:(`, `!re:[a-`} {
+		if err := ValidatePatterns([]string{p}); err == nil {
+			t.Errorf("expected error for %q", p)
+		}
+	}
+}
+
+// fakeInfo is the os.FileInfo of a file of the given size and modification time
+type fakeInfo struct {
+	size    int64
+	modTime time.Time
+}
+
+func (f fakeInfo) Name() string       { return "file" }
+func (f fakeInfo) Size() int64        { return f.size }
+func (f fakeInfo) Mode() os.FileMode  { return 0644 }
+func (f fakeInfo) ModTime() time.Time { return f.modTime }
+func (f fakeInfo) IsDir() bool        { return false }
+func (f fakeInfo) Sys() any           { return nil }
+
+func TestExclusionFilters(t *testing.T) {
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	info := func(size int64, mtime time.Time) os.FileInfo { return fakeInfo{size, mtime} }
+
+	cases := []struct {
+		name string
+		path string
+		info os.FileInfo
+		opts Options
+		want string
+	}{
+		{"no filters", "/data/a.mkv", info(10, jan), Options{}, ""},
+		{"unknown info passes", "/data/a.mkv", nil, Options{MinSize: 100}, ""},
+		{"pattern before filter", "/data/a.txt", info(10, jan), Options{Include: []string{"*.mkv"}, MinSize: 100}, ExcludedPattern},
+
+		{"below min size", "/data/a.mkv", info(99, jan), Options{MinSize: 100}, ExcludedFilter},
+		{"at min size", "/data/a.mkv", info(100, jan), Options{MinSize: 100}, ""},
+		{"above max size", "/data/a.mkv", info(101, jan), Options{MaxSize: 100}, ExcludedFilter},
+		{"at max size", "/data/a.mkv", info(100, jan), Options{MaxSize: 100}, ""},
+		{"within size range", "/data/a.mkv", info(50, jan), Options{MinSize: 10, MaxSize: 100}, ""},
+
+		// ModifiedAfter is inclusive, ModifiedBefore exclusive
+		{"before modified after", "/data/a.mkv", info(1, jan.Add(-time.Second)), Options{ModifiedAfter: jan}, ExcludedFilter},
+		{"at modified after", "/data/a.mkv", info(1, jan), Options{ModifiedAfter: jan}, ""},
+		{"at modified before", "/data/a.mkv", info(1, feb), Options{ModifiedBefore: feb}, ExcludedFilter},
+		{"just before modified before", "/data/a.mkv", info(1, feb.Add(-time.Second)), Options{ModifiedBefore: feb}, ""},
+		{"within date range", "/data/a.mkv", info(1, jan.Add(time.Hour)), Options{ModifiedAfter: jan, ModifiedBefore: feb}, ""},
+		{"after date range", "/data/a.mkv", info(1, feb.Add(time.Hour)), Options{ModifiedAfter: jan, ModifiedBefore: feb}, ExcludedFilter},
+
+		// The age limit is not a filter, see oldEnough
+		{"young file passes filters", "/data/a.mkv", info(1, time.Now()), Options{MinAgeSeconds: 3600}, ""},
+	}
+	for _, tc := range cases {
+		if got := exclusion(tc.path, tc.info, tc.opts); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestOldEnough(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name   string
+		info   os.FileInfo
+		minAge int
+		want   bool
+	}{
+		{"no limit", fakeInfo{modTime: now}, 0, true},
+		{"unknown info", nil, 60, true},
+		{"too new", fakeInfo{modTime: now.Add(-59 * time.Second)}, 60, false},
+		{"exactly old enough", fakeInfo{modTime: now.Add(-60 * time.Second)}, 60, true},
+		{"old", fakeInfo{modTime: now.Add(-time.Hour)}, 60, true},
+	}
+	for _, tc := range cases {
+		if got := oldEnough(tc.info, Options{MinAgeSeconds: tc.minAge}, now); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+		// The stable window holds back a file the same way
+		if got := oldEnough(tc.info, Options{StableSeconds: tc.minAge}, now); got != tc.want {
+			t.Errorf("%s (stable window): got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRunFilters(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	files := []struct {
+		name    string
+		size    int
+		modTime time.Time
+		reason  string // "" when linked
+	}{
+		{"linked.mkv", 100, old, ""},
+		{"small.mkv", 10, old, ExcludedFilter},
+		{"large.mkv", 1000, old, ExcludedFilter},
+		{"new.mkv", 100, time.Now(), ExcludedTooNew},
+		{"download.mkv", 100, old, ExcludedTempFile},
+		{"download.mkv.part", 100, old, ExcludedTempFile},
+	}
+	for _, f := range files {
+		path := filepath.Join(src, f.name)
+		if err := os.WriteFile(path, make([]byte, f.size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, f.modTime, f.modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	opts := Options{
+		PathsMapping:  map[string][]string{src: {dest}},
+		MinSize:       50,
+		MaxSize:       500,
+		MinAgeSeconds: 3600,
+		TempSuffixes:  []string{".part"},
+		Report:        NewReport(&buf),
+	}
+	if _, err := Run(context.Background(), opts, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	reasons := make(map[string]string)
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var rec FileReport
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		reasons[filepath.Base(rec.Source)] = rec.Reason
+	}
+	for _, f := range files {
+		_, err := os.Stat(filepath.Join(dest, f.name))
+		if linked := err == nil; linked != (f.reason == "") {
+			t.Errorf("%s: linked %v, want %v", f.name, linked, f.reason == "")
+		}
+		if got := reasons[f.name]; got != f.reason {
+			t.Errorf("%s: reported reason %q, want %q", f.name, got, f.reason)
+		}
+	}
+}
+
+func TestWatcherFilters(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	w := newTestWatcher(t, src, dest, ConflictSkip)
+	w.options.MinSize = 50
+	w.options.MinAgeSeconds = 3600
+	stats := Stats{FailFiles: make(map[string][]string)}
+
+	old := time.Now().Add(-2 * time.Hour)
+	small := filepath.Join(src, "small.mkv")
+	linked := filepath.Join(src, "linked.mkv")
+	young := filepath.Join(src, "young.mkv")
+	for path, size := range map[string]int{small: 10, linked: 100, young: 100} {
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if path != young {
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+		w.handleAdd(path, &stats)
+	}
+
+	for _, name := range []string{"small.mkv", "young.mkv"} {
+		if _, err := os.Stat(filepath.Join(dest, name)); !os.IsNotExist(err) {
+			t.Errorf("%s linked: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dest, "linked.mkv")); err != nil {
+		t.Errorf("linked.mkv not linked: %v", err)
+	}
+
+	// A young file waits for its age instead of being dropped
+	pending := w.Pending()
+	if len(pending) != 1 || pending[0].Path != young || pending[0].Reason != PendingTooNew {
+		t.Errorf("pending = %+v, want only %s as too new", pending, young)
+	}
+}
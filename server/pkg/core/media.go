@@ -0,0 +1,281 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Naming modes select how linked files are named below the destination
+const (
+	NamingDefault = ""      // mirror the source tree, see GetOriginalDestPath
+	NamingMedia   = "media" // parse release names into a Plex/Jellyfin library layout
+)
+
+// ValidNaming reports whether n names a naming mode
+func ValidNaming(n string) bool {
+	return n == NamingDefault || n == NamingMedia
+}
+
+// MediaInfo is what ParseMediaName recognised in a release name
+type MediaInfo struct {
+	Title      string
+	Year       int    // 0 if unknown
+	Season     int    // 0 for movies
+	Episode    int    // 0 for movies
+	EpisodeEnd int    // last episode of a multi-episode file, 0 if single
+	Resolution string // e.g. "1080p", "" if unknown
+}
+
+// IsEpisode reports whether the name is a TV episode rather than a movie
+func (m MediaInfo) IsEpisode() bool {
+	return m.Episode > 0
+}
+
+var (
+	// S01E02, S01E02E03, S01E02-E03, S01.E02
+	episodeSxE = regexp.MustCompile(`(?i)\bS(\d{1,2})[ .]?E(\d{1,3})(?:-?E(\d{1,3}))?\b`)
+	// 1x02
+	episodeNxN = regexp.MustCompile(`(?i)\b(\d{1,2})x(\d{2,3})\b`)
+	// Season 1 Episode 2
+	episodeLong = regexp.MustCompile(`(?i)\bSeason (\d{1,2}) Episode (\d{1,3})\b`)
+	// [Group] Title - 02 [1080p], anime style with absolute numbering
+	episodeAnime = regexp.MustCompile(`^(.+?) - (\d{1,3})(?:v\d)?(?: |$)`)
+
+	mediaYear       = regexp.MustCompile(`\b(19\d{2}|20\d{2})\b`)
+	mediaResolution = regexp.MustCompile(`(?i)\b(480p|576p|720p|1080[pi]|2160p|4k|uhd)\b`)
+	// Tokens that start the technical part of a release name
+	mediaQuality = regexp.MustCompile(`(?i)\b(480p|576p|720p|1080[pi]|2160p|4k|uhd|blu-?ray|bdrip|brrip|web-?dl|webrip|web|hdtv|dvdrip|remux|hdr|x26[45]|h 26[45]|hevc|proper|repack|extended|unrated|remastered)\b`)
+
+	leadingTags = regexp.MustCompile(`^(\s*[\[【][^\]】]*[\]】])+`)
+	bracketed   = regexp.MustCompile(`[\[【][^\]】]*[\]】]`)
+	spaces      = regexp.MustCompile(`\s+`)
+)
+
+// ParseMediaName recognises title, year, season, episode and resolution in a
+// release-style name without extension, such as "Show.Name.S01E02.1080p.WEB-DL"
+// or "Movie.Title.2019.2160p.BluRay.x265". It returns false when the name is
+// neither an episode nor a movie with a year.
+func ParseMediaName(name string) (MediaInfo, bool) {
+	var info MediaInfo
+	separated := strings.NewReplacer(".", " ", "_", " ")
+	if m := mediaResolution.FindStringSubmatch(separated.Replace(name)); m != nil {
+		info.Resolution = normalizeResolution(m[1])
+	}
+
+	// Release groups and tags in brackets carry no title
+	hadTags := bracketed.MatchString(name)
+	name = leadingTags.ReplaceAllString(name, "")
+	name = strings.TrimSpace(bracketed.ReplaceAllString(name, " "))
+	normalized := spaces.ReplaceAllString(separated.Replace(name), " ")
+
+	titleEnd := -1
+	if m := episodeSxE.FindStringSubmatchIndex(normalized); m != nil {
+		titleEnd = m[0]
+		info.Season = atoi(normalized[m[2]:m[3]])
+		info.Episode = atoi(normalized[m[4]:m[5]])
+		if m[6] >= 0 {
+			info.EpisodeEnd = atoi(normalized[m[6]:m[7]])
+		}
+	} else if m := episodeLong.FindStringSubmatchIndex(normalized); m != nil {
+		titleEnd = m[0]
+		info.Season = atoi(normalized[m[2]:m[3]])
+		info.Episode = atoi(normalized[m[4]:m[5]])
+	} else if m := episodeNxN.FindStringSubmatchIndex(normalized); m != nil && !mediaResolution.MatchString(normalized[m[0]:m[1]]) {
+		titleEnd = m[0]
+		info.Season = atoi(normalized[m[2]:m[3]])
+		info.Episode = atoi(normalized[m[4]:m[5]])
+	} else if m := episodeAnime.FindStringSubmatchIndex(name); m != nil && hadTags {
+		// Only trusted with the bracket tags of a fansub release; spaces are kept as is
+		info.Title = cleanTitle(name[m[2]:m[3]])
+		info.Season = 1
+		info.Episode = atoi(name[m[4]:m[5]])
+		return info, info.Title != "" && info.Episode > 0
+	}
+
+	if titleEnd >= 0 {
+		title := normalized[:titleEnd]
+		// "Show 2019 S01E01" or "Show (2019) S01E01"
+		if loc := mediaYear.FindAllStringSubmatchIndex(title, -1); len(loc) > 0 {
+			last := loc[len(loc)-1]
+			if last[0] > 0 && strings.TrimSpace(strings.Trim(title[last[1]:], " ()-")) == "" {
+				info.Year = atoi(title[last[2]:last[3]])
+				title = title[:last[0]]
+			}
+		}
+		info.Title = cleanTitle(title)
+		return info, info.Title != "" && info.Episode > 0
+	}
+
+	// A movie needs a year; the last one before the technical tags wins, so
+	// "2001 A Space Odyssey 1968" is dated 1968
+	cut := len(normalized)
+	if loc := mediaQuality.FindStringIndex(normalized); loc != nil {
+		cut = loc[0]
+	}
+	var year []int
+	for _, loc := range mediaYear.FindAllStringSubmatchIndex(normalized[:cut], -1) {
+		if loc[0] > 0 {
+			year = loc
+		}
+	}
+	if year == nil {
+		return info, false
+	}
+	info.Year = atoi(normalized[year[2]:year[3]])
+	info.Title = cleanTitle(normalized[:year[0]])
+	return info, info.Title != ""
+}
+
+// LibraryPath returns the library-relative path of a parsed file with the given
+// extension: "Title (Year)/Season 01/Title (Year) - S01E02.ext" for episodes and
+// "Title (Year)/Title (Year) - 1080p.ext" for movies
+func (m MediaInfo) LibraryPath(ext string) string {
+	name := m.Title
+	if m.Year > 0 {
+		name = fmt.Sprintf("%s (%d)", m.Title, m.Year)
+	}
+
+	if m.IsEpisode() {
+		episode := fmt.Sprintf("S%02dE%02d", m.Season, m.Episode)
+		if m.EpisodeEnd > m.Episode {
+			episode += fmt.Sprintf("-E%02d", m.EpisodeEnd)
+		}
+		return filepath.Join(name, fmt.Sprintf("Season %02d", m.Season), fmt.Sprintf("%s - %s%s", name, episode, ext))
+	}
+
+	file := name
+	if m.Resolution != "" {
+		file += " - " + m.Resolution
+	}
+	return filepath.Join(name, file+ext)
+}
+
+// mediaDestPath parses the file name, or else the name of its directory below
+// the source root, and returns the library path below dest. The directory name
+// only names the largest file of the directory; samples and extras next to it
+// would otherwise all claim the same library path.
+func mediaDestPath(sourceFile, source, dest string, largest *largestFiles) (string, bool) {
+	base := filepath.Base(sourceFile)
+	ext := filepath.Ext(base)
+	if info, ok := ParseMediaName(strings.TrimSuffix(base, ext)); ok {
+		return filepath.Join(dest, info.LibraryPath(ext)), true
+	}
+
+	// Obfuscated file names inside a properly named release directory
+	dir := filepath.Dir(sourceFile)
+	if rel, err := filepath.Rel(source, dir); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	if info, ok := ParseMediaName(filepath.Base(dir)); ok && largest.isLargest(sourceFile) {
+		return filepath.Join(dest, info.LibraryPath(ext)), true
+	}
+	return "", false
+}
+
+// largestFile is the largest regular file of a directory, see largestFiles.in
+type largestFile struct {
+	dirModTime time.Time
+	name       string
+	size       int64
+}
+
+// largestFiles remembers the largest file of each directory read during one
+// Run, plan, prune or watcher batch, so naming every file of a release reads
+// the directory once. A nil *largestFiles reads the directory every time.
+type largestFiles struct {
+	mu   sync.Mutex
+	dirs map[string]largestFile
+}
+
+func newLargestFiles() *largestFiles {
+	return &largestFiles{dirs: make(map[string]largestFile)}
+}
+
+// isLargest reports whether path is the largest file in its directory; of
+// files of equal size the first by name counts. A file that cannot be read,
+// e.g. a source that was just removed, is taken to be the largest.
+func (c *largestFiles) isLargest(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	largest, ok := c.in(filepath.Dir(path))
+	name := filepath.Base(path)
+	if !ok || largest.name == name {
+		return true
+	}
+	// A file that grew past the largest one since the directory was read
+	return info.Size() > largest.size || info.Size() == largest.size && name < largest.name
+}
+
+// in returns the largest regular file of dir. A remembered answer is used
+// only while the directory and the recorded file are unchanged.
+func (c *largestFiles) in(dir string) (largestFile, bool) {
+	dirInfo, err := os.Stat(dir)
+	if err != nil {
+		return largestFile{}, false
+	}
+	if c != nil {
+		c.mu.Lock()
+		l, ok := c.dirs[dir]
+		c.mu.Unlock()
+		if ok && l.dirModTime.Equal(dirInfo.ModTime()) {
+			if info, err := os.Stat(filepath.Join(dir, l.name)); err == nil && info.Size() == l.size {
+				return l, true
+			}
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return largestFile{}, false
+	}
+	l := largestFile{dirModTime: dirInfo.ModTime(), size: -1}
+	for _, e := range entries { // sorted by name, so ties keep the first
+		if !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if info.Size() > l.size {
+			l.name, l.size = e.Name(), info.Size()
+		}
+	}
+	if l.name == "" {
+		return largestFile{}, false
+	}
+	if c != nil {
+		c.mu.Lock()
+		c.dirs[dir] = l
+		c.mu.Unlock()
+	}
+	return l, true
+}
+
+func normalizeResolution(r string) string {
+	r = strings.ToLower(r)
+	if r == "4k" || r == "uhd" {
+		return "2160p"
+	}
+	return r
+}
+
+// cleanTitle trims separators and brackets left around a title
+func cleanTitle(s string) string {
+	s = strings.NewReplacer(".", " ", "_", " ").Replace(s)
+	s = spaces.ReplaceAllString(s, " ")
+	return strings.Trim(s, " -()[]")
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
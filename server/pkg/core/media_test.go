@@ -0,0 +1,183 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMediaName(t *testing.T) {
+	cases := []struct {
+		name string
+		want MediaInfo
+	}{
+		// TV episodes
+		{"The.Office.US.S01E01.720p.BluRay.x264-DEMAND", MediaInfo{Title: "The Office US", Season: 1, Episode: 1, Resolution: "720p"}},
+		{"Breaking.Bad.S05E14.Ozymandias.1080p.WEB-DL.DD5.1.H.264-BS", MediaInfo{Title: "Breaking Bad", Season: 5, Episode: 14, Resolution: "1080p"}},
+		{"Game of Thrones S08E06 The Iron Throne 2160p AMZN WEB-DL", MediaInfo{Title: "Game of Thrones", Season: 8, Episode: 6, Resolution: "2160p"}},
+		{"the_expanse_s03e05_1080p_web_h264", MediaInfo{Title: "the expanse", Season: 3, Episode: 5, Resolution: "1080p"}},
+		{"Doctor.Who.2005.S13E01.1080p.HDTV.x264", MediaInfo{Title: "Doctor Who", Year: 2005, Season: 13, Episode: 1, Resolution: "1080p"}},
+		{"Doctor Who (2005) - S01E01 - Rose", MediaInfo{Title: "Doctor Who", Year: 2005, Season: 1, Episode: 1}},
+		{"Friends.S02E12E13.The.One.After.the.Superbowl.DVDRip", MediaInfo{Title: "Friends", Season: 2, Episode: 12, EpisodeEnd: 13}},
+		{"Stranger.Things.S04E08-E09.2160p.NF.WEB-DL", MediaInfo{Title: "Stranger Things", Season: 4, Episode: 8, EpisodeEnd: 9, Resolution: "2160p"}},
+		{"Severance.S02.E03.1080p.ATVP.WEB-DL", MediaInfo{Title: "Severance", Season: 2, Episode: 3, Resolution: "1080p"}},
+		{"Seinfeld.3x07.The.Cafe", MediaInfo{Title: "Seinfeld", Season: 3, Episode: 7}},
+		{"Top Gear Season 22 Episode 4", MediaInfo{Title: "Top Gear", Season: 22, Episode: 4}},
+		{"[SubsPlease] Sousou no Frieren - 05 (1080p) [8C1F3D2A]", MediaInfo{Title: "Sousou no Frieren", Season: 1, Episode: 5, Resolution: "1080p"}},
+		{"[Erai-raws] Spy x Family - 12v2 [720p]", MediaInfo{Title: "Spy x Family", Season: 1, Episode: 12, Resolution: "720p"}},
+		{"【喵萌奶茶屋】[Lycoris Recoil] 孤独摇滚 - 03 [1080p]", MediaInfo{Title: "孤独摇滚", Season: 1, Episode: 3, Resolution: "1080p"}},
+		{"9-1-1.S06E01.1080p.WEB.h264", MediaInfo{Title: "9-1-1", Season: 6, Episode: 1, Resolution: "1080p"}},
+
+		// Movies
+		{"The.Matrix.1999.1080p.BluRay.x264-GROUP", MediaInfo{Title: "The Matrix", Year: 1999, Resolution: "1080p"}},
+		{"Inception (2010) [1080p]", MediaInfo{Title: "Inception", Year: 2010, Resolution: "1080p"}},
+		{"Dune.Part.Two.2024.2160p.WEB-DL.DDP5.1.Atmos.DV.HDR.H.265-FLUX", MediaInfo{Title: "Dune Part Two", Year: 2024, Resolution: "2160p"}},
+		{"2001.A.Space.Odyssey.1968.REMASTERED.1080p.BluRay", MediaInfo{Title: "2001 A Space Odyssey", Year: 1968, Resolution: "1080p"}},
+		{"Blade.Runner.2049.2017.4K.UHD.BluRay.x265", MediaInfo{Title: "Blade Runner 2049", Year: 2017, Resolution: "2160p"}},
+		{"1917.2019.720p.BRRip", MediaInfo{Title: "1917", Year: 2019, Resolution: "720p"}},
+		{"Parasite 2019 KOREAN 1080p BluRay x264", MediaInfo{Title: "Parasite", Year: 2019, Resolution: "1080p"}},
+		{"Spirited_Away_2001_BDRip_576p", MediaInfo{Title: "Spirited Away", Year: 2001, Resolution: "576p"}},
+		{"[BD] Your Name. 2016 1080p HEVC", MediaInfo{Title: "Your Name", Year: 2016, Resolution: "1080p"}},
+		{"Oppenheimer.2023.IMAX.1080p.WEBRip", MediaInfo{Title: "Oppenheimer", Year: 2023, Resolution: "1080p"}},
+	}
+
+	for _, tc := range cases {
+		got, ok := ParseMediaName(tc.name)
+		if !ok {
+			t.Errorf("%q: not parsed", tc.name)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%q:\n got  %+v\n want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseMediaNameUnrecognised(t *testing.T) {
+	cases := []string{
+		"",
+		"holiday photos",
+		"IMG_20240101_120000",
+		"readme",
+		"sample",
+		"2019",
+		"Some.Movie.1080p.BluRay.x264",
+		"Show.S01.1080p.WEB-DL",
+		"Album - 01 - Track",
+	}
+
+	for _, name := range cases {
+		if got, ok := ParseMediaName(name); ok {
+			t.Errorf("%q: unexpectedly parsed as %+v", name, got)
+		}
+	}
+}
+
+func TestMediaDestPath(t *testing.T) {
+	src := filepath.FromSlash("/downloads")
+	dest := filepath.FromSlash("/library")
+
+	cases := []struct {
+		file string
+		want string // "" when the default layout applies
+	}{
+		{"/downloads/Show.Name.S01E02.1080p.WEB-DL.mkv", "/library/Show Name/Season 01/Show Name - S01E02.mkv"},
+		{"/downloads/Doctor.Who.2005.S13E01.HDTV/Doctor.Who.2005.S13E01.HDTV.mkv", "/library/Doctor Who (2005)/Season 13/Doctor Who (2005) - S13E01.mkv"},
+		{"/downloads/Friends.S02E12E13.mkv", "/library/Friends/Season 02/Friends - S02E12-E13.mkv"},
+		{"/downloads/The.Matrix.1999.1080p.BluRay.x264-GROUP.mkv", "/library/The Matrix (1999)/The Matrix (1999) - 1080p.mkv"},
+		{"/downloads/Heat.1995.mkv", "/library/Heat (1995)/Heat (1995).mkv"},
+		{"/downloads/The.Matrix.1999.1080p.BluRay.x264-GROUP/abc123.mkv", "/library/The Matrix (1999)/The Matrix (1999) - 1080p.mkv"},
+		{"/downloads/random/notes.txt", ""},
+		{"/downloads/notes.txt", ""},
+	}
+
+	for _, tc := range cases {
+		got, ok := mediaDestPath(filepath.FromSlash(tc.file), src, dest, nil)
+		if tc.want == "" {
+			if ok {
+				t.Errorf("%s: expected fallback, got %s", tc.file, got)
+			}
+			continue
+		}
+		if !ok || got != filepath.FromSlash(tc.want) {
+			t.Errorf("%s: got %q (%v), want %q", tc.file, got, ok, tc.want)
+		}
+	}
+
+	// DestPath falls back to the default layout for names that do not parse
+	opts := Options{Naming: NamingMedia, KeepDirStruct: true}
+	got, err := DestPath(filepath.FromSlash("/downloads/random/notes.txt"), src, dest, opts)
+	if err != nil || got != filepath.FromSlash("/library/random/notes.txt") {
+		t.Errorf("fallback: got %q (%v)", got, err)
+	}
+}
+
+func TestMediaDestPathReleaseSample(t *testing.T) {
+	src := t.TempDir()
+	dest := filepath.FromSlash("/library")
+	release := filepath.Join(src, "The.Matrix.1999.1080p.BluRay.x264-GROUP")
+	if err := os.Mkdir(release, 0755); err != nil {
+		t.Fatal(err)
+	}
+	movie := filepath.Join(release, "abcd123.mkv")
+	sample := filepath.Join(release, "sample.mkv")
+	if err := os.WriteFile(movie, make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sample, make([]byte, 512), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	largest := newLargestFiles()
+	want := filepath.Join(dest, "The Matrix (1999)", "The Matrix (1999) - 1080p.mkv")
+	if got, ok := mediaDestPath(movie, src, dest, largest); !ok || got != want {
+		t.Errorf("movie: got %q (%v), want %q", got, ok, want)
+	}
+	// Only the largest file takes the release name
+	if got, ok := mediaDestPath(sample, src, dest, largest); ok {
+		t.Errorf("sample: expected fallback, got %s", got)
+	}
+
+	// A larger file added later takes over
+	remux := filepath.Join(release, "efgh456.mkv")
+	if err := os.WriteFile(remux, make([]byte, 8192), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := mediaDestPath(remux, src, dest, largest); !ok || got != want {
+		t.Errorf("larger file: got %q (%v), want %q", got, ok, want)
+	}
+	if got, ok := mediaDestPath(movie, src, dest, largest); ok {
+		t.Errorf("movie after a larger file was added: expected fallback, got %s", got)
+	}
+}
+
+func TestLargestFilesScopedToRun(t *testing.T) {
+	release := filepath.Join(t.TempDir(), "The.Matrix.1999.1080p.BluRay.x264-GROUP")
+	if err := os.Mkdir(release, 0755); err != nil {
+		t.Fatal(err)
+	}
+	movie := filepath.Join(release, "abcd123.mkv")
+	extra := filepath.Join(release, "extra.mkv")
+	if err := os.WriteFile(movie, make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(extra, make([]byte, 512), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	first := newLargestFiles()
+	if !first.isLargest(movie) || first.isLargest(extra) {
+		t.Fatal("first run: want only the movie to be the largest")
+	}
+
+	// Growing a file leaves the directory's mtime alone; a later run must not
+	// rely on what an earlier one read
+	if err := os.WriteFile(extra, make([]byte, 8192), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range map[string]*largestFiles{"next run": newLargestFiles(), "uncached": nil} {
+		if c.isLargest(movie) || !c.isLargest(extra) {
+			t.Errorf("%s: want only the grown file to be the largest", name)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Plan actions
+const (
+	ActionMkdir      = "mkdir"
+	ActionLink       = "link"
+	ActionRename     = "rename" // renamed source file, existing link is moved
+	ActionSkipExists = "skip-exists"
+	ActionSkipCached = "skip-cached"
+	ActionConflict   = "conflict"  // a different file is in the way and is left alone
+	ActionOverwrite  = "overwrite" // a different file is replaced by the conflict policy
+	ActionRepair     = "repair"    // a stale link whose inode diverged from the source is replaced
+	ActionDelete     = "delete"
+	ActionRmdir      = "rmdir"
+	ActionError      = "error"
+)
+
+// PlanAction is one filesystem change a task would make
+type PlanAction struct {
+	Action string `json:"action"`
+	Source string `json:"source,omitempty"`
+	Target string `json:"target,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	Reason string `json:"reason,omitempty"` // only for ActionError and ActionSkipExists
+}
+
+// PlanSummary counts the actions of a plan
+type PlanSummary struct {
+	Counts      map[string]int `json:"counts"`
+	LinkBytes   int64          `json:"linkBytes"`   // size of files that would be linked
+	DeleteBytes int64          `json:"deleteBytes"` // size of files that would be deleted
+}
+
+// Plan lists every action a run or prune would take, computed without touching the filesystem
+type Plan struct {
+	Type      string       `json:"type"`
+	CreatedAt time.Time    `json:"createdAt"`
+	Summary   PlanSummary  `json:"summary"`
+	Actions   []PlanAction `json:"actions"`
+}
+
+func newPlan(taskType string) *Plan {
+	return &Plan{
+		Type:      taskType,
+		CreatedAt: time.Now(),
+		Summary:   PlanSummary{Counts: make(map[string]int)},
+		Actions:   []PlanAction{},
+	}
+}
+
+func (p *Plan) add(a PlanAction) {
+	p.Actions = append(p.Actions, a)
+	p.Summary.Counts[a.Action]++
+	switch a.Action {
+	case ActionLink, ActionOverwrite, ActionRepair:
+		p.Summary.LinkBytes += a.Size
+	case ActionDelete:
+		p.Summary.DeleteBytes += a.Size
+	}
+}
+
+// WriteJSONL writes one action per line
+func (p *Plan) WriteJSONL(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, a := range p.Actions {
+		if err := enc.Encode(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BuildPlan computes the plan of a task, dispatching on its type like the run manager does
+func BuildPlan(ctx context.Context, opts Options) (*Plan, error) {
+	if opts.Type == "prune" {
+		return PlanPrune(ctx, opts)
+	}
+	return PlanRun(ctx, opts)
+}
+
+// PlanRun is the dry-run counterpart of Run: it walks the sources and reports
+// which directories would be created and which files linked or skipped.
+func PlanRun(ctx context.Context, opts Options) (*Plan, error) {
+	plan := newPlan("main")
+	opts.largest = newLargestFiles()
+
+	var cache *Cache
+	if opts.OpenCache {
+		cache = NewCache()
+		cache.SetTaskID(opts.TaskID)
+	}
+
+	jobs, err := collectJobs(ctx, opts, cache, nil, func(path string) {
+		plan.add(PlanAction{Action: ActionSkipCached, Source: path})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A later source mapped to the target of an earlier one finds that link in
+	// the way, as it would in Run
+	plannedTargets := make(map[string]string) // target -> source linked there
+	lstat := func(path string) (os.FileInfo, error) {
+		if source, ok := plannedTargets[path]; ok {
+			return os.Stat(source)
+		}
+		return os.Lstat(path)
+	}
+
+	plannedDirs := make(map[string]bool)
+
+	// planLink plans linking source to target and returns the action
+	planLink := func(source, target string, size int64, prev *FileMeta) PlanAction {
+		for _, dir := range missingDirs(filepath.Dir(target), plannedDirs) {
+			plan.add(PlanAction{Action: ActionMkdir, Target: dir})
+		}
+
+		action := PlanAction{Action: ActionLink, Source: source, Target: target, Size: size}
+		if _, err := lstat(target); err == nil {
+			action = planConflict(source, target, size, opts, prev, lstat)
+		}
+		switch action.Action {
+		case ActionLink, ActionOverwrite, ActionRepair:
+			plannedTargets[action.Target] = source
+		}
+		plan.add(action)
+		return action
+	}
+
+	for _, job := range jobs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// A renamed source keeps its existing links
+		var movedFrom string
+		if cache != nil && !job.primaryCached {
+			meta, _ := fileMeta(job.path, opts.ContentHash)
+			oldPath, _, ok, err := job.findMoved(cache, meta)
+			if err != nil {
+				return nil, fmt.Errorf("cache lookup: %w", err)
+			}
+			if ok {
+				movedFrom = oldPath
+			}
+		}
+
+		// Where the primary will be in each destination, for its companions
+		var primaryTargets []string
+
+		switch {
+		case job.primaryCached:
+			for _, dest := range job.dests {
+				if target, err := DestPath(job.path, job.src, dest, opts); err == nil && linkedAt(job.path, target) {
+					primaryTargets = append(primaryTargets, target)
+				}
+			}
+
+		case movedFrom != "":
+			plan.add(PlanAction{Action: ActionRename, Source: movedFrom, Target: job.path})
+			for _, dest := range job.dests {
+				if target, err := DestPath(job.path, job.src, dest, opts); err == nil {
+					primaryTargets = append(primaryTargets, target)
+				}
+			}
+
+		default:
+			var size int64
+			if info, err := os.Stat(job.path); err == nil {
+				size = info.Size()
+			}
+
+			var prev *FileMeta
+			if cache != nil && opts.Repair {
+				prev = job.prevMeta(cache)
+			}
+
+			for _, dest := range job.dests {
+				target, err := DestPath(job.path, job.src, dest, opts)
+				if err != nil {
+					plan.add(PlanAction{Action: ActionError, Source: job.path, Reason: err.Error()})
+					continue
+				}
+				action := planLink(job.path, target, size, prev)
+				switch action.Action {
+				case ActionLink, ActionOverwrite, ActionRepair:
+					primaryTargets = append(primaryTargets, action.Target)
+				case ActionSkipExists:
+					if action.Reason == "" { // not a different file kept by the policy
+						primaryTargets = append(primaryTargets, action.Target)
+					}
+				}
+			}
+		}
+
+		// Companions follow the primary, as in Run
+		for _, c := range job.companions {
+			var size int64
+			if info, err := os.Stat(c); err == nil {
+				size = info.Size()
+			}
+			for _, primaryTarget := range primaryTargets {
+				planLink(c, companionTarget(c, job.path, primaryTarget), size, job.companionPrevs[c])
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// planConflict maps the conflict policy's decision for an existing target to a
+// plan action; lstat looks up destination files, see decideConflictIn
+func planConflict(source, target string, size int64, opts Options, prev *FileMeta, lstat func(string) (os.FileInfo, error)) PlanAction {
+	outcome, finalTarget, err := decideConflictIn(source, target, opts, prev, lstat)
+	if err != nil {
+		return PlanAction{Action: ActionError, Source: source, Target: target, Reason: err.Error()}
+	}
+	switch outcome {
+	case OutcomeSkipped:
+		return PlanAction{Action: ActionConflict, Source: source, Target: target}
+	case OutcomeOverwritten:
+		return PlanAction{Action: ActionOverwrite, Source: source, Target: target, Size: size}
+	case OutcomeRepaired:
+		return PlanAction{Action: ActionRepair, Source: source, Target: target, Size: size}
+	case OutcomeRenamed:
+		return PlanAction{Action: ActionLink, Source: source, Target: finalTarget, Size: size}
+	case OutcomeKept:
+		return PlanAction{Action: ActionSkipExists, Source: source, Target: target, Reason: "kept"}
+	}
+	return PlanAction{Action: ActionSkipExists, Source: source, Target: finalTarget}
+}
+
+// missingDirs returns dir and its missing ancestors, outermost first, that are
+// not yet in planned; they are added to planned
+func missingDirs(dir string, planned map[string]bool) []string {
+	var missing []string
+	for d := dir; !planned[d]; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		planned[d] = true
+		missing = append(missing, d)
+		if parent := filepath.Dir(d); parent == d {
+			break
+		}
+	}
+	// Reverse so parents come first
+	for i, j := 0, len(missing)-1; i < j; i, j = i+1, j-1 {
+		missing[i], missing[j] = missing[j], missing[i]
+	}
+	return missing
+}
+
+// PlanPrune is the dry-run counterpart of Prune: it lists the files that would be
+// deleted and, when DeleteDir is set, the directories that would end up empty.
+func PlanPrune(ctx context.Context, opts Options) (*Plan, error) {
+	plan := newPlan("prune")
+
+	files, err := GetPruneFiles(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := make(map[string]bool, len(files))
+	for _, f := range files {
+		var size int64
+		if info, err := os.Lstat(f); err == nil {
+			size = info.Size()
+		}
+		plan.add(PlanAction{Action: ActionDelete, Target: f, Size: size})
+		deleted[f] = true
+	}
+
+	if opts.DeleteDir {
+		for _, dests := range opts.PathsMapping {
+			for _, dest := range dests {
+				for _, dir := range emptyDirsAfter(dest, deleted) {
+					plan.add(PlanAction{Action: ActionRmdir, Target: dir})
+				}
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// emptyDirsAfter returns the directories below root (root excluded) that would be
+// empty once the deleted files are gone, deepest first, mirroring removeEmptyDirs
+func emptyDirsAfter(root string, deleted map[string]bool) []string {
+	remaining := make(map[string]int)
+	var dirs []string
+	filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || path == root {
+			return nil
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+		}
+		if !deleted[path] {
+			remaining[filepath.Dir(path)]++
+		}
+		return nil
+	})
+
+	// Deepest first so that emptied children free up their parents
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return len(dirs[i]) > len(dirs[j])
+	})
+
+	var empty []string
+	for _, dir := range dirs {
+		if remaining[dir] == 0 {
+			empty = append(empty, dir)
+			remaining[filepath.Dir(dir)]--
+		}
+	}
+	return empty
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanRunSharedTarget(t *testing.T) {
+	srcA, srcB, dest := t.TempDir(), t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcA, "a.mkv"), []byte("first"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcB, "a.mkv"), []byte("second"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dest, "a.mkv")
+
+	cases := []struct {
+		policy string
+		want   PlanAction // planned for the second source
+	}{
+		{ConflictSkip, PlanAction{Action: ActionConflict, Target: target}},
+		{ConflictRename, PlanAction{Action: ActionLink, Target: filepath.Join(dest, "a (1).mkv")}},
+		{ConflictOverwrite, PlanAction{Action: ActionOverwrite, Target: target}},
+	}
+	for _, c := range cases {
+		opts := Options{
+			PathsMapping:   map[string][]string{srcA: {dest}, srcB: {dest}},
+			ConflictPolicy: c.policy,
+		}
+		plan, err := PlanRun(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var links []PlanAction
+		for _, a := range plan.Actions {
+			if a.Source != "" {
+				links = append(links, a)
+			}
+		}
+		if len(links) != 2 {
+			t.Fatalf("%s: got %+v, want two actions", c.policy, links)
+		}
+		if links[0].Action != ActionLink || links[0].Target != target {
+			t.Errorf("%s: first source got %+v, want a link to %s", c.policy, links[0], target)
+		}
+		if links[1].Action != c.want.Action || links[1].Target != c.want.Target {
+			t.Errorf("%s: second source got %s %s, want %s %s", c.policy, links[1].Action, links[1].Target, c.want.Action, c.want.Target)
+		}
+	}
+}
+
+func TestRepairWithoutCacheKeepsForeignFile(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "a.mkv"), []byte("source"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dest, "a.mkv")
+	if err := os.WriteFile(target, []byte("someone else's file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing identifies the target as a stale link, so the skip policy applies
+	opts := Options{PathsMapping: map[string][]string{src: {dest}}, Repair: true}
+	plan, err := PlanRun(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range plan.Actions {
+		if a.Target == target && a.Action != ActionConflict {
+			t.Errorf("planned %+v, want a conflict", a)
+		}
+	}
+	if _, err := Run(context.Background(), opts, nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "someone else's file" {
+		t.Fatalf("foreign target was replaced: %q, %v", data, err)
+	}
+}
+
+func TestPlanPruneMissingSource(t *testing.T) {
+	dest := t.TempDir()
+	writeFile(t, filepath.Join(dest, "a.mkv"), "linked")
+	missing := filepath.Join(t.TempDir(), "unmounted")
+
+	opts := Options{PathsMapping: map[string][]string{missing: {dest}}}
+	if plan, err := PlanPrune(context.Background(), opts); err == nil {
+		t.Fatalf("planned %+v for a missing source, want an error", plan.Actions)
+	}
+}
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// Progress phases
+const (
+	PhaseScanning = "scanning"
+	PhaseLinking  = "linking"
+	PhasePruning  = "pruning"
+	PhaseDone     = "done"
+)
+
+// progressInterval is how often snapshots are reported while a run is active
+const progressInterval = 500 * time.Millisecond
+
+// Progress is a point-in-time snapshot of a running task
+type Progress struct {
+	Phase          string  `json:"phase"`   // files are already linked while "scanning"
+	Scanned        int     `json:"scanned"` // files seen by the walk
+	Queued         int     `json:"queued"`  // files handed to workers
+	Linked         int     `json:"linked"`
+	Skipped        int     `json:"skipped"` // cached or already existing
+	Failed         int     `json:"failed"`
+	Deleted        int     `json:"deleted,omitempty"` // prune only
+	CurrentPath    string  `json:"currentPath,omitempty"`
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+	ETASeconds     float64 `json:"etaSeconds"` // -1 while unknown
+}
+
+// progressTracker accumulates progress and reports snapshots periodically.
+// A nil tracker is valid and does nothing, so callers need not check OnProgress.
+type progressTracker struct {
+	mu        sync.Mutex
+	p         Progress
+	processed int // queued files finished by workers
+	start     time.Time
+	workStart time.Time
+	workBase  int // files processed before workStart, while the walk was still running
+	report    func(Progress)
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+func newProgressTracker(report func(Progress)) *progressTracker {
+	if report == nil {
+		return nil
+	}
+	t := &progressTracker{
+		p:      Progress{Phase: PhaseScanning, ETASeconds: -1},
+		start:  time.Now(),
+		report: report,
+		stopCh: make(chan struct{}),
+	}
+	t.wg.Add(1)
+	go t.loop()
+	return t
+}
+
+func (t *progressTracker) loop() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.report(t.snapshot())
+		case <-t.stopCh:
+			return
+		}
+	}
+}
+
+// update applies fn to the current progress under lock
+func (t *progressTracker) update(fn func(p *Progress)) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	fn(&t.p)
+	t.mu.Unlock()
+}
+
+// setPhase switches phase and reports immediately
+func (t *progressTracker) setPhase(phase string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.p.Phase = phase
+	if phase == PhaseLinking || phase == PhasePruning {
+		t.workStart = time.Now()
+		t.workBase = t.processed
+	}
+	t.mu.Unlock()
+	t.report(t.snapshot())
+}
+
+// finish records the outcome of one queued file
+func (t *progressTracker) finish(path string, fn func(p *Progress)) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	fn(&t.p)
+	t.p.CurrentPath = path
+	t.processed++
+	t.mu.Unlock()
+}
+
+func (t *progressTracker) snapshot() Progress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p := t.p
+	p.ElapsedSeconds = time.Since(t.start).Seconds()
+	p.ETASeconds = -1
+	if !t.workStart.IsZero() && t.processed > t.workBase {
+		rate := float64(t.processed-t.workBase) / time.Since(t.workStart).Seconds()
+		if remaining := p.Queued - t.processed; remaining >= 0 && rate > 0 {
+			p.ETASeconds = float64(remaining) / rate
+		}
+	}
+	return p
+}
+
+// stop halts periodic reporting and sends the final snapshot
+func (t *progressTracker) stop() {
+	if t == nil {
+		return
+	}
+	close(t.stopCh)
+	t.wg.Wait()
+
+	t.mu.Lock()
+	t.p.Phase = PhaseDone
+	t.p.CurrentPath = ""
+	t.mu.Unlock()
+
+	p := t.snapshot()
+	p.ETASeconds = 0
+	t.report(p)
+}
@@ -0,0 +1,168 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Report actions, one per file and destination handled by Run
+const (
+	ReportLinked   = "linked"            // a new link was created
+	ReportExisting = "exists-same-inode" // the destination already was the source
+	ReportConflict = "conflict"          // a different file was in the way, see FileReport.Outcome
+	ReportCached   = "cached"            // skipped because the cache lists it
+	ReportExcluded = "excluded"          // not linked by the patterns, filters or claim, see FileReport.Reason
+	ReportFailed   = "failed"
+)
+
+// Reasons of ReportExcluded
+const (
+	ExcludedPattern   = "pattern"    // include/exclude
+	ExcludedFilter    = "filter"     // size or date filter
+	ExcludedTooNew    = "too-new"    // minAgeSeconds, or stableSeconds
+	ExcludedTempFile  = "temp-file"  // a download temp file, or next to one (tempSuffixes)
+	ExcludedNoPrimary = "no-primary" // companion whose primary is missing or not linked
+	ExcludedClaimed   = "claimed"    // handled by a watcher meanwhile
+)
+
+// FileReport is one line of a run report
+type FileReport struct {
+	Time       time.Time `json:"time"`
+	Action     string    `json:"action"` // see Report*
+	Source     string    `json:"source"`
+	Target     string    `json:"target,omitempty"`
+	Outcome    string    `json:"outcome,omitempty"` // conflict resolution, or "moved" for a renamed source, see Outcome*
+	Method     string    `json:"method,omitempty"`  // how a new link was made when not a hard link, see Method*
+	Reason     string    `json:"reason,omitempty"`  // see Excluded*
+	ErrorClass string    `json:"errorClass,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Bytes      int64     `json:"bytes,omitempty"`
+}
+
+// OutcomeMoved marks the link of a renamed or moved source file that was
+// moved along with it instead of being created again
+const OutcomeMoved = "moved"
+
+// Report writes the FileReport of every file Run handles as JSON Lines. It is
+// safe for concurrent use; a nil Report discards everything.
+type Report struct {
+	mu    sync.Mutex
+	enc   *json.Encoder
+	count int
+	err   error
+}
+
+// NewReport returns a report writing to w
+func NewReport(w io.Writer) *Report {
+	return &Report{enc: json.NewEncoder(w)}
+}
+
+// add writes one line; after the first write error the rest are dropped
+func (r *Report) add(rec FileReport) {
+	if r == nil {
+		return
+	}
+	rec.Time = time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	if r.err = r.enc.Encode(rec); r.err == nil {
+		r.count++
+	}
+}
+
+// Count returns how many lines were written
+func (r *Report) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.count
+}
+
+// Err returns the first write error
+func (r *Report) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// reportLink records the outcome of linking source into one destination
+func (r *Report) reportLink(source string, size int64, res linkResult) {
+	if r == nil {
+		return
+	}
+	rec := FileReport{Source: source, Target: res.Target, Bytes: size}
+	if res.Method != MethodHardlink {
+		rec.Method = res.Method
+	}
+	switch res.Outcome {
+	case OutcomeLinked:
+		rec.Action = ReportLinked
+	case OutcomeExisting:
+		rec.Action = ReportExisting
+	default:
+		rec.Action = ReportConflict
+		rec.Outcome = res.Outcome
+	}
+	r.add(rec)
+}
+
+// reportFailure records a file that could not be linked into target
+func (r *Report) reportFailure(source, target string, size int64, err error) {
+	r.add(FileReport{
+		Action:     ReportFailed,
+		Source:     source,
+		Target:     target,
+		Bytes:      size,
+		ErrorClass: ErrorClass(err),
+		Error:      err.Error(),
+	})
+}
+
+// Error classes of FileReport.ErrorClass
+const (
+	ErrorClassPermission  = "permission"
+	ErrorClassNotFound    = "not-found"
+	ErrorClassExists      = "exists"
+	ErrorClassCrossDevice = "cross-device"
+	ErrorClassNoSpace     = "no-space"
+	ErrorClassReadOnly    = "read-only"
+	ErrorClassTooManyLink = "too-many-links"
+	ErrorClassNameTooLong = "name-too-long"
+	ErrorClassPath        = "path" // the destination path could not be computed
+	ErrorClassOther       = "other"
+)
+
+// errPathCalc wraps errors of DestPath in Run
+var errPathCalc = errors.New("path calc error")
+
+// ErrorClass groups an error of Run into one of the ErrorClass* values
+func ErrorClass(err error) string {
+	switch {
+	case errors.Is(err, errPathCalc):
+		return ErrorClassPath
+	case errors.Is(err, fs.ErrPermission):
+		return ErrorClassPermission
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrorClassNotFound
+	case errors.Is(err, ErrTargetExists), errors.Is(err, fs.ErrExist):
+		return ErrorClassExists
+	case errors.Is(err, syscall.EXDEV):
+		return ErrorClassCrossDevice
+	case errors.Is(err, syscall.ENOSPC):
+		return ErrorClassNoSpace
+	case errors.Is(err, syscall.EROFS):
+		return ErrorClassReadOnly
+	case errors.Is(err, syscall.EMLINK):
+		return ErrorClassTooManyLink
+	case errors.Is(err, syscall.ENAMETOOLONG):
+		return ErrorClassNameTooLong
+	}
+	return ErrorClassOther
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestErrorClass(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("%w: bad template", errPathCalc), ErrorClassPath},
+		{&fs.PathError{Op: "link", Path: "/a", Err: syscall.EACCES}, ErrorClassPermission},
+		{&fs.PathError{Op: "link", Path: "/a", Err: syscall.ENOENT}, ErrorClassNotFound},
+		{fmt.Errorf("%w: /a", ErrTargetExists), ErrorClassExists},
+		{&os.LinkError{Op: "link", Old: "/a", New: "/b", Err: syscall.EEXIST}, ErrorClassExists},
+		{&os.LinkError{Op: "link", Old: "/a", New: "/b", Err: syscall.EXDEV}, ErrorClassCrossDevice},
+		{fmt.Errorf("cross-device copy failed: %w", syscall.ENOSPC), ErrorClassNoSpace},
+		{syscall.EROFS, ErrorClassReadOnly},
+		{syscall.EMLINK, ErrorClassTooManyLink},
+		{syscall.ENAMETOOLONG, ErrorClassNameTooLong},
+		{errors.New("something else"), ErrorClassOther},
+	}
+	for _, c := range cases {
+		if got := ErrorClass(c.err); got != c.want {
+			t.Errorf("ErrorClass(%v) = %s, want %s", c.err, got, c.want)
+		}
+	}
+}
+
+func TestRunReport(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(src, "new.mkv"), "new")
+	writeFile(t, filepath.Join(src, "linked.mkv"), "linked")
+	link(t, filepath.Join(src, "linked.mkv"), filepath.Join(dest, "linked.mkv"))
+	writeFile(t, filepath.Join(src, "taken.mkv"), "source")
+	writeFile(t, filepath.Join(dest, "taken.mkv"), "someone else's")
+	writeFile(t, filepath.Join(src, "notes.txt"), "excluded")
+	writeFile(t, filepath.Join(src, "tiny.mkv"), "x")
+
+	var buf bytes.Buffer
+	report := NewReport(&buf)
+	opts := Options{
+		PathsMapping: map[string][]string{src: {dest}},
+		Include:      []string{"**/*.mkv"},
+		MinSize:      2,
+		Report:       report,
+	}
+	if _, err := Run(context.Background(), opts, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := report.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]FileReport)
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var rec FileReport
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Time.IsZero() {
+			t.Errorf("%s: no time", rec.Source)
+		}
+		got[filepath.Base(rec.Source)] = rec
+	}
+	if len(got) != report.Count() {
+		t.Errorf("decoded %d records, Count() = %d", len(got), report.Count())
+	}
+
+	want := map[string]FileReport{
+		"new.mkv":    {Action: ReportLinked, Target: filepath.Join(dest, "new.mkv"), Bytes: 3},
+		"linked.mkv": {Action: ReportExisting, Target: filepath.Join(dest, "linked.mkv"), Bytes: 6},
+		"taken.mkv":  {Action: ReportConflict, Target: filepath.Join(dest, "taken.mkv"), Outcome: OutcomeSkipped, Bytes: 6},
+		"notes.txt":  {Action: ReportExcluded, Reason: ExcludedPattern, Bytes: 8},
+		"tiny.mkv":   {Action: ReportExcluded, Reason: ExcludedFilter, Bytes: 1},
+	}
+	for name, w := range want {
+		g, ok := got[name]
+		if !ok {
+			t.Errorf("%s: no record", name)
+			continue
+		}
+		if g.Action != w.Action || g.Target != w.Target || g.Outcome != w.Outcome || g.Reason != w.Reason || g.Bytes != w.Bytes {
+			t.Errorf("%s: got %+v, want %+v", name, g, w)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d records, want %d", len(got), len(want))
+	}
+}
+
+func TestNilReportDiscards(t *testing.T) {
+	var r *Report
+	r.add(FileReport{Action: ReportLinked})
+	r.reportFailure("/a", "/b", 1, errors.New("boom"))
+}
@@ -0,0 +1,12 @@
+package core
+
+import "syscall"
+
+// peakRSSMB returns the peak resident set size of the process in MB
+func peakRSSMB() (float64, bool) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0, false
+	}
+	return float64(ru.Maxrss) / (1 << 10), true // Maxrss is in KB on Linux
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package core
+
+// peakRSSMB is only implemented on Linux, where Maxrss is known to be in KB
+func peakRSSMB() (float64, bool) {
+	return 0, false
+}
@@ -1,193 +1,668 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
-	"strings"
 	"sync"
+	"time"
 )
 
-// Run executes the main linking task with concurrent processing
-func Run(opts Options, logger func(string, string)) (Stats, error) {
-	fmt.Println("DEBUG: Run() started")
+// Pipeline sizes of Run: the walker blocks once jobQueueSize files wait for a
+// worker, looks files up in the cache cacheLookupSize at a time, and linked
+// files are written to the cache every cacheFlushSize files, so memory use does
+// not grow with the size of the tree
+const (
+	jobQueueSize    = 1024
+	cacheLookupSize = 1000
+	cacheFlushSize  = 1000
+)
 
+// Run executes the main linking task with concurrent processing.
+// The walk streams files to the workers, which start linking immediately.
+// When ctx is cancelled the walk stops, queued files are skipped, and the
+// partial stats are returned with Cancelled set together with ctx.Err().
+func Run(ctx context.Context, opts Options, logger func(string, string)) (Stats, error) {
 	stats := Stats{
 		FailFiles: make(map[string][]string),
 	}
+	opts.largest = newLargestFiles()
 
 	// Load Cache if enabled
 	var cache *Cache
 	if opts.OpenCache {
 		cache = NewCache()
 		cache.SetTaskID(opts.TaskID)
-		fmt.Printf("DEBUG: Cache ENABLED for task %s (ID=%d)\n", opts.Name, opts.TaskID)
-	} else {
-		fmt.Printf("DEBUG: Cache DISABLED for task %s (ID=%d)\n", opts.Name, opts.TaskID)
 	}
 
-	var newCachedFiles []string
+	cached := &cacheWriter{cache: cache}
 	var mu sync.Mutex
 
-	// Collect all files first
-	fmt.Println("DEBUG: Starting file collection...")
+	progress := newProgressTracker(opts.OnProgress)
+	defer progress.stop()
+
+	// Process files concurrently
+	numWorkers := workerCount(opts)
+	limits := newThrottle(opts)
+
+	jobs := make(chan fileJob, jobQueueSize)
+	var wg sync.WaitGroup
+
+	// Start workers
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			if opts.LowPriorityIO {
+				// Never unlocked: the thread exits with the worker, so the
+				// lowered priority does not carry over to other goroutines
+				runtime.LockOSThread()
+				if err := lowerThreadPriority(); err != nil && workerID == 0 && logger != nil {
+					logger("WARN", fmt.Sprintf("⚠️ 无法降低 I/O 优先级: %v", err))
+				}
+			}
+			for job := range jobs {
+				// Drain remaining jobs without processing once cancelled
+				if ctx.Err() != nil {
+					continue
+				}
+				releaseClaim := func() {}
+				if opts.Claim != nil {
+					var ok bool
+					if releaseClaim, ok = opts.Claim(job.path); !ok {
+						opts.Report.add(FileReport{Action: ReportExcluded, Source: job.path, Reason: ExcludedClaimed})
+						progress.finish(job.path, func(p *Progress) { p.Skipped++ })
+						continue
+					}
+				}
+				release, err := limits.acquire(ctx)
+				if err != nil {
+					releaseClaim()
+					continue
+				}
+				processFile(job, opts, cache, logger, &stats, cached, &mu, progress)
+				release()
+				releaseClaim()
+			}
+		}(i)
+	}
+
+	// Send jobs as the walk finds them
+	err := walkJobs(ctx, opts, cache, progress, func(path string) {
+		if logger != nil {
+			logger("WARN", fmt.Sprintf("⚠️ 跳过(已缓存): %s", path))
+		}
+		opts.Report.add(FileReport{Action: ReportCached, Source: path})
+	}, func(job fileJob) error {
+		select {
+		case jobs <- job:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(jobs)
+
+	progress.setPhase(PhaseLinking)
+
+	wg.Wait()
+
+	// Update Cache (files linked before a cancel or a walk error are still recorded)
+	total, cacheErr := cached.flush()
+	if cacheErr != nil && logger != nil {
+		logger("ERROR", fmt.Sprintf("❌ 写入缓存失败: %v", cacheErr))
+	}
+	if total > 0 && logger != nil {
+		logger("INFO", fmt.Sprintf("💾 已加入缓存: %d 个文件", total))
+	}
+
+	if ctx.Err() != nil {
+		stats.Cancelled = true
+		if logger != nil {
+			logger("WARN", fmt.Sprintf("⚠️ 执行已取消 (成功: %d, 失败: %d)", stats.SuccessCount, stats.FailCount))
+		}
+		return stats, ctx.Err()
+	}
+	if err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// cacheWriter records linked files in the cache in batches
+type cacheWriter struct {
+	cache   *Cache // nil when the cache is disabled
+	mu      sync.Mutex
+	pending []FileMeta
+	total   int
+}
+
+// add queues meta and writes a full batch; the batch is lost when the write fails
+func (c *cacheWriter) add(meta FileMeta) error {
+	if c.cache == nil {
+		return nil
+	}
+	c.mu.Lock()
+	c.pending = append(c.pending, meta)
+	var batch []FileMeta
+	if len(c.pending) >= cacheFlushSize {
+		batch, c.pending = c.pending, nil
+	}
+	c.mu.Unlock()
+
+	return c.write(batch)
+}
+
+// flush writes the remaining entries and returns how many files were added in total
+func (c *cacheWriter) flush() (int, error) {
+	if c.cache == nil {
+		return 0, nil
+	}
+	c.mu.Lock()
+	batch := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+
+	err := c.write(batch)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total, err
+}
+
+// write adds a batch to the cache and counts it once it is stored
+func (c *cacheWriter) write(batch []FileMeta) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := c.cache.AddMeta(batch); err != nil {
+		return fmt.Errorf("%d files not cached: %w", len(batch), err)
+	}
+	c.mu.Lock()
+	c.total += len(batch)
+	c.mu.Unlock()
+	return nil
+}
+
+// collectJobs walks every source and returns the supported files that still need
+// processing, see walkJobs
+func collectJobs(ctx context.Context, opts Options, cache *Cache, progress *progressTracker, onCached func(path string)) ([]fileJob, error) {
 	var allFiles []fileJob
-	fileCount := 0
+	err := walkJobs(ctx, opts, cache, progress, onCached, func(job fileJob) error {
+		allFiles = append(allFiles, job)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return allFiles, nil
+}
+
+// walkJobs walks every source and passes the supported files that still need
+// processing to emit as it finds them; an error from emit or from a cache
+// lookup stops the walk, since a run that cannot tell cached files apart
+// would process every file again.
+// Files already in the cache are reported to onCached and skipped, except in
+// repair mode where every file is checked again. Companions are not emitted on
+// their own but with the job of their primary; the companions of a cached
+// primary that are not cached yet are emitted with primaryCached set.
+func walkJobs(ctx context.Context, opts Options, cache *Cache, progress *progressTracker, onCached func(path string), emit func(fileJob) error) error {
+	needInfo := opts.MinSize > 0 || opts.MaxSize > 0 || opts.MinAgeSeconds > 0 || opts.StableSeconds > 0 ||
+		!opts.ModifiedAfter.IsZero() || !opts.ModifiedBefore.IsZero()
+
+	// Candidates are looked up in the cache in batches instead of one query
+	// per file: whether they are cached (not in repair mode), and what
+	// processFile needs for the ones that are not, see Cache.Prefetch
+	checkCache := cache != nil
+	var batch []fileJob
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		var has map[string]bool
+		if !opts.Repair {
+			paths := make([]string, len(batch))
+			for i, job := range batch {
+				paths[i] = job.path
+			}
+			for _, job := range batch {
+				paths = append(paths, job.companions...)
+			}
+			var err error
+			if has, err = cache.HasMany(paths); err != nil {
+				return fmt.Errorf("cache lookup: %w", err)
+			}
+		}
+		pending := batch
+		batch = batch[:0]
+		var ready []fileJob
+		var uncached []string
+		for _, job := range pending {
+			var fresh []string
+			for _, c := range job.companions {
+				if !has[c] {
+					fresh = append(fresh, c)
+				} else if onCached != nil {
+					onCached(c)
+				}
+			}
+			job.companions = fresh
+			if has[job.path] {
+				if onCached != nil {
+					onCached(job.path)
+				}
+				if len(fresh) == 0 {
+					progress.update(func(p *Progress) { p.Skipped++ })
+					continue
+				}
+				job.primaryCached = true
+			} else {
+				uncached = append(uncached, job.path)
+			}
+			ready = append(ready, job)
+		}
+		lookups, err := cache.Prefetch(uncached, opts.Repair, opts.ContentHash)
+		if err != nil {
+			return fmt.Errorf("cache lookup: %w", err)
+		}
+		// Repair mode checks companions against their own cache entries
+		var companionPrevs map[string]*FileMeta
+		if opts.Repair {
+			var companions []string
+			for _, job := range ready {
+				companions = append(companions, job.companions...)
+			}
+			if len(companions) > 0 {
+				var err error
+				if companionPrevs, err = cache.GetMetaMany(companions); err != nil {
+					return fmt.Errorf("cache lookup: %w", err)
+				}
+			}
+		}
+		for _, job := range ready {
+			job.lookup = lookups[job.path]
+			for _, c := range job.companions {
+				if prev := companionPrevs[c]; prev != nil {
+					if job.companionPrevs == nil {
+						job.companionPrevs = make(map[string]*FileMeta)
+					}
+					job.companionPrevs[c] = prev
+				}
+			}
+			progress.update(func(p *Progress) { p.Queued++ })
+			if err := emit(job); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Companions of each directory, read once when the walk enters it. Entries
+	// are dropped as the files are visited.
+	withCompanions := len(opts.Companions) > 0
+	indexes := make(map[string]companionIndex)
 
 	for src, dests := range opts.PathsMapping {
-		fmt.Printf("DEBUG: Walking source: %s\n", src)
-		err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+
 			if err != nil {
 				return nil // Skip errors
 			}
 
-			if info.IsDir() {
+			if d.IsDir() {
+				if withCompanions {
+					if idx := indexCompanions(path, opts); len(idx.owner) > 0 {
+						indexes[path] = idx
+					}
+				}
 				return nil
 			}
 
-			fileCount++
-			if fileCount%1000 == 0 {
-				fmt.Printf("DEBUG: Scanned %d files...\n", fileCount)
-			}
+			progress.update(func(p *Progress) {
+				p.Scanned++
+				p.CurrentPath = path
+			})
 
-			// Check Supported
-			if !Supported(path, opts.Include, opts.Exclude) {
-				return nil
+			// Size and date filters need the file info, which WalkDir does not read
+			var info os.FileInfo
+			if needInfo {
+				if info, err = d.Info(); err != nil {
+					return nil
+				}
 			}
 
-			// Check Cache (skip for now to speed up)
-			if opts.OpenCache && cache != nil {
-				has, _ := cache.Has(path)
-				if has {
-					if logger != nil {
-						logger("WARN", fmt.Sprintf("⚠️ 跳过(已缓存): %s", path))
+			// Companions are linked together with their primary
+			var companions []string
+			if withCompanions {
+				dir := filepath.Dir(path)
+				idx := indexes[dir]
+				companion := isCompanion(path, opts)
+				if companion {
+					if idx.owner[path] == "" {
+						opts.Report.add(FileReport{Action: ReportExcluded, Source: path, Reason: ExcludedNoPrimary, Bytes: sizeOf(info)})
 					}
+					delete(idx.owner, path)
+				} else {
+					companions = idx.byPrimary[path]
+					delete(idx.byPrimary, path)
+				}
+				if len(idx.owner) == 0 && len(idx.byPrimary) == 0 {
+					delete(indexes, dir)
+				}
+				if companion {
 					return nil
 				}
 			}
 
-			allFiles = append(allFiles, fileJob{
-				path:  path,
-				src:   src,
-				dests: dests,
-			})
+			// Check Supported; downloads and files modified too recently are
+			// left to a later run
+			reason := exclusion(path, info, opts)
+			if reason == "" && (isTempFile(path, opts.TempSuffixes) || tempSibling(path, opts.TempSuffixes) != "") {
+				reason = ExcludedTempFile
+			}
+			if reason == "" && !oldEnough(info, opts, time.Now()) {
+				reason = ExcludedTooNew
+			}
+			if reason != "" {
+				opts.Report.add(FileReport{Action: ReportExcluded, Source: path, Reason: reason, Bytes: sizeOf(info)})
+				for _, c := range companions {
+					opts.Report.add(FileReport{Action: ReportExcluded, Source: c, Reason: ExcludedNoPrimary})
+				}
+				return nil
+			}
 
-			return nil
+			job := fileJob{
+				path:       path,
+				src:        src,
+				dests:      dests,
+				companions: companions,
+			}
+			if checkCache {
+				batch = append(batch, job)
+				if len(batch) >= cacheLookupSize {
+					return flush()
+				}
+				return nil
+			}
+
+			progress.update(func(p *Progress) { p.Queued++ })
+			return emit(job)
 		})
+		if err == nil {
+			err = flush()
+		}
 
 		if err != nil {
-			fmt.Printf("DEBUG: Walk error: %v\n", err)
-			return stats, err
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
 		}
 	}
 
-	fmt.Printf("DEBUG: Collected %d files to process\n", len(allFiles))
+	return nil
+}
 
-	if len(allFiles) == 0 {
-		fmt.Println("DEBUG: No files to process")
-		return stats, nil
+// reportSize returns the size of path for the report; the cache metadata
+// already has it
+func reportSize(path string, meta FileMeta, opts Options, cache *Cache) int64 {
+	if opts.Report == nil {
+		return 0
 	}
-
-	// Process files concurrently
-	numWorkers := runtime.NumCPU() * 2
-	if numWorkers > 16 {
-		numWorkers = 16
+	if cache != nil {
+		return meta.Size
 	}
-	if len(allFiles) < numWorkers {
-		numWorkers = len(allFiles)
+	if info, err := os.Stat(path); err == nil {
+		return info.Size()
 	}
+	return 0
+}
 
-	fmt.Printf("DEBUG: Starting %d workers for %d files\n", numWorkers, len(allFiles))
-
-	jobs := make(chan fileJob, len(allFiles))
-	var wg sync.WaitGroup
-
-	// Start workers
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			for job := range jobs {
-				processFile(job, opts, cache, logger, &stats, &newCachedFiles, &mu)
-			}
-		}(i)
+// linkedAt reports whether target already provides source
+func linkedAt(source, target string) bool {
+	srcInfo, err := os.Stat(source)
+	if err != nil {
+		return false
 	}
+	dstInfo, err := os.Lstat(target)
+	return err == nil && isSameFile(source, srcInfo, target, dstInfo)
+}
 
-	// Send jobs
-	for _, job := range allFiles {
-		jobs <- job
+// sizeOf returns the size of a file whose info may be nil
+func sizeOf(info os.FileInfo) int64 {
+	if info == nil {
+		return 0
 	}
-	close(jobs)
+	return info.Size()
+}
 
-	fmt.Println("DEBUG: Waiting for workers to complete...")
-	wg.Wait()
-	fmt.Println("DEBUG: All workers completed")
+type fileJob struct {
+	path       string
+	src        string
+	dests      []string
+	companions []string // linked next to the primary path, see walkJobs
+	// primaryCached means path is already linked and cached, so only its
+	// companions are linked
+	primaryCached bool
+	lookup        *cacheLookup // prefetched cache entries, nil when the walk made none
+	// companionPrevs holds the cache entries of the companions in repair mode
+	companionPrevs map[string]*FileMeta
+}
 
-	// Update Cache
-	if opts.OpenCache && cache != nil && len(newCachedFiles) > 0 {
-		if logger != nil {
-			logger("INFO", fmt.Sprintf("💾 已加入缓存: %d 个文件", len(newCachedFiles)))
-		}
-		_ = cache.Add(newCachedFiles)
+// findMoved is Cache.FindMoved, answered from the prefetched entries when there are some
+func (job fileJob) findMoved(cache *Cache, meta FileMeta) (oldPath string, sameInode bool, found bool, err error) {
+	if job.lookup != nil {
+		oldPath, sameInode, found = job.lookup.findMoved(meta)
+		return oldPath, sameInode, found, nil
 	}
-
-	fmt.Printf("DEBUG: Run() completed. Success: %d, Fail: %d\n", stats.SuccessCount, stats.FailCount)
-	return stats, nil
+	return cache.FindMoved(meta)
 }
 
-type fileJob struct {
-	path  string
-	src   string
-	dests []string
+// prevMeta returns the cache entry recorded for the file by the last run
+func (job fileJob) prevMeta(cache *Cache) *FileMeta {
+	if job.lookup != nil {
+		return job.lookup.prev
+	}
+	prev, _ := cache.GetMeta(job.path)
+	return prev
 }
 
-func processFile(job fileJob, opts Options, cache *Cache, logger func(string, string), stats *Stats, newCachedFiles *[]string, mu *sync.Mutex) {
+func processFile(job fileJob, opts Options, cache *Cache, logger func(string, string), stats *Stats, cached *cacheWriter, mu *sync.Mutex, progress *progressTracker) {
 	var linkSuccess bool
 	var anySuccess bool
+	var conflicted bool // a destination was skipped because of a conflict
 
-	for _, dest := range job.dests {
-		targetDir, err := GetOriginalDestPath(job.path, job.src, dest, opts.KeepDirStruct, opts.MkdirIfSingle)
+	// link links one file into one destination and records the outcome
+	link := func(source, target string, size int64, prev *FileMeta) (linkResult, bool) {
+		res, err := linkFile(source, target, opts, prev)
 		if err != nil {
 			mu.Lock()
-			stats.FailFiles["Path Calc Error"] = append(stats.FailFiles["Path Calc Error"], job.path)
+			stats.FailFiles[err.Error()] = append(stats.FailFiles[err.Error()], source+" -> "+target)
 			stats.FailCount++
 			mu.Unlock()
-			continue
+			if logger != nil {
+				logger("ERROR", fmt.Sprintf("❌ 硬链失败: %s → %s (%v)", source, target, err))
+			}
+			opts.Report.reportFailure(source, target, size, err)
+			return res, false
 		}
+		logLink(logger, source, res)
+		opts.Report.reportLink(source, size, res)
+		if opts.OnLinked != nil && (res.created() || res.Outcome == OutcomeExisting) {
+			opts.OnLinked(source, res.Target)
+		}
+		mu.Lock()
+		countLink(stats, source, res)
+		mu.Unlock()
+		return res, true
+	}
 
-		targetFile, err := Link(job.path, targetDir)
-		if err != nil {
-			if strings.Contains(err.Error(), "file exists") {
-				if logger != nil {
-					logger("WARN", fmt.Sprintf("⚠️ 文件已存在: %s → %s", job.path, targetFile))
+	// remember records a linked file; a failed batch write is reported here
+	remember := func(meta FileMeta) {
+		if err := cached.add(meta); err != nil && logger != nil {
+			logger("ERROR", fmt.Sprintf("❌ 写入缓存失败: %v", err))
+		}
+	}
+
+	// Where the primary now is in each destination, for its companions
+	var primaryTargets []string
+
+	if job.primaryCached {
+		linkSuccess = true
+		for _, dest := range job.dests {
+			if target, err := DestPath(job.path, job.src, dest, opts); err == nil && linkedAt(job.path, target) {
+				primaryTargets = append(primaryTargets, target)
+				if opts.OnLinked != nil {
+					opts.OnLinked(job.path, target)
 				}
+			}
+		}
+	} else {
+		// Recognise files renamed or moved within the source tree by inode or content
+		var meta FileMeta
+		var prev *FileMeta // cache entry from the last run, used to recognise stale links in repair mode
+		var moved map[string]bool
+		var lookupErr error
+		if cache != nil {
+			var err error
+			meta, err = fileMeta(job.path, opts.ContentHash)
+			if err != nil && logger != nil {
+				logger("WARN", fmt.Sprintf("⚠️ 读取文件信息失败: %s (%v)", job.path, err))
+			}
+			if opts.Repair {
+				prev = job.prevMeta(cache)
+			}
+			var oldPath string
+			var sameInode, ok bool
+			if oldPath, sameInode, ok, lookupErr = job.findMoved(cache, meta); ok {
+				moved = relinkMoved(oldPath, job.path, job.src, job.dests, sameInode, opts, logger)
+				if len(moved) > 0 {
+					if err := cache.Remove([]string{oldPath}); err != nil {
+						mu.Lock()
+						stats.FailFiles["Cache Remove Error"] = append(stats.FailFiles["Cache Remove Error"], oldPath)
+						stats.FailCount++
+						mu.Unlock()
+						if logger != nil {
+							logger("ERROR", fmt.Sprintf("❌ 移除缓存失败: %s (%v)", oldPath, err))
+						}
+					}
+				}
+			}
+		}
+		size := reportSize(job.path, meta, opts, cache)
+
+		dests := job.dests
+		if lookupErr != nil {
+			// Linked as a new file, a renamed source would leave its old links
+			// behind as duplicates; it stays uncached and the next run retries
+			dests = nil
+			mu.Lock()
+			stats.FailFiles["Cache Lookup Error"] = append(stats.FailFiles["Cache Lookup Error"], job.path)
+			stats.FailCount++
+			mu.Unlock()
+			if logger != nil {
+				logger("ERROR", fmt.Sprintf("❌ 查找移动来源失败: %s (%v)", job.path, lookupErr))
+			}
+			opts.Report.reportFailure(job.path, "", size, fmt.Errorf("cache lookup: %w", lookupErr))
+		}
+
+		for _, dest := range dests {
+			if moved[dest] {
 				linkSuccess = true
-			} else {
+				anySuccess = true
+				target, _ := DestPath(job.path, job.src, dest, opts)
+				primaryTargets = append(primaryTargets, target)
+				if opts.OnLinked != nil {
+					opts.OnLinked(job.path, target)
+				}
+				opts.Report.add(FileReport{Action: ReportLinked, Source: job.path, Target: target, Outcome: OutcomeMoved, Bytes: size})
+				continue
+			}
+
+			target, err := DestPath(job.path, job.src, dest, opts)
+			if err != nil {
 				mu.Lock()
-				stats.FailFiles[err.Error()] = append(stats.FailFiles[err.Error()], job.path+" -> "+targetDir)
+				stats.FailFiles["Path Calc Error"] = append(stats.FailFiles["Path Calc Error"], job.path)
 				stats.FailCount++
 				mu.Unlock()
-				if logger != nil {
-					logger("ERROR", fmt.Sprintf("❌ 硬链失败: %s → %s (%v)", job.path, targetDir, err))
-				}
+				opts.Report.reportFailure(job.path, "", size, fmt.Errorf("%w: %v", errPathCalc, err))
 				continue
 			}
-		} else {
-			if logger != nil {
-				logger("SUCCEED", fmt.Sprintf("✅ 硬链成功: %s → %s", job.path, targetFile))
+
+			res, ok := link(job.path, target, size, prev)
+			if !ok {
+				continue
+			}
+			if res.created() {
+				anySuccess = true
+			}
+			if res.settled() {
+				linkSuccess = true
+			} else {
+				conflicted = true
+			}
+			if res.created() || res.Outcome == OutcomeExisting {
+				primaryTargets = append(primaryTargets, res.Target)
+			}
+		}
+
+		if anySuccess || linkSuccess {
+			mu.Lock()
+			stats.SuccessCount++
+			mu.Unlock()
+			if meta.Path == "" {
+				meta.Path = job.path
 			}
-			linkSuccess = true
-			anySuccess = true
+			remember(meta)
 		}
 	}
 
-	mu.Lock()
-	if anySuccess || linkSuccess {
-		stats.SuccessCount++
-		if opts.OpenCache {
-			*newCachedFiles = append(*newCachedFiles, job.path)
+	// Companions follow the primary into the destinations it was linked to,
+	// under the name it got there
+	for _, c := range job.companions {
+		var meta FileMeta
+		if cache != nil {
+			meta, _ = fileMeta(c, opts.ContentHash)
+		}
+		size := reportSize(c, meta, opts, cache)
+		if len(primaryTargets) == 0 {
+			opts.Report.add(FileReport{Action: ReportExcluded, Source: c, Reason: ExcludedNoPrimary, Bytes: size})
+			continue
+		}
+
+		var created, settled bool
+		for _, primaryTarget := range primaryTargets {
+			res, ok := link(c, companionTarget(c, job.path, primaryTarget), size, job.companionPrevs[c])
+			if !ok {
+				continue
+			}
+			created = created || res.created()
+			settled = settled || res.settled()
+		}
+		anySuccess = anySuccess || created
+		if created || settled {
+			mu.Lock()
+			stats.SuccessCount++
+			mu.Unlock()
+			meta.Path = c
+			remember(meta)
 		}
 	}
-	mu.Unlock()
+
+	progress.finish(job.path, func(p *Progress) {
+		switch {
+		case anySuccess:
+			p.Linked++
+		case linkSuccess, conflicted:
+			p.Skipped++
+		default:
+			p.Failed++
+		}
+	})
 }
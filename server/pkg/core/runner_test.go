@@ -0,0 +1,114 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// BenchmarkRunStreaming links a synthetic tree of empty files with Run and
+// reports throughput, the peak Go heap while linking and the peak RSS of the
+// process. The tree has 20000 files by default; set HLINK_BENCH_FILES for the
+// million-file run, which needs about two million free inodes:
+//
+//	HLINK_BENCH_FILES=1000000 go test ./pkg/core -run '^$' -bench RunStreaming -benchtime 1x
+//
+// Peak heap stays roughly the same for any tree size because the walk feeds
+// a bounded queue instead of collecting every file first.
+func BenchmarkRunStreaming(b *testing.B) {
+	n := 20000
+	if v := os.Getenv("HLINK_BENCH_FILES"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n <= 0 {
+			b.Fatalf("invalid HLINK_BENCH_FILES %q", v)
+		}
+	}
+
+	root := b.TempDir()
+	src := filepath.Join(root, "src")
+	makeTree(b, src, n, 1000)
+
+	var peakHeap uint64
+	var elapsed time.Duration
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dst := filepath.Join(root, fmt.Sprintf("dst%d", i))
+		opts := Options{
+			PathsMapping:  map[string][]string{src: {dst}},
+			KeepDirStruct: true,
+		}
+
+		stop := sampleHeap(&peakHeap)
+		start := time.Now()
+		stats, err := Run(b.Context(), opts, nil)
+		elapsed += time.Since(start)
+		stop()
+
+		if err != nil || stats.SuccessCount != n {
+			b.Fatalf("run: linked %d of %d files (%v)", stats.SuccessCount, n, err)
+		}
+
+		b.StopTimer()
+		if err := os.RemoveAll(dst); err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+	}
+
+	b.ReportMetric(float64(n*b.N)/elapsed.Seconds(), "files/s")
+	b.ReportMetric(float64(peakHeap)/(1<<20), "peak-heap-MB")
+	if rss, ok := peakRSSMB(); ok {
+		b.ReportMetric(rss, "peak-rss-MB")
+	}
+}
+
+// makeTree creates n empty files below dir, perDir files per directory
+func makeTree(b *testing.B, dir string, n, perDir int) {
+	b.Helper()
+	for i := 0; i < n; i++ {
+		sub := filepath.Join(dir, fmt.Sprintf("d%04d", i/perDir))
+		if i%perDir == 0 {
+			if err := os.MkdirAll(sub, 0755); err != nil {
+				b.Fatal(err)
+			}
+		}
+		f, err := os.Create(filepath.Join(sub, fmt.Sprintf("f%07d.mkv", i)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		f.Close()
+	}
+}
+
+// sampleHeap records the largest HeapInuse seen in peak until stop is called
+func sampleHeap(peak *uint64) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(50 * time.Millisecond)
+		defer ticker.Stop()
+		var m runtime.MemStats
+		for {
+			runtime.ReadMemStats(&m)
+			if m.HeapInuse > *peak {
+				*peak = m.HeapInuse
+			}
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
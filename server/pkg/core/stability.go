@@ -0,0 +1,160 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Reasons a watched file is held back
+const (
+	PendingWriting  = "writing"   // size or mtime changed within the stable window
+	PendingTempFile = "temp-file" // a sibling download temp file still exists
+	PendingTooNew   = "too-new"   // modified less than MinAgeSeconds ago
+)
+
+// PendingFile is a file the watcher has seen but not linked yet
+type PendingFile struct {
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"modTime"`
+	FirstSeen time.Time `json:"firstSeen"`
+	StableAt  time.Time `json:"stableAt"` // earliest time it is linked if nothing changes
+	Reason    string    `json:"reason"`
+}
+
+// stabilityEnabled reports whether files must settle before the watcher links them
+func (w *Watcher) stabilityEnabled() bool {
+	return w.options.StableSeconds > 0 || w.options.MinAgeSeconds > 0 || len(w.options.TempSuffixes) > 0
+}
+
+// isTempFile reports whether path is a download client's temp file, e.g. "movie.mkv.part"
+func isTempFile(path string, suffixes []string) bool {
+	lower := strings.ToLower(path)
+	for _, suffix := range suffixes {
+		if suffix != "" && strings.HasSuffix(lower, strings.ToLower(suffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// tempSibling returns the temp file that marks path as still downloading, e.g.
+// "movie.mkv.aria2" next to "movie.mkv", or "" if there is none
+func tempSibling(path string, suffixes []string) string {
+	for _, suffix := range suffixes {
+		if suffix == "" {
+			continue
+		}
+		if _, err := os.Lstat(path + suffix); err == nil {
+			return path + suffix
+		}
+	}
+	return ""
+}
+
+// checkStable reports whether path may be linked now. A file is ready once no
+// temp sibling exists, its size and mtime have not changed for StableSeconds and
+// it was modified at least MinAgeSeconds ago; until then it is kept in the
+// pending list and re-checked by the event loop. Temp files are never linked.
+func (w *Watcher) checkStable(path string) bool {
+	if !w.stabilityEnabled() {
+		return true
+	}
+	if isTempFile(path, w.options.TempSuffixes) {
+		return false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		w.dropPending(path)
+		return false
+	}
+
+	now := time.Now()
+	window := time.Duration(w.options.StableSeconds) * time.Second
+
+	w.pendingMu.Lock()
+	defer w.pendingMu.Unlock()
+
+	prev, seen := w.pending[path]
+	entry := PendingFile{
+		Path:      path,
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		FirstSeen: now,
+		Reason:    PendingWriting,
+	}
+
+	// A file renamed into place keeps its old mtime and is ready at once, while
+	// any change seen since the last check restarts the window
+	lastChange := info.ModTime()
+	if seen {
+		entry.FirstSeen = prev.FirstSeen
+		if prev.Size != info.Size() || !prev.ModTime.Equal(info.ModTime()) {
+			lastChange = now
+		} else if changed := prev.StableAt.Add(-window); changed.After(lastChange) {
+			lastChange = changed
+		}
+	}
+	entry.StableAt = lastChange.Add(window)
+	if oldAt := info.ModTime().Add(time.Duration(w.options.MinAgeSeconds) * time.Second); oldAt.After(entry.StableAt) {
+		entry.StableAt = oldAt
+		entry.Reason = PendingTooNew
+	}
+
+	if sibling := tempSibling(path, w.options.TempSuffixes); sibling != "" {
+		entry.Reason = PendingTempFile
+	} else if !now.Before(entry.StableAt) {
+		if seen {
+			delete(w.pending, path)
+		}
+		return true
+	}
+
+	if !seen {
+		w.logger("INFO", fmt.Sprintf("⏳ 等待写入完成: %s", path))
+	}
+	w.pending[path] = entry
+	return false
+}
+
+// dropPending forgets a file that no longer needs to be waited for
+func (w *Watcher) dropPending(path string) {
+	w.pendingMu.Lock()
+	delete(w.pending, path)
+	w.pendingMu.Unlock()
+}
+
+// duePending returns the pending files worth checking again: those whose window
+// has passed and those waiting for a temp sibling to disappear
+func (w *Watcher) duePending() []string {
+	now := time.Now()
+	w.pendingMu.Lock()
+	defer w.pendingMu.Unlock()
+
+	var due []string
+	for path, p := range w.pending {
+		if p.Reason == PendingTempFile || !now.Before(p.StableAt) {
+			due = append(due, path)
+		}
+	}
+	return due
+}
+
+// Pending returns the files waiting to be linked, sorted by path
+func (w *Watcher) Pending() []PendingFile {
+	w.pendingMu.Lock()
+	list := make([]PendingFile, 0, len(w.pending))
+	for _, p := range w.pending {
+		list = append(list, p)
+	}
+	w.pendingMu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Path < list[j].Path
+	})
+	return list
+}
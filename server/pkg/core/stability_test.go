@@ -0,0 +1,208 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckStable(t *testing.T) {
+	const window = 60 * time.Second
+	cases := []struct {
+		name    string
+		file    string
+		opts    Options
+		age     time.Duration // how long ago the file was modified
+		sibling bool          // a "<file>.part" exists
+		missing bool          // the file is gone by the time it is checked
+		// prev returns the pending entry of an earlier check, if any
+		prev       func(size int64, mtime time.Time) *PendingFile
+		want       bool
+		wantReason string        // "" when the file must not be pending afterwards
+		restart    bool          // the window restarts from now
+		minAge     time.Duration // it is held until the mtime is this old
+	}{
+		{
+			name: "first sighting with an old mtime",
+			file: "a.mkv", opts: Options{StableSeconds: 60}, age: time.Hour,
+			want: true,
+		},
+		{
+			name: "first sighting while written",
+			file: "a.mkv", opts: Options{StableSeconds: 60}, age: time.Second,
+			wantReason: PendingWriting,
+		},
+		{
+			name: "size change restarts the window",
+			file: "a.mkv", opts: Options{StableSeconds: 60}, age: time.Hour,
+			prev: func(size int64, mtime time.Time) *PendingFile {
+				return &PendingFile{Size: size - 1, ModTime: mtime, StableAt: time.Now().Add(-time.Minute)}
+			},
+			wantReason: PendingWriting, restart: true,
+		},
+		{
+			name: "mtime change restarts the window",
+			file: "a.mkv", opts: Options{StableSeconds: 60}, age: time.Hour,
+			prev: func(size int64, mtime time.Time) *PendingFile {
+				return &PendingFile{Size: size, ModTime: mtime.Add(-time.Second), StableAt: time.Now().Add(-time.Minute)}
+			},
+			wantReason: PendingWriting, restart: true,
+		},
+		{
+			name: "unchanged past the window",
+			file: "a.mkv", opts: Options{StableSeconds: 60}, age: time.Hour,
+			prev: func(size int64, mtime time.Time) *PendingFile {
+				return &PendingFile{Size: size, ModTime: mtime, StableAt: time.Now().Add(-time.Second)}
+			},
+			want: true,
+		},
+		{
+			name: "unchanged within the window",
+			file: "a.mkv", opts: Options{StableSeconds: 60}, age: time.Hour,
+			prev: func(size int64, mtime time.Time) *PendingFile {
+				return &PendingFile{Size: size, ModTime: mtime, StableAt: time.Now().Add(30 * time.Second)}
+			},
+			wantReason: PendingWriting,
+		},
+		{
+			name: "min age outlasts the stable window",
+			file: "a.mkv", opts: Options{StableSeconds: 60, MinAgeSeconds: 3600}, age: 10 * time.Minute,
+			wantReason: PendingTooNew, minAge: time.Hour,
+		},
+		{
+			name: "old enough for min age",
+			file: "a.mkv", opts: Options{MinAgeSeconds: 3600}, age: 2 * time.Hour,
+			want: true,
+		},
+		{
+			name: "temp sibling",
+			file: "a.mkv", opts: Options{TempSuffixes: []string{".part"}}, age: time.Hour, sibling: true,
+			wantReason: PendingTempFile,
+		},
+		{
+			name: "temp file itself",
+			file: "a.mkv.part", opts: Options{TempSuffixes: []string{".part"}}, age: time.Hour,
+		},
+		{
+			name: "vanished file",
+			file: "a.mkv", opts: Options{StableSeconds: 60}, age: time.Hour, missing: true,
+			prev: func(size int64, mtime time.Time) *PendingFile {
+				return &PendingFile{Size: size, ModTime: mtime, StableAt: time.Now().Add(time.Minute)}
+			},
+		},
+		{
+			name: "stability disabled",
+			file: "a.mkv", age: time.Second,
+			want: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			src, dest := t.TempDir(), t.TempDir()
+			w := newTestWatcher(t, src, dest, ConflictSkip)
+			w.options.StableSeconds = tc.opts.StableSeconds
+			w.options.MinAgeSeconds = tc.opts.MinAgeSeconds
+			w.options.TempSuffixes = tc.opts.TempSuffixes
+
+			path := filepath.Join(src, tc.file)
+			writeFile(t, path, "data")
+			mtime := time.Now().Add(-tc.age).Truncate(time.Second)
+			if err := os.Chtimes(path, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+			if tc.sibling {
+				writeFile(t, path+".part", "")
+			}
+			if tc.prev != nil {
+				prev := tc.prev(4, mtime)
+				prev.Path = path
+				prev.FirstSeen = time.Now().Add(-time.Hour)
+				w.pending[path] = *prev
+			}
+			if tc.missing {
+				if err := os.Remove(path); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			start := time.Now()
+			if got := w.checkStable(path); got != tc.want {
+				t.Errorf("checkStable = %v, want %v", got, tc.want)
+			}
+
+			p, pending := w.pending[path]
+			if tc.wantReason == "" {
+				if pending {
+					t.Fatalf("still pending: %+v", p)
+				}
+				return
+			}
+			if !pending {
+				t.Fatal("not pending")
+			}
+			if p.Reason != tc.wantReason {
+				t.Errorf("reason = %q, want %q", p.Reason, tc.wantReason)
+			}
+			if !p.StableAt.After(start) && tc.wantReason != PendingTempFile {
+				t.Errorf("stableAt %v is not in the future", p.StableAt)
+			}
+			if tc.prev == nil {
+				if p.FirstSeen.Before(start) {
+					t.Errorf("firstSeen %v predates the first sighting", p.FirstSeen)
+				}
+			} else if !p.FirstSeen.Before(start) {
+				t.Errorf("firstSeen %v not kept from the earlier check", p.FirstSeen)
+			}
+			if tc.restart {
+				if d := p.StableAt.Sub(start); d < window-time.Second || d > window+time.Second {
+					t.Errorf("window restarted to %v from now, want %v", d, window)
+				}
+			}
+			if tc.minAge > 0 {
+				if want := mtime.Add(tc.minAge); !p.StableAt.Equal(want) {
+					t.Errorf("stableAt = %v, want %v", p.StableAt, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDuePending(t *testing.T) {
+	w := newTestWatcher(t, t.TempDir(), t.TempDir(), ConflictSkip)
+	now := time.Now()
+	w.pending = map[string]PendingFile{
+		"/src/settled.mkv": {Reason: PendingWriting, StableAt: now.Add(-time.Second)},
+		"/src/writing.mkv": {Reason: PendingWriting, StableAt: now.Add(time.Minute)},
+		"/src/young.mkv":   {Reason: PendingTooNew, StableAt: now.Add(time.Hour)},
+		"/src/old.mkv":     {Reason: PendingTooNew, StableAt: now.Add(-time.Hour)},
+		"/src/fetch.mkv":   {Reason: PendingTempFile, StableAt: now.Add(time.Minute)},
+	}
+
+	due := map[string]bool{}
+	for _, path := range w.duePending() {
+		due[path] = true
+	}
+	want := map[string]bool{"/src/settled.mkv": true, "/src/old.mkv": true, "/src/fetch.mkv": true}
+	if !reflect.DeepEqual(due, want) {
+		t.Errorf("due = %v, want %v", due, want)
+	}
+}
+
+func TestPendingSortedByPath(t *testing.T) {
+	w := newTestWatcher(t, t.TempDir(), t.TempDir(), ConflictSkip)
+	for _, path := range []string{"/src/c.mkv", "/src/a.mkv", "/src/b/z.mkv", "/src/b.mkv"} {
+		w.pending[path] = PendingFile{Path: path, Reason: PendingWriting}
+	}
+
+	var got []string
+	for _, p := range w.Pending() {
+		got = append(got, p.Path)
+	}
+	want := []string{"/src/a.mkv", "/src/b.mkv", "/src/b/z.mkv", "/src/c.mkv"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Pending() = %v, want %v", got, want)
+	}
+}
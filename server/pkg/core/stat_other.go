@@ -0,0 +1,15 @@
+//go:build !unix
+
+package core
+
+import "os"
+
+// inodeOf is only implemented on Unix; without inodes files are told apart by path
+func inodeOf(info os.FileInfo) (device, inode uint64) {
+	return 0, 0
+}
+
+// linkCount is only implemented on Unix
+func linkCount(info os.FileInfo) uint64 {
+	return 0
+}
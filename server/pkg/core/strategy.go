@@ -0,0 +1,199 @@
+package core
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Link strategies. Each one tries a hard link first and only falls back to the
+// named method when source and destination are on different filesystems (EXDEV).
+const (
+	StrategyHardlink        = "hardlink"         // hard link only (default)
+	StrategyReflink         = "reflink"          // else copy-on-write clone (btrfs, xfs)
+	StrategySymlink         = "symlink"          // else absolute symbolic link
+	StrategyRelativeSymlink = "relative-symlink" // else relative symbolic link
+	StrategyCopy            = "copy"             // else full copy, verified by MD5
+)
+
+// Methods reported by LinkWith
+const (
+	MethodHardlink = "hardlink"
+	MethodReflink  = "reflink"
+	MethodSymlink  = "symlink"
+	MethodCopy     = "copy"
+)
+
+// ValidStrategy reports whether s names a link strategy; "" means hardlink
+func ValidStrategy(s string) bool {
+	switch s {
+	case "", StrategyHardlink, StrategyReflink, StrategySymlink, StrategyRelativeSymlink, StrategyCopy:
+		return true
+	}
+	return false
+}
+
+// LinkWith links sourceFile into destDir like Link, falling back to the given
+// strategy when a hard link is impossible across filesystems. It returns the
+// target path and the method that created it.
+func LinkWith(sourceFile, destDir, strategy string) (string, string, error) {
+	targetFile := filepath.Join(destDir, filepath.Base(sourceFile))
+	method, err := LinkAs(sourceFile, targetFile, strategy)
+	return targetFile, method, err
+}
+
+// LinkAs is LinkWith for an explicit target path, which may rename the file
+func LinkAs(sourceFile, targetFile, strategy string) (string, error) {
+	// Ensure destination directory exists
+	destDir := filepath.Dir(targetFile)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory %s: %w", destDir, err)
+	}
+
+	if info, err := os.Lstat(targetFile); err == nil {
+		return "", existsError(sourceFile, targetFile, info)
+	}
+
+	return linkPath(sourceFile, targetFile, strategy)
+}
+
+// linkPath creates targetFile from sourceFile with a hard link, or with the
+// strategy's fallback when they are on different filesystems
+func linkPath(sourceFile, targetFile, strategy string) (string, error) {
+	err := os.Link(sourceFile, targetFile)
+	if err == nil {
+		return MethodHardlink, nil
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return "", err
+	}
+
+	switch strategy {
+	case StrategyReflink:
+		return MethodReflink, wrapFallback(MethodReflink, reflinkFile(sourceFile, targetFile))
+	case StrategySymlink, StrategyRelativeSymlink:
+		return MethodSymlink, wrapFallback(MethodSymlink, symlinkFile(sourceFile, targetFile, strategy == StrategyRelativeSymlink))
+	case StrategyCopy:
+		return MethodCopy, wrapFallback(MethodCopy, copyFile(sourceFile, targetFile))
+	}
+	return "", err
+}
+
+func wrapFallback(method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("cross-device %s failed: %w", method, err)
+}
+
+// methodLabel names a link method in log messages
+func methodLabel(method string) string {
+	switch method {
+	case MethodReflink:
+		return "克隆"
+	case MethodSymlink:
+		return "软链"
+	case MethodCopy:
+		return "复制"
+	}
+	return "硬链"
+}
+
+// recordFallback notes a file that was not hard linked in stats
+func recordFallback(stats *Stats, method, source, target string) {
+	if method == "" || method == MethodHardlink {
+		return
+	}
+	if stats.Fallbacks == nil {
+		stats.Fallbacks = make(map[string][]string)
+	}
+	stats.Fallbacks[method] = append(stats.Fallbacks[method], source+" -> "+target)
+}
+
+// symlinkFile creates target as a symbolic link to source
+func symlinkFile(source, target string, relative bool) error {
+	oldname, err := filepath.Abs(source)
+	if err != nil {
+		return err
+	}
+	if relative {
+		if oldname, err = filepath.Rel(filepath.Dir(target), oldname); err != nil {
+			return err
+		}
+	}
+	return os.Symlink(oldname, target)
+}
+
+// reflinkFile clones source into target, sharing data blocks on filesystems that support it
+func reflinkFile(source, target string) error {
+	return writeVia(source, target, func(src, dst *os.File) error {
+		return cloneFile(dst, src)
+	})
+}
+
+// copyFile copies source into target and verifies the written data against the
+// source's MD5 before moving it into place
+func copyFile(source, target string) error {
+	return writeVia(source, target, func(src, dst *os.File) error {
+		h := md5.New()
+		if _, err := io.Copy(dst, io.TeeReader(src, h)); err != nil {
+			return err
+		}
+		if err := dst.Sync(); err != nil {
+			return err
+		}
+		want := hex.EncodeToString(h.Sum(nil))
+
+		got, err := hashFile(dst.Name())
+		if err != nil {
+			return err
+		}
+		if got != want {
+			return fmt.Errorf("checksum mismatch after copy: %s != %s", got, want)
+		}
+		return nil
+	})
+}
+
+// writeVia fills a temp file next to target with fill and renames it into place,
+// keeping the source's mode and modification time. Nothing is left behind on error.
+func writeVia(source, target string, fill func(src, dst *os.File) error) error {
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	err = fill(src, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpName, info.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Chtimes(tmpName, info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		// Link instead of rename so that a target created meanwhile is not replaced
+		err = os.Link(tmpName, target)
+	}
+	os.Remove(tmpName)
+	return err
+}
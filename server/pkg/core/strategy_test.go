@@ -0,0 +1,156 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.mkv")
+	target := filepath.Join(dir, "copy.mkv")
+	writeFile(t, src, "source content")
+	if err := os.Chmod(src, 0600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyFile(src, target); err != nil {
+		t.Fatal(err)
+	}
+	srcInfo, _ := os.Stat(src)
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(srcInfo, info) {
+		t.Error("copy shares the source's inode")
+	}
+	if info.Mode().Perm() != 0600 || !info.ModTime().Equal(mtime) {
+		t.Errorf("mode %v, mtime %v; want the source's %v, %v", info.Mode().Perm(), info.ModTime(), os.FileMode(0600), mtime)
+	}
+	srcHash, _ := hashFile(src)
+	if got, err := hashFile(target); err != nil || got != srcHash {
+		t.Errorf("copy hash %s (%v), want %s", got, err, srcHash)
+	}
+	assertNoTemp(t, dir)
+}
+
+func TestCopyFileKeepsExistingTarget(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.mkv")
+	target := filepath.Join(dir, "copy.mkv")
+	writeFile(t, src, "source")
+	writeFile(t, target, "created meanwhile")
+
+	if err := copyFile(src, target); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("err = %v, want an existing target", err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "created meanwhile" {
+		t.Errorf("target replaced: %q", data)
+	}
+	assertNoTemp(t, dir)
+}
+
+func TestWriteViaFillError(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.mkv")
+	target := filepath.Join(dir, "b.mkv")
+	writeFile(t, src, "source")
+
+	fillErr := errors.New("fill failed")
+	err := writeVia(src, target, func(src, dst *os.File) error {
+		dst.WriteString("partial")
+		return fillErr
+	})
+	if !errors.Is(err, fillErr) {
+		t.Fatalf("err = %v, want the fill error", err)
+	}
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Error("target created despite the error")
+	}
+	assertNoTemp(t, dir)
+}
+
+func TestReflinkFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.mkv")
+	target := filepath.Join(dir, "clone.mkv")
+	writeFile(t, src, "source")
+
+	// Whether cloning works depends on the filesystem of the temp dir
+	if err := reflinkFile(src, target); err != nil {
+		if _, statErr := os.Lstat(target); !os.IsNotExist(statErr) {
+			t.Errorf("target left behind after %v", err)
+		}
+		if wrapped := wrapFallback(MethodReflink, err); !errors.Is(wrapped, err) {
+			t.Errorf("fallback error %v does not wrap %v", wrapped, err)
+		}
+	} else if data, _ := os.ReadFile(target); string(data) != "source" {
+		t.Errorf("clone content %q", data)
+	}
+	assertNoTemp(t, dir)
+}
+
+func TestSymlinkFile(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src", "Show", "a.mkv")
+	mkdir(t, filepath.Dir(src))
+	writeFile(t, src, "source")
+	destDir := filepath.Join(root, "dest", "Show")
+	mkdir(t, destDir)
+
+	cases := []struct {
+		relative bool
+		want     string
+	}{
+		{false, src},
+		{true, filepath.Join("..", "..", "src", "Show", "a.mkv")},
+	}
+	for _, tc := range cases {
+		target := filepath.Join(destDir, "a.mkv")
+		if err := symlinkFile(src, target, tc.relative); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := os.Readlink(target); err != nil || got != tc.want {
+			t.Errorf("relative=%v: link points at %q (%v), want %q", tc.relative, got, err, tc.want)
+		}
+		if !sameInode(t, src, target) {
+			t.Errorf("relative=%v: link does not resolve to the source", tc.relative)
+		}
+		os.Remove(target)
+	}
+}
+
+func TestLinkPathSameFilesystem(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.mkv")
+	writeFile(t, src, "source")
+
+	// The fallback only applies across filesystems
+	for _, strategy := range []string{StrategyHardlink, StrategyReflink, StrategySymlink, StrategyRelativeSymlink, StrategyCopy} {
+		target := filepath.Join(dir, strategy+".mkv")
+		method, err := linkPath(src, target, strategy)
+		if err != nil || method != MethodHardlink || !sameInode(t, src, target) {
+			t.Errorf("%s: got %s (%v), want a hard link", strategy, method, err)
+		}
+	}
+}
+
+// assertNoTemp fails if writeVia left a temp file in dir
+func assertNoTemp(t *testing.T, dir string) {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, ".*.tmp-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) > 0 {
+		t.Errorf("temp files left behind: %v", matches)
+	}
+}
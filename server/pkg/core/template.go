@@ -0,0 +1,238 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A destination template lays out linked files independently of the source
+// tree, e.g. "{show}/Season {season:02}/{show} - S{season:02}E{episode:02}.{ext}".
+// It is rendered relative to the destination directory and names the file itself.
+//
+// Variables:
+//
+//	{dir}       directory of the file relative to the source root ("" at the root)
+//	{dir[N]}    N-th segment of {dir}; negative N counts from the end, {dir[-1]} is the last
+//	{parent}    name of the directory containing the file (the source root for top-level files)
+//	{filename}  file name with extension
+//	{name}      file name without extension
+//	{ext}       extension without the dot
+//	{1}, {show} numbered and named capture groups of the template pattern
+//
+// A ":0N" suffix pads numeric values with zeros to N digits, e.g. {season:02}.
+// The pattern is matched against the file's path relative to the source root,
+// with "/" separators; files it does not match keep the default layout.
+
+var (
+	templateVar = regexp.MustCompile(`\{([^{}]+)\}`)
+	dirIndex    = regexp.MustCompile(`^dir\[(-?\d+)\]$`)
+)
+
+// destTemplate is a compiled destination template
+type destTemplate struct {
+	text    string
+	pattern *regexp.Regexp // nil if the template uses no capture groups
+}
+
+var templateCache sync.Map // template + "\x00" + pattern -> *destTemplate
+
+// ValidateTemplate checks a destination template and its pattern; an empty
+// template means the default layout
+func ValidateTemplate(tmpl, pattern string) error {
+	if tmpl == "" {
+		if pattern != "" {
+			return fmt.Errorf("destPattern requires destTemplate")
+		}
+		return nil
+	}
+	_, err := compileTemplate(tmpl, pattern)
+	return err
+}
+
+// compileTemplate parses a template once and checks that every variable is known
+func compileTemplate(tmpl, pattern string) (*destTemplate, error) {
+	key := tmpl + "\x00" + pattern
+	if t, ok := templateCache.Load(key); ok {
+		return t.(*destTemplate), nil
+	}
+
+	t := &destTemplate{text: tmpl}
+	groups := make(map[string]bool)
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid destPattern: %w", err)
+		}
+		t.pattern = re
+		for i, name := range re.SubexpNames() {
+			if i == 0 {
+				continue
+			}
+			groups[strconv.Itoa(i)] = true
+			if name != "" {
+				groups[name] = true
+			}
+		}
+	}
+
+	for _, m := range templateVar.FindAllStringSubmatch(tmpl, -1) {
+		name, format, _ := strings.Cut(m[1], ":")
+		if format != "" {
+			if _, err := padWidth(format); err != nil {
+				return nil, fmt.Errorf("invalid format in {%s}: %w", m[1], err)
+			}
+		}
+		switch {
+		case name == "dir", name == "parent", name == "filename", name == "name", name == "ext":
+		case dirIndex.MatchString(name):
+		case groups[name]:
+		default:
+			return nil, fmt.Errorf("unknown template variable {%s}", name)
+		}
+	}
+	if strings.HasPrefix(tmpl, "/") || filepath.IsAbs(tmpl) {
+		return nil, fmt.Errorf("destTemplate must be relative to the destination")
+	}
+
+	templateCache.Store(key, t)
+	return t, nil
+}
+
+// padWidth parses a ":0N" format
+func padWidth(format string) (int, error) {
+	if len(format) < 2 || format[0] != '0' {
+		return 0, fmt.Errorf("expected 0N, got %q", format)
+	}
+	n, err := strconv.Atoi(format[1:])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("expected 0N, got %q", format)
+	}
+	return n, nil
+}
+
+// render returns the path of sourceFile relative to the destination, or
+// ok=false if the pattern does not match it
+func (t *destTemplate) render(sourceFile, source string) (string, bool, error) {
+	absSource, err := filepath.Abs(source)
+	if err != nil {
+		return "", false, err
+	}
+	absFile, err := filepath.Abs(sourceFile)
+	if err != nil {
+		return "", false, err
+	}
+	rel, err := filepath.Rel(absSource, absFile)
+	if err != nil {
+		return "", false, err
+	}
+	rel = filepath.ToSlash(rel)
+
+	vars := make(map[string]string)
+	if t.pattern != nil {
+		m := t.pattern.FindStringSubmatch(rel)
+		if m == nil {
+			return "", false, nil
+		}
+		for i, name := range t.pattern.SubexpNames() {
+			if i == 0 {
+				continue
+			}
+			vars[strconv.Itoa(i)] = m[i]
+			if name != "" {
+				vars[name] = m[i]
+			}
+		}
+	}
+
+	filename := filepath.Base(absFile)
+	ext := filepath.Ext(filename)
+	dir := filepath.ToSlash(filepath.Dir(rel))
+	if dir == "." {
+		dir = ""
+	}
+	var segments []string
+	if dir != "" {
+		segments = strings.Split(dir, "/")
+	}
+	vars["dir"] = dir
+	vars["parent"] = filepath.Base(filepath.Dir(absFile))
+	vars["filename"] = filename
+	vars["name"] = strings.TrimSuffix(filename, ext)
+	vars["ext"] = strings.TrimPrefix(ext, ".")
+
+	out := templateVar.ReplaceAllStringFunc(t.text, func(s string) string {
+		name, format, _ := strings.Cut(s[1:len(s)-1], ":")
+		value := vars[name]
+		if m := dirIndex.FindStringSubmatch(name); m != nil {
+			i, _ := strconv.Atoi(m[1])
+			if i < 0 {
+				i += len(segments)
+			}
+			value = ""
+			if i >= 0 && i < len(segments) {
+				value = segments[i]
+			}
+		}
+		if format != "" {
+			width, _ := padWidth(format)
+			if n, err := strconv.Atoi(value); err == nil {
+				value = fmt.Sprintf("%0*d", width, n)
+			}
+		}
+		return value
+	})
+
+	// Empty variables leave empty segments, including a leading separator
+	cleaned := filepath.Clean(strings.TrimLeft(filepath.FromSlash(out), string(os.PathSeparator)))
+	if cleaned == "." || filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(os.PathSeparator)) {
+		return "", false, fmt.Errorf("destination template renders %q for %s", out, sourceFile)
+	}
+	return cleaned, true, nil
+}
+
+// DestPath returns the path sourceFile is linked to below dest: the rendered
+// destination template if the options have one that applies to the file, the
+// library path with media naming if the name parses, or else the layout of
+// GetOriginalDestPath with the original file name. Companions are placed next
+// to their primary's target.
+func DestPath(sourceFile, source, dest string, opts Options) (string, error) {
+	if isCompanion(sourceFile, opts) {
+		if primary := findPrimary(sourceFile, opts); primary != "" {
+			primaryTarget, err := DestPath(primary, source, dest, opts)
+			if err != nil {
+				return "", err
+			}
+			return companionTarget(sourceFile, primary, primaryTarget), nil
+		}
+	}
+
+	if opts.DestTemplate != "" {
+		t, err := compileTemplate(opts.DestTemplate, opts.DestPattern)
+		if err != nil {
+			return "", err
+		}
+		rel, ok, err := t.render(sourceFile, source)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return filepath.Join(dest, rel), nil
+		}
+	}
+	if opts.Naming == NamingMedia {
+		if target, ok := mediaDestPath(sourceFile, source, dest, opts.largest); ok {
+			return target, nil
+		}
+	}
+
+	targetDir, err := GetOriginalDestPath(sourceFile, source, dest, opts.KeepDirStruct, opts.MkdirIfSingle)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(targetDir, filepath.Base(sourceFile)), nil
+}
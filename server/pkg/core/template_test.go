@@ -0,0 +1,90 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDestPathTemplate(t *testing.T) {
+	src, dest := "/src", "/dst"
+	episode := `^(?P<show>[^/]+)/.*S(?P<season>\d+)E(?P<episode>\d+)`
+	cases := []struct {
+		tmpl, pattern string
+		file          string
+		want          string
+	}{
+		// Named groups with padding
+		{"{show}/Season {season:02}/{show} - S{season:02}E{episode:02}.{ext}", episode, "Severance/S2/Severance.S2E3.mkv", "Severance/Season 02/Severance - S02E03.mkv"},
+		// Numbered groups; padding leaves non-numeric values alone
+		{"{1:03}/{2:03}.{ext}", `^(\w+)/(\w+)`, "Show/7.mkv", "Show/007.mkv"},
+		// Directory segments, counted from either end
+		{"{dir[-1]}/{filename}", "", "a/b/c/x.mkv", "c/x.mkv"},
+		{"{dir[0]}/{name}.{ext}", "", "a/b/c/x.mkv", "a/x.mkv"},
+		{"{dir}/{filename}", "", "a/b/x.mkv", "a/b/x.mkv"},
+		// Missing segments and an empty {dir} leave no empty path elements
+		{"{dir[5]}/{filename}", "", "a/x.mkv", "x.mkv"},
+		{"{dir}/{filename}", "", "x.mkv", "x.mkv"},
+		// {parent} is the source root for top-level files
+		{"{parent}/{filename}", "", "x.mkv", "src/x.mkv"},
+		{"{parent}/{filename}", "", "a/b/x.mkv", "b/x.mkv"},
+		// Files the pattern does not match keep the default layout
+		{"Movies/{filename}", `^Movies/`, "TV/x.mkv", "TV/x.mkv"},
+		{"Movies/{filename}", `^Movies/`, "x.mkv", "x.mkv"},
+	}
+
+	for _, tc := range cases {
+		opts := Options{DestTemplate: tc.tmpl, DestPattern: tc.pattern}
+		got, err := DestPath(filepath.Join(src, tc.file), src, dest, opts)
+		if err != nil {
+			t.Errorf("%s with %s: %v", tc.tmpl, tc.file, err)
+			continue
+		}
+		if want := filepath.Join(dest, tc.want); got != want {
+			t.Errorf("%s with %s:\n got  %s\n want %s", tc.tmpl, tc.file, got, want)
+		}
+	}
+}
+
+func TestDestPathTemplateEscape(t *testing.T) {
+	cases := []struct {
+		tmpl, pattern string
+		file          string
+	}{
+		{"../{filename}", "", "x.mkv"},
+		{"{1}/{filename}", `^(.*)/`, "../../etc/x.mkv"},
+		{"a/../../{filename}", "", "x.mkv"},
+		{"{dir}", "", "x.mkv"},
+	}
+
+	for _, tc := range cases {
+		opts := Options{DestTemplate: tc.tmpl, DestPattern: tc.pattern}
+		if got, err := DestPath(filepath.Join("/src", tc.file), "/src", "/dst", opts); err == nil {
+			t.Errorf("%s with %s: got %s, want an error", tc.tmpl, tc.file, got)
+		}
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	cases := []struct {
+		tmpl, pattern string
+		ok            bool
+	}{
+		{"", "", true},
+		{"{dir[-1]}/{name}.{ext}", "", true},
+		{"{show}/{filename}", `(?P<show>\w+)`, true},
+		{"{2}/{filename}", `(\w+)/(\w+)`, true},
+		{"", `(\w+)`, false},
+		{"{show}/{filename}", "", false},
+		{"{3}/{filename}", `(\w+)/(\w+)`, false},
+		{"{name:2}", "", false},
+		{"{name:0x}", "", false},
+		{"/abs/{filename}", "", false},
+		{"{filename}", `(`, false},
+	}
+
+	for _, tc := range cases {
+		if err := ValidateTemplate(tc.tmpl, tc.pattern); (err == nil) != tc.ok {
+			t.Errorf("ValidateTemplate(%q, %q) = %v, want ok=%v", tc.tmpl, tc.pattern, err, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// maxDefaultWorkers caps the CPU-based worker count of Run when Options.Workers is not set
+const maxDefaultWorkers = 16
+
+// Limiter bounds how many files are processed at once and how many are
+// started per second. A Limiter can be shared by several runs, see Options.Shared.
+type Limiter struct {
+	slots chan struct{} // nil when concurrency is unlimited
+	rate  *rateLimiter  // nil when the rate is unlimited
+}
+
+// NewLimiter returns a limiter for at most concurrency files at once and
+// opsPerSecond files per second; zero means no limit. It returns nil when
+// neither is limited.
+func NewLimiter(concurrency, opsPerSecond int) *Limiter {
+	if concurrency <= 0 && opsPerSecond <= 0 {
+		return nil
+	}
+	l := &Limiter{}
+	if concurrency > 0 {
+		l.slots = make(chan struct{}, concurrency)
+	}
+	if opsPerSecond > 0 {
+		l.rate = &rateLimiter{interval: time.Second / time.Duration(opsPerSecond)}
+	}
+	return l
+}
+
+// acquire waits for a free slot and the next permitted start time. The caller
+// must call release once the file is done, unless an error is returned.
+// A nil Limiter never waits.
+func (l *Limiter) acquire(ctx context.Context) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	release = func() {}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+			release = func() { <-l.slots }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if err := l.rate.wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// rateLimiter spaces operations at least interval apart
+type rateLimiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	next     time.Time
+}
+
+// wait blocks until the caller's turn; a nil rateLimiter does not wait
+func (r *rateLimiter) wait(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	at := r.next
+	r.next = r.next.Add(r.interval)
+	r.mu.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttle applies the per-task and shared limits of a run to each file
+type throttle struct {
+	task   *Limiter
+	shared *Limiter
+}
+
+func newThrottle(opts Options) throttle {
+	return throttle{
+		task:   NewLimiter(0, opts.MaxOpsPerSecond),
+		shared: opts.Shared,
+	}
+}
+
+// acquire waits until a file may be processed; see Limiter.acquire. The
+// task's rate is waited out before taking a shared slot, so a slowly paced
+// run does not hold slots that other runs sharing the limiter could use.
+func (t throttle) acquire(ctx context.Context) (release func(), err error) {
+	releaseTask, err := t.task.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	releaseShared, err := t.shared.acquire(ctx)
+	if err != nil {
+		releaseTask()
+		return nil, err
+	}
+	return func() {
+		releaseShared()
+		releaseTask()
+	}, nil
+}
+
+// workerCount returns the number of workers Run starts
+func workerCount(opts Options) int {
+	if opts.Workers > 0 {
+		return opts.Workers
+	}
+	n := runtime.NumCPU() * 2
+	if n > maxDefaultWorkers {
+		n = maxDefaultWorkers
+	}
+	return n
+}
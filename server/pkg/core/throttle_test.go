@@ -0,0 +1,171 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewLimiterUnlimited(t *testing.T) {
+	if l := NewLimiter(0, 0); l != nil {
+		t.Fatalf("NewLimiter(0, 0) = %+v, want nil", l)
+	}
+	var l *Limiter
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
+
+func TestLimiterSlots(t *testing.T) {
+	l := NewLimiter(2, 0)
+	ctx := context.Background()
+	r1, err := l.acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cancelled while waiting for a slot
+	cctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(cctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the context's", err)
+	}
+
+	// A third file waits for a slot
+	acquired := make(chan struct{})
+	go func() {
+		if release, err := l.acquire(ctx); err == nil {
+			release()
+		}
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquired a third slot of two")
+	case <-time.After(50 * time.Millisecond):
+	}
+	r1()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("slot not handed over after release")
+	}
+}
+
+func TestRateLimiterSpacing(t *testing.T) {
+	l := NewLimiter(0, 50) // 20ms apart
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		release, err := l.acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	// The first starts at once, the other four wait one interval each
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("5 starts took %v, want at least 80ms", elapsed)
+	}
+}
+
+func TestLimiterReleasesSlotOnRateError(t *testing.T) {
+	l := NewLimiter(1, 1)
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	// The slot is free but the next start is a second away
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx); err == nil {
+		t.Fatal("acquired before the next permitted start")
+	}
+	if n := len(l.slots); n != 0 {
+		t.Errorf("%d slots still taken after a failed acquire", n)
+	}
+}
+
+func TestThrottleReleasesSharedOnTaskError(t *testing.T) {
+	shared := NewLimiter(1, 0)
+	th := throttle{task: NewLimiter(0, 1), shared: shared}
+	release, err := th.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := th.acquire(ctx); err == nil {
+		t.Fatal("acquired before the task's next permitted start")
+	}
+	if n := len(shared.slots); n != 0 {
+		t.Fatalf("shared slot kept after the task limiter failed (%d taken)", n)
+	}
+
+	// Other runs can still use the shared slot
+	other := throttle{shared: shared}
+	release, err = other.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
+
+func TestSharedLimiterNotHeldDuringRateWait(t *testing.T) {
+	shared := NewLimiter(1, 0)
+	newOpts := func(prefix string) Options {
+		src, dest := t.TempDir(), t.TempDir()
+		for i := range 3 {
+			writeFile(t, filepath.Join(src, fmt.Sprintf("%s%d.mkv", prefix, i)), "data")
+		}
+		return Options{PathsMapping: map[string][]string{src: {dest}}, Shared: shared}
+	}
+
+	// The slow run starts one file per second and is waiting on its rate
+	slow := newOpts("slow")
+	slow.MaxOpsPerSecond = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	slowDone := make(chan struct{})
+	go func() {
+		_, _ = Run(ctx, slow, nil)
+		close(slowDone)
+	}()
+	defer func() {
+		cancel()
+		<-slowDone
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// The fast run gets the shared slot meanwhile
+	start := time.Now()
+	stats, err := Run(context.Background(), newOpts("fast"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.SuccessCount != 3 {
+		t.Errorf("fast run linked %d files, want 3", stats.SuccessCount)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("fast run took %v behind the slow run's rate wait", elapsed)
+	}
+}
+
+func TestWorkerCount(t *testing.T) {
+	if n := workerCount(Options{Workers: 3}); n != 3 {
+		t.Errorf("workers = %d, want 3", n)
+	}
+	if n := workerCount(Options{}); n < 1 || n > maxDefaultWorkers {
+		t.Errorf("default workers = %d, want 1..%d", n, maxDefaultWorkers)
+	}
+}
@@ -1,23 +1,112 @@
 package core
 
+import "time"
+
 // Options defines the task configuration
 type Options struct {
-	TaskID        int                 `json:"taskId"`
-	Name          string              `json:"name"`
-	Type          string              `json:"type"` // "main" or "prune"
-	PathsMapping  map[string][]string `json:"pathsMapping"`
-	Include       []string            `json:"include"`
-	Exclude       []string            `json:"exclude"`
-	SaveMode      int                 `json:"saveMode"` // 0: keepDirStruct, 1: flatten? (Check logic)
-	OpenCache     bool                `json:"openCache"`
-	MkdirIfSingle bool                `json:"mkdirIfSingle"`
-	DeleteDir     bool                `json:"deleteDir"` // for prune
-	KeepDirStruct bool                `json:"keepDirStruct"`
+	TaskID         int                 `json:"taskId"`
+	Name           string              `json:"name"`
+	Type           string              `json:"type"` // "main" or "prune"
+	PathsMapping   map[string][]string `json:"pathsMapping"`
+	Include        []string            `json:"include"`
+	Exclude        []string            `json:"exclude"`
+	SaveMode       int                 `json:"saveMode"` // 0: keepDirStruct, 1: flatten? (Check logic)
+	OpenCache      bool                `json:"openCache"`
+	MkdirIfSingle  bool                `json:"mkdirIfSingle"`
+	DeleteDir      bool                `json:"deleteDir"` // for prune
+	KeepDirStruct  bool                `json:"keepDirStruct"`
+	ContentHash    bool                `json:"contentHash"`    // record MD5 in the cache to recognise renamed files
+	ScanOnStart    bool                `json:"scanOnStart"`    // Watcher runs a catch-up pass over the sources when it starts
+	StableSeconds  int                 `json:"stableSeconds"`  // Watcher links a file once its size and mtime are unchanged for this long; Run skips files modified more recently
+	TempSuffixes   []string            `json:"tempSuffixes"`   // download temp files (e.g. ".part"); never linked, and hold back their sibling
+	LinkStrategy   string              `json:"linkStrategy"`   // fallback when a hard link crosses filesystems, see Strategy*
+	ConflictPolicy string              `json:"conflictPolicy"` // what to do with a different existing destination file, see Conflict*
+	Repair         bool                `json:"repair"`         // re-check cached files and re-link targets whose inode diverged from the source
+	DestTemplate   string              `json:"destTemplate"`   // lays out and renames files below the destination instead of mirroring the source, see template.go
+	DestPattern    string              `json:"destPattern"`    // regexp on the source-relative path whose capture groups DestTemplate can use
+	Naming         string              `json:"naming"`         // "media" names files after their parsed release name, see Naming*
+	Priority       int                 `json:"priority"`       // order in the server's run queue, higher first
+
+	// Companions are patterns of files (subtitles, .nfo, artwork) linked along
+	// with a primary file; CompanionPrimary restricts which files are primaries
+	Companions       []string `json:"companions"`
+	CompanionPrimary []string `json:"companionPrimary"`
+
+	// Filters applied alongside Include/Exclude; zero values disable them
+	MinSize        int64     `json:"minSize"`        // bytes
+	MaxSize        int64     `json:"maxSize"`        // bytes
+	MinAgeSeconds  int       `json:"minAgeSeconds"`  // since the last modification
+	ModifiedAfter  time.Time `json:"modifiedAfter"`  // inclusive
+	ModifiedBefore time.Time `json:"modifiedBefore"` // exclusive
+
+	MatchCase   string `json:"matchCase"`   // case handling of Include/Exclude, see MatchCase*
+	MatchHidden bool   `json:"matchHidden"` // let Include/Exclude match dot-files
+
+	// Throttling of Run; zero values keep the defaults (CPU-based workers, no rate limit)
+	Workers         int  `json:"workers"`         // files processed concurrently
+	MaxOpsPerSecond int  `json:"maxOpsPerSecond"` // files started per second
+	LowPriorityIO   bool `json:"lowPriorityIO"`   // run workers at the lowest I/O and CPU priority (Linux)
+
+	// Shared, if set, is a limiter shared with other runs, such as the global
+	// cap of the run manager; it applies on top of the task's own limits
+	Shared *Limiter `json:"-"`
+
+	// OnProgress, if set, receives periodic progress snapshots while Run or Prune executes
+	OnProgress func(Progress) `json:"-"`
+
+	// OnBatch, if set, receives the result of each debounced batch handled by a Watcher
+	// that linked, deleted or failed at least one file or skipped a conflict
+	OnBatch func(start, end time.Time, stats Stats) `json:"-"`
+
+	// OnScan, if set, receives the result of the catch-up scan a Watcher runs on start
+	OnScan func(start, end time.Time, stats Stats, err error) `json:"-"`
+
+	// Report, if set, receives one line per file Run handles: linked, already
+	// linked, conflicting, cached, excluded or failed. RunReport asks the
+	// server to create one for each run.
+	RunReport bool    `json:"runReport"`
+	Report    *Report `json:"-"`
+
+	// Claim, if set, is asked before Run processes a file; files for which it
+	// returns false are being handled elsewhere and are skipped. Run calls
+	// release once a claimed file is done.
+	Claim func(path string) (release func(), ok bool) `json:"-"`
+
+	// OnLinked, if set, is called by Run for each destination file that is a
+	// link of source after the run: created, moved along or already in place
+	OnLinked func(source, target string) `json:"-"`
+
+	// largest is shared by the DestPath calls of one run, see largestFiles
+	largest *largestFiles
 }
 
 // Stats holds execution statistics
 type Stats struct {
-	SuccessCount int
-	FailCount    int
-	FailFiles    map[string][]string
+	SuccessCount int                 `json:"successCount"`
+	FailCount    int                 `json:"failCount"`
+	FailFiles    map[string][]string `json:"failFiles,omitempty"`
+	Cancelled    bool                `json:"cancelled"` // stopped before completion; counts are partial
+
+	// Fallbacks lists the files that could not be hard linked and were created
+	// by the task's link strategy instead, keyed by method ("reflink", "symlink", "copy")
+	Fallbacks map[string][]string `json:"fallbacks,omitempty"`
+
+	// Destination files that already existed: AlreadyLinked counts those that
+	// already were the source, the Conflict* counters the different files by how
+	// the conflict policy resolved them, and Conflicts lists the latter by outcome
+	AlreadyLinked       int                 `json:"alreadyLinked,omitempty"`
+	ConflictSkipped     int                 `json:"conflictSkipped,omitempty"`
+	ConflictOverwritten int                 `json:"conflictOverwritten,omitempty"`
+	ConflictRenamed     int                 `json:"conflictRenamed,omitempty"`
+	ConflictKept        int                 `json:"conflictKept,omitempty"`
+	Conflicts           map[string][]string `json:"conflicts,omitempty"`
+
+	// Repaired counts stale links replaced in repair mode; they are listed in
+	// Conflicts under "repaired"
+	Repaired int `json:"repaired,omitempty"`
+
+	// Prune only
+	DeletedCount int   `json:"deletedCount,omitempty"`
+	FreedBytes   int64 `json:"freedBytes,omitempty"` // size of deleted files that had no other link
+	RemovedDirs  int   `json:"removedDirs,omitempty"`
 }
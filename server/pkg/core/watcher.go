@@ -1,11 +1,14 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rjeczalik/notify"
@@ -24,8 +27,45 @@ type Watcher struct {
 	mu       sync.Mutex
 	isClosed bool
 	memCache sync.Map // L1 Memory Cache
+
+	// preloaded is set once preloadCache has loaded every cached path, from
+	// then on memCache alone tells whether a file is cached
+	preloaded atomic.Bool
+
+	// claims tracks which side handles a file while the catch-up scan runs,
+	// so that the scan and events arriving meanwhile do not link it twice.
+	// It is nil when no scan is in progress.
+	claimsMu sync.Mutex
+	claims   map[string]string
+
+	// pending holds files waiting for their writes to finish (see checkStable)
+	pendingMu sync.Mutex
+	pending   map[string]PendingFile
+
+	// links remembers the destination files made for each source, so that
+	// removing a source only removes its own links (see handleRemove)
+	linksMu sync.Mutex
+	links   map[string][]linkedTarget
+
+	// largest serves media naming for the batch being processed and is
+	// replaced by each batch, see destOptions
+	largest atomic.Pointer[largestFiles]
+}
+
+// linkedTarget is a destination file linked to a source and its identity
+type linkedTarget struct {
+	path   string
+	dest   string // destination root of path
+	device uint64
+	inode  uint64
 }
 
+// Claim owners
+const (
+	claimScan  = "scan"
+	claimEvent = "event"
+)
+
 // NewWatcher creates a watcher
 func NewWatcher(opts Options, logger func(string, string)) (*Watcher, error) {
 	// Create a buffered channel for events
@@ -36,6 +76,8 @@ func NewWatcher(opts Options, logger func(string, string)) (*Watcher, error) {
 		options: opts,
 		done:    make(chan bool),
 		logger:  logger,
+		pending: make(map[string]PendingFile),
+		links:   make(map[string][]linkedTarget),
 	}, nil
 }
 
@@ -81,12 +123,20 @@ func (w *Watcher) Start() error {
 	// Start event loop immediately (we'll receive events as watchers are added)
 	go w.eventLoop()
 
+	// Fill the memory cache so events for cached files need no DB query
+	if w.options.OpenCache {
+		go w.preloadCache()
+	} else if !w.options.ScanOnStart {
+		// Only links recorded in the cache or by this watcher are removed with their source
+		w.logger("WARN", fmt.Sprintf("⚠️ [%s] 未开启缓存和启动补扫，删除源文件时不会删除监听启动前创建的链接", taskName))
+	}
+
 	// ASYNC: Add watchers in background
 	go func() {
 		startTime := time.Now()
 		for _, p := range validPaths {
 			watchPath := filepath.Join(p.src, "...")
-			if err := notify.Watch(watchPath, w.events, notify.Create, notify.Write, notify.Rename); err != nil {
+			if err := notify.Watch(watchPath, w.events, notify.Create, notify.Write, notify.Rename, notify.Remove); err != nil {
 				w.logger("ERROR", fmt.Sprintf("❌ 无法监听路径 %s: %v", p.src, err))
 			} else {
 				w.logger("INFO", fmt.Sprintf("🩺 路径[%s] => %v 已就绪", p.src, p.dests))
@@ -94,6 +144,11 @@ func (w *Watcher) Start() error {
 		}
 		elapsed := time.Since(startTime)
 		w.logger("INFO", fmt.Sprintf("✅ [%s] 所有路径监听就绪 (耗时 %.1f 秒)", taskName, elapsed.Seconds()))
+
+		// Watches are in place, so nothing created from here on is missed by the scan
+		if w.options.ScanOnStart {
+			w.catchUp()
+		}
 	}()
 
 	// Return immediately - service is ready to receive events
@@ -128,13 +183,52 @@ func (w *Watcher) eventLoop() {
 		pendingEvents = make(map[string]struct{})
 		w.mu.Unlock()
 
+		start := time.Now()
+		stats := Stats{FailFiles: make(map[string][]string)}
+		w.largest.Store(newLargestFiles())
+
+		// Rename events do not say which side they are for: a path that no longer
+		// exists was removed or renamed away, anything else was added or renamed in
+		var removed []string
 		for _, p := range paths {
-			w.handleAdd(p)
+			if _, err := os.Lstat(p); os.IsNotExist(err) {
+				removed = append(removed, p)
+				continue
+			}
+			w.handleAdd(p, &stats)
 		}
+		// Removals go last so that renamed files have already carried their links over
+		for _, p := range removed {
+			w.handleRemove(p, &stats)
+		}
+
+		if w.options.OnBatch != nil && stats.SuccessCount+stats.FailCount+stats.DeletedCount+stats.ConflictSkipped > 0 {
+			w.options.OnBatch(start, time.Now(), stats)
+		}
+	}
+
+	// Files held back by the stability check are looked at again every second
+	var recheck <-chan time.Time
+	if w.stabilityEnabled() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		recheck = ticker.C
 	}
 
 	for {
 		select {
+		case <-recheck:
+			due := w.duePending()
+			if len(due) == 0 {
+				continue
+			}
+			w.mu.Lock()
+			for _, p := range due {
+				pendingEvents[p] = struct{}{}
+			}
+			w.mu.Unlock()
+			go processEvents()
+
 		case event, ok := <-w.events:
 			if !ok {
 				return
@@ -162,87 +256,566 @@ func (w *Watcher) eventLoop() {
 	}
 }
 
-func (w *Watcher) handleAdd(path string) {
-	// Ignore if directory (logic focuses on files)
+// handleAdd links a single changed file and counts the outcome in stats
+func (w *Watcher) handleAdd(path string, stats *Stats) {
+	// A directory moved into the tree only produces an event for itself.
+	// Companions inside it are linked with their primaries.
 	info, err := os.Stat(path)
 	if err == nil && info.IsDir() {
+		filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && !isCompanion(p, w.options) {
+				w.handleAdd(p, stats)
+			}
+			return nil
+		})
 		return
 	}
 
-	// Check Supported
-	supported := Supported(path, w.options.Include, w.options.Exclude)
-	if !supported {
+	// Check Supported; a companion waits until its primary is there
+	if err != nil || !linkable(path, info, w.options) {
+		return
+	}
+	if isCompanion(path, w.options) {
+		w.handleCompanion(path, findPrimary(path, w.options), stats)
+		return
+	}
+
+	// Wait until a download has finished writing the file
+	if !w.checkStable(path) {
+		return
+	}
+
+	// The catch-up scan already handles this file
+	if !w.claim(path, claimEvent) {
+		return
+	}
+
+	// Check Cache; companions added since are still linked
+	if w.isCached(path) {
+		w.handleCompanions(path, stats)
+		return
+	}
+
+	// Find Source Root for this file
+	sourceRoot := w.sourceRoot(path)
+	if sourceRoot == "" {
 		return
 	}
 
-	// Check Cache
+	dests := w.options.PathsMapping[sourceRoot]
+
+	// Recognise files renamed or moved within the source tree by inode or content
+	var meta FileMeta
+	var moved map[string]bool
 	if w.options.OpenCache {
-		// 1. L1 Memory Cache Check
-		if _, ok := w.memCache.Load(path); ok {
+		meta, _ = fileMeta(path, w.options.ContentHash)
+		meta.Path = path
+
+		cache := NewCache()
+		cache.SetTaskID(w.options.TaskID)
+		oldPath, sameInode, ok, err := cache.FindMoved(meta)
+		if err != nil {
+			// Linked as a new file, a renamed source would leave its old links
+			// behind as duplicates; it stays uncached for the next scan
+			w.logger("ERROR", fmt.Sprintf("❌ 查找移动来源失败: %s (%v)", path, err))
+			stats.FailFiles["Cache Lookup Error"] = append(stats.FailFiles["Cache Lookup Error"], path)
+			stats.FailCount++
 			return
 		}
+		if ok {
+			moved = relinkMoved(oldPath, path, sourceRoot, dests, sameInode, w.destOptions(), w.logger)
+			if len(moved) > 0 {
+				if err := cache.Remove([]string{oldPath}); err != nil {
+					// The stale entry only costs a lookup; the new path is still cached
+					w.logger("ERROR", fmt.Sprintf("❌ 移除缓存失败: %s (%v)", oldPath, err))
+					stats.FailFiles["Cache Remove Error"] = append(stats.FailFiles["Cache Remove Error"], oldPath)
+					stats.FailCount++
+				}
+				w.memCache.Delete(oldPath)
+				w.takeLinks(oldPath)
+			}
+		}
+	}
 
-		cache := NewCache()
-		cache.SetTaskID(w.options.TaskID) // Set task ID for cache isolation
+	linked := false
+	for _, dest := range dests {
+		if moved[dest] {
+			stats.SuccessCount++
+			linked = true
+			if target, err := DestPath(path, sourceRoot, dest, w.destOptions()); err == nil {
+				w.rememberLink(path, target, dest)
+			}
+			continue
+		}
 
-		// 2. L2 DB Cache Check
-		if has, _ := cache.Has(path); has {
-			w.logger("WARN", fmt.Sprintf("⚠️ 跳过(已缓存): %s", path))
-			// Add to memory cache
-			w.memCache.Store(path, struct{}{})
-			return
+		target, err := DestPath(path, sourceRoot, dest, w.destOptions())
+		if err != nil {
+			w.logger("ERROR", fmt.Sprintf("❌ 计算目标路径失败: %v", err))
+			stats.FailFiles["Path Calc Error"] = append(stats.FailFiles["Path Calc Error"], path)
+			stats.FailCount++
+			continue
+		}
+
+		if w.linkInto(path, target, dest, stats) {
+			linked = true
 		}
 	}
 
-	// Find Source Root for this file
-	var sourceRoot string
-	for src := range w.options.PathsMapping {
-		if strings.HasPrefix(path, src) {
-			sourceRoot = src
-			break
+	// Cache the file once for all destinations, unless a conflict still needs
+	// attention everywhere. Companions that arrived before their primary were
+	// held back.
+	if linked {
+		w.cacheLinked(meta)
+		w.handleCompanions(path, stats)
+	}
+}
+
+// handleCompanions links the companions of a linked primary
+func (w *Watcher) handleCompanions(primary string, stats *Stats) {
+	if len(w.options.Companions) == 0 || !isPrimary(primary, w.options) {
+		return
+	}
+	for _, c := range companionsOf(primary, w.options) {
+		w.handleCompanion(c, primary, stats)
+	}
+}
+
+// handleCompanion links a companion next to each link of its primary. Where the
+// primary is not linked yet nothing happens; it takes the companion along later.
+func (w *Watcher) handleCompanion(path, primary string, stats *Stats) {
+	if primary == "" || !w.checkStable(path) || !w.claim(path, claimEvent) || w.isCached(path) {
+		return
+	}
+	sourceRoot := w.sourceRoot(path)
+	if sourceRoot == "" {
+		return
+	}
+
+	var meta FileMeta
+	if w.options.OpenCache {
+		meta, _ = fileMeta(path, w.options.ContentHash)
+		meta.Path = path
+	}
+	linked := false
+	for _, dest := range w.options.PathsMapping[sourceRoot] {
+		primaryTarget := w.primaryTarget(primary, sourceRoot, dest)
+		if primaryTarget == "" {
+			continue
+		}
+		if w.linkInto(path, companionTarget(path, primary, primaryTarget), dest, stats) {
+			linked = true
+		}
+	}
+	if linked {
+		w.cacheLinked(meta)
+	}
+}
+
+// primaryTarget returns where primary is linked in dest, or "" if it is not
+func (w *Watcher) primaryTarget(primary, sourceRoot, dest string) string {
+	w.linksMu.Lock()
+	for _, lt := range w.links[primary] {
+		if lt.dest == dest {
+			w.linksMu.Unlock()
+			return lt.path
 		}
 	}
+	w.linksMu.Unlock()
+
+	// Linked before the watcher started
+	if target, err := DestPath(primary, sourceRoot, dest, w.destOptions()); err == nil && linkedAt(primary, target) {
+		return target
+	}
+	return ""
+}
+
+// linkInto links path to target, counts and logs the outcome and records the
+// link; it reports whether the destination is settled
+func (w *Watcher) linkInto(path, target, dest string, stats *Stats) bool {
+	res, err := linkFile(path, target, w.options, nil)
+	if err != nil {
+		w.logger("ERROR", fmt.Sprintf("❌ 硬链失败: %v", err))
+		stats.FailFiles[err.Error()] = append(stats.FailFiles[err.Error()], path+" -> "+target)
+		stats.FailCount++
+		return false
+	}
+
+	logLink(w.logger, path, res)
+	countLink(stats, path, res)
+	if res.created() {
+		stats.SuccessCount++
+	}
+	if res.created() || res.Outcome == OutcomeExisting {
+		w.rememberLink(path, res.Target, dest)
+	}
+
+	return res.settled()
+}
+
+// cacheLinked records a linked file when the cache is enabled
+func (w *Watcher) cacheLinked(meta FileMeta) {
+	if w.options.OpenCache {
+		w.addToCache(meta)
+	}
+}
+
+// isCached reports whether path is in the memory or DB cache
+func (w *Watcher) isCached(path string) bool {
+	if !w.options.OpenCache {
+		return false
+	}
+	// 1. L1 Memory Cache Check
+	if _, ok := w.memCache.Load(path); ok {
+		return true
+	}
+	if w.preloaded.Load() {
+		return false
+	}
+
+	cache := NewCache()
+	cache.SetTaskID(w.options.TaskID) // Set task ID for cache isolation
+
+	// 2. L2 DB Cache Check, only while preloading or after a failed preload
+	has, err := cache.Has(path)
+	if err != nil {
+		// Linking again is harmless: the existing link is recognised
+		w.logger("WARN", fmt.Sprintf("⚠️ 查询缓存失败: %s (%v)", path, err))
+		return false
+	}
+	if has {
+		w.logger("WARN", fmt.Sprintf("⚠️ 跳过(已缓存): %s", path))
+		// Add to memory cache
+		w.memCache.Store(path, struct{}{})
+		return true
+	}
+	return false
+}
+
+// catchUp links the files that appeared while nobody was watching by running a
+// full incremental pass over the sources. It runs alongside event handling;
+// claims keep both sides from processing the same file.
+func (w *Watcher) catchUp() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-w.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	w.claimsMu.Lock()
+	w.claims = make(map[string]string)
+	w.claimsMu.Unlock()
+	defer func() {
+		w.claimsMu.Lock()
+		w.claims = nil
+		w.claimsMu.Unlock()
+	}()
+
+	taskName := w.options.Name
+	w.logger("INFO", fmt.Sprintf("🔍 [%s] 开始启动补扫...", taskName))
+
+	opts := w.options
+	opts.OnProgress = nil
+	// checkStable holds back downloads and young files instead of dropping them
+	opts.MinAgeSeconds = 0
+	opts.StableSeconds = 0
+	opts.TempSuffixes = nil
+	opts.Claim = w.scanClaim
+	// Links from earlier runs are recorded too, so that deleting their source
+	// removes them even without the cache. Run writes the DB cache itself; the
+	// memory cache learns the files here, as it is not queried again once preloaded.
+	opts.OnLinked = func(source, target string) {
+		w.rememberScanLink(source, target)
+		if w.options.OpenCache {
+			w.memCache.Store(source, struct{}{})
+		}
+	}
+
+	start := time.Now()
+	stats, err := Run(ctx, opts, w.logger)
+	end := time.Now()
+
+	switch {
+	case stats.Cancelled:
+		w.logger("WARN", fmt.Sprintf("⏹️ [%s] 启动补扫已取消 (成功: %d, 失败: %d)", taskName, stats.SuccessCount, stats.FailCount))
+	case err != nil:
+		w.logger("ERROR", fmt.Sprintf("❌ [%s] 启动补扫失败: %v", taskName, err))
+	default:
+		w.logger("INFO", fmt.Sprintf("✅ [%s] 启动补扫完成 (成功: %d, 失败: %d, 耗时 %.1f 秒)", taskName, stats.SuccessCount, stats.FailCount, end.Sub(start).Seconds()))
+	}
+
+	if w.options.OnScan != nil {
+		w.options.OnScan(start, end, stats, err)
+	}
+}
+
+// claim reports whether owner may process path. While the catch-up scan runs the
+// first owner to claim a file keeps it; outside of a scan every claim succeeds.
+func (w *Watcher) claim(path, owner string) bool {
+	w.claimsMu.Lock()
+	defer w.claimsMu.Unlock()
+	if w.claims == nil {
+		return true
+	}
+	if current, ok := w.claims[path]; ok {
+		return current == owner
+	}
+	w.claims[path] = owner
+	return true
+}
+
+// scanClaim is the Claim of the catch-up scan. Download temp files, files next
+// to a temp sibling and files written within the stable window are left
+// unclaimed: checkStable queues them as pending, and events for them are still
+// handled while the scan runs. The claim is released once the file is done.
+func (w *Watcher) scanClaim(path string) (release func(), ok bool) {
+	if !w.checkStable(path) || !w.claim(path, claimScan) {
+		return nil, false
+	}
+	return func() { w.unclaim(path, claimScan) }, true
+}
+
+// unclaim gives up owner's claim on path once it is done, so that claims only
+// holds the files being processed and those left to events
+func (w *Watcher) unclaim(path, owner string) {
+	w.claimsMu.Lock()
+	defer w.claimsMu.Unlock()
+	if w.claims[path] == owner {
+		delete(w.claims, path)
+	}
+}
+
+// handleRemove deletes the destination links of a source file (or of every known
+// file below a source directory) that was deleted or renamed away, and evicts them
+// from the cache. A destination file is only removed while it still is the link to
+// the source. Emptied destination directories are removed when DeleteDir is set.
+func (w *Watcher) handleRemove(path string, stats *Stats) {
+	w.dropPending(path)
+
+	sourceRoot := w.sourceRoot(path)
 	if sourceRoot == "" {
 		return
 	}
 
-	dests := w.options.PathsMapping[sourceRoot]
-	for _, dest := range dests {
-		targetDir, err := GetOriginalDestPath(path, sourceRoot, dest, w.options.KeepDirStruct, w.options.MkdirIfSingle)
-		if err != nil {
-			w.logger("ERROR", fmt.Sprintf("❌ 计算目标路径失败: %v", err))
+	var cache *Cache
+	if w.options.OpenCache {
+		cache = NewCache()
+		cache.SetTaskID(w.options.TaskID)
+	}
+
+	// A removed directory is expanded to the files we know were inside it
+	files := []string{path}
+	if cache != nil {
+		if under, err := cache.FindUnder(path); err == nil && len(under) > 0 {
+			files = under
+		}
+	}
+	if len(files) == 1 {
+		if under := w.linkedUnder(path); len(under) > 0 {
+			files = under
+		}
+	}
+
+	var evicted []string
+	for _, f := range files {
+		if !w.options.matches(f) && !isCompanion(f, w.options) {
 			continue
 		}
 
-		finalTarget, err := Link(path, targetDir)
-		linkSuccess := true
-		if err != nil {
-			if strings.Contains(err.Error(), "file exists") {
-				// File already exists, but should still be added to cache
-				w.logger("WARN", fmt.Sprintf("⚠️ 文件已存在: %s → %s", path, finalTarget))
-			} else {
-				w.logger("ERROR", fmt.Sprintf("❌ 硬链失败: %v", err))
-				linkSuccess = false
+		// Links made by this watcher are known with their final names, e.g.
+		// after ConflictRename; otherwise the cache tells the inode they share
+		targets := w.takeLinks(f)
+		if len(targets) == 0 {
+			var prev *FileMeta
+			if cache != nil {
+				prev, _ = cache.GetMeta(f)
+			}
+			for _, dest := range w.options.PathsMapping[sourceRoot] {
+				target, err := DestPath(f, sourceRoot, dest, w.destOptions())
+				if err != nil {
+					continue
+				}
+				lt := linkedTarget{path: target, dest: dest}
+				if prev != nil {
+					lt.device, lt.inode = prev.Device, prev.Inode
+				}
+				targets = append(targets, lt)
 			}
-		} else {
-			w.logger("SUCCEED", fmt.Sprintf("✅ 硬链成功: %s → %s", path, finalTarget))
 		}
 
-		// Add to cache if enabled and processing was successful or file exists
-		if w.options.OpenCache && linkSuccess {
-			cache := NewCache()
-			cache.SetTaskID(w.options.TaskID) // Set task ID for cache isolation
+		for _, lt := range targets {
+			// Already gone, e.g. moved along with a renamed source
+			info, err := os.Lstat(lt.path)
+			if err != nil || info.IsDir() {
+				continue
+			}
 
-			// Add file to cache
-			if err := cache.Add([]string{path}); err != nil {
-				w.logger("ERROR", fmt.Sprintf("❌ 写入缓存失败: %v", err))
-			} else {
-				w.logger("INFO", fmt.Sprintf("💾 已加入缓存: %s", path))
-				// Add to memory cache
-				w.memCache.Store(path, struct{}{})
+			// Never remove a file that is not our link, like a different file
+			// left in place by the conflict policy
+			if !lt.isLinkOf(f, info) {
+				w.logger("WARN", fmt.Sprintf("⚠️ 目标不是该源文件的链接，保留: %s", lt.path))
+				continue
+			}
+
+			if err := os.Remove(lt.path); err != nil {
+				w.logger("ERROR", fmt.Sprintf("❌ 同步删除失败: %s (%v)", lt.path, err))
+				recordFailure(stats, err, lt.path)
+				continue
 			}
+			w.logger("SUCCEED", fmt.Sprintf("🗑️ 源文件已删除，同步删除: %s", lt.path))
+			stats.DeletedCount++
+			stats.SuccessCount++
+
+			if w.options.DeleteDir {
+				removeEmptyParents(filepath.Dir(lt.path), lt.dest)
+			}
+		}
+
+		evicted = append(evicted, f)
+		w.memCache.Delete(f)
+	}
+
+	if cache != nil && len(evicted) > 0 {
+		if err := cache.Remove(evicted); err != nil {
+			w.logger("ERROR", fmt.Sprintf("❌ 移除缓存失败: %v", err))
+			stats.FailFiles["Cache Remove Error"] = append(stats.FailFiles["Cache Remove Error"], evicted...)
+			stats.FailCount++
+		}
+	}
+}
+
+// rememberLink records target as a link of source, see Watcher.links
+func (w *Watcher) rememberLink(source, target, dest string) {
+	info, err := os.Lstat(target)
+	if err != nil {
+		return
+	}
+	lt := linkedTarget{path: target, dest: dest}
+	lt.device, lt.inode = inodeOf(info)
+
+	w.linksMu.Lock()
+	defer w.linksMu.Unlock()
+	targets := w.links[source]
+	for i, t := range targets {
+		if t.path == target {
+			targets[i] = lt
+			return
+		}
+	}
+	w.links[source] = append(targets, lt)
+}
+
+// rememberScanLink records a link the catch-up scan created or found in place
+func (w *Watcher) rememberScanLink(source, target string) {
+	for _, dest := range w.options.PathsMapping[w.sourceRoot(source)] {
+		if inDir(target, dest) {
+			w.rememberLink(source, target, dest)
+			return
+		}
+	}
+}
+
+// takeLinks returns and forgets the links recorded for source
+func (w *Watcher) takeLinks(source string) []linkedTarget {
+	w.linksMu.Lock()
+	defer w.linksMu.Unlock()
+	targets := w.links[source]
+	delete(w.links, source)
+	return targets
+}
+
+// linkedUnder lists the sources with recorded links below dir
+func (w *Watcher) linkedUnder(dir string) []string {
+	w.linksMu.Lock()
+	defer w.linksMu.Unlock()
+	var files []string
+	for source := range w.links {
+		if source != dir && inDir(source, dir) {
+			files = append(files, source)
+		}
+	}
+	return files
+}
+
+// isLinkOf reports whether info, the file found at lt.path, still is the link
+// to source: it has the recorded inode, or is a symlink pointing at source
+func (lt linkedTarget) isLinkOf(source string, info os.FileInfo) bool {
+	if info.Mode()&os.ModeSymlink != 0 {
+		dest, err := os.Readlink(lt.path)
+		if err != nil {
+			return false
+		}
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(filepath.Dir(lt.path), dest)
+		}
+		if filepath.Clean(dest) == filepath.Clean(source) {
+			return true
+		}
+	}
+	device, inode := inodeOf(info)
+	return lt.inode != 0 && device == lt.device && inode == lt.inode
+}
+
+// destOptions returns the options for placing files of the current batch.
+// Outside a batch, e.g. when called from a test, largest is nil and media
+// naming reads each directory afresh.
+func (w *Watcher) destOptions() Options {
+	opts := w.options
+	opts.largest = w.largest.Load()
+	return opts
+}
+
+// sourceRoot returns the watched source that contains path, or "" if none
+func (w *Watcher) sourceRoot(path string) string {
+	for src := range w.options.PathsMapping {
+		if inDir(path, src) {
+			return src
 		}
 	}
+	return ""
+}
+
+// inDir reports whether path is dir or lies below it
+func inDir(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(os.PathSeparator))+string(os.PathSeparator))
+}
+
+// addToCache records a processed file in the DB and memory caches
+func (w *Watcher) addToCache(meta FileMeta) {
+	cache := NewCache()
+	cache.SetTaskID(w.options.TaskID) // Set task ID for cache isolation
+
+	if err := cache.AddMeta([]FileMeta{meta}); err != nil {
+		w.logger("ERROR", fmt.Sprintf("❌ 写入缓存失败: %v", err))
+	} else {
+		w.logger("INFO", fmt.Sprintf("💾 已加入缓存: %s", meta.Path))
+		// Add to memory cache
+		w.memCache.Store(meta.Path, struct{}{})
+	}
+}
+
+// preloadCache loads the task's cached paths into the memory cache. Until it
+// has finished, or if it fails, files not found there are still looked up in
+// the DB, so events arriving meanwhile are handled correctly.
+func (w *Watcher) preloadCache() {
+	cache := NewCache()
+	cache.SetTaskID(w.options.TaskID)
+
+	start := time.Now()
+	count := 0
+	err := cache.EachPath(func(file string) {
+		w.memCache.Store(file, struct{}{})
+		count++
+	})
+	if err != nil {
+		w.logger("WARN", fmt.Sprintf("⚠️ 预加载缓存失败: %v", err))
+		return
+	}
+	w.preloaded.Store(true)
+	w.logger("INFO", fmt.Sprintf("💾 已预加载缓存: %d 个文件 (耗时 %.1f 秒)", count, time.Since(start).Seconds()))
 }
 
 // RemoveFromCache removes specific files from memory cache
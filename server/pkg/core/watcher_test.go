@@ -0,0 +1,260 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestWatcher(t *testing.T, src, dest, policy string) *Watcher {
+	t.Helper()
+	opts := Options{
+		PathsMapping:   map[string][]string{src: {dest}},
+		ConflictPolicy: policy,
+	}
+	w, err := NewWatcher(opts, func(string, string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoveKeepsForeignTarget(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	source := filepath.Join(src, "a.mkv")
+	target := filepath.Join(dest, "a.mkv")
+	writeFile(t, source, "source")
+	writeFile(t, target, "someone else's file")
+
+	w := newTestWatcher(t, src, dest, ConflictSkip)
+	stats := Stats{FailFiles: make(map[string][]string)}
+	w.handleAdd(source, &stats)
+	if stats.ConflictSkipped != 1 {
+		t.Fatalf("conflicts skipped = %d, want 1", stats.ConflictSkipped)
+	}
+
+	os.Remove(source)
+	w.handleRemove(source, &stats)
+
+	if data, err := os.ReadFile(target); err != nil || string(data) != "someone else's file" {
+		t.Fatalf("foreign target was touched: %q, %v", data, err)
+	}
+	if stats.DeletedCount != 0 {
+		t.Errorf("deleted = %d, want 0", stats.DeletedCount)
+	}
+}
+
+func TestRemoveLinkFoundByScan(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	source := filepath.Join(src, "a.mkv")
+	target := filepath.Join(dest, "a.mkv")
+	writeFile(t, source, "source")
+	// Linked by an earlier run, with no cache to tell its inode
+	if err := os.Link(source, target); err != nil {
+		t.Fatal(err)
+	}
+
+	w := newTestWatcher(t, src, dest, ConflictSkip)
+	w.options.ScanOnStart = true
+	w.catchUp()
+
+	os.Remove(source)
+	stats := Stats{FailFiles: make(map[string][]string)}
+	w.handleRemove(source, &stats)
+
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Fatalf("link found by the scan not removed: %v", err)
+	}
+	if stats.DeletedCount != 1 {
+		t.Errorf("deleted = %d, want 1", stats.DeletedCount)
+	}
+}
+
+func TestRemoveRenamedLink(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	source := filepath.Join(src, "a.mkv")
+	target := filepath.Join(dest, "a.mkv")
+	renamed := filepath.Join(dest, "a (1).mkv")
+	writeFile(t, source, "source")
+	writeFile(t, target, "someone else's file")
+
+	w := newTestWatcher(t, src, dest, ConflictRename)
+	stats := Stats{FailFiles: make(map[string][]string)}
+	w.handleAdd(source, &stats)
+	if _, err := os.Stat(renamed); err != nil {
+		t.Fatalf("renamed link missing: %v", err)
+	}
+
+	os.Remove(source)
+	w.handleRemove(source, &stats)
+
+	if _, err := os.Stat(renamed); !os.IsNotExist(err) {
+		t.Errorf("renamed link still exists: %v", err)
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Errorf("foreign target removed: %v", err)
+	}
+}
+
+func TestRemoveOwnLink(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	source := filepath.Join(src, "a.mkv")
+	target := filepath.Join(dest, "a.mkv")
+	writeFile(t, source, "source")
+
+	w := newTestWatcher(t, src, dest, ConflictSkip)
+	stats := Stats{FailFiles: make(map[string][]string)}
+	w.handleAdd(source, &stats)
+
+	os.Remove(source)
+	w.handleRemove(source, &stats)
+
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("link still exists: %v", err)
+	}
+}
+
+func TestRelinkMovedKeepsOtherRoot(t *testing.T) {
+	base, dest := t.TempDir(), t.TempDir()
+	src := filepath.Join(base, "tv")
+	other := filepath.Join(base, "tv2")
+	oldTarget := filepath.Join(dest, "tv2", "a.mkv")
+	for _, dir := range []string{src, other, filepath.Dir(oldTarget)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldPath := filepath.Join(other, "a.mkv")
+	newPath := filepath.Join(src, "b.mkv")
+	writeFile(t, newPath, "source")
+	if err := os.Link(newPath, oldTarget); err != nil {
+		t.Fatal(err)
+	}
+
+	// tv2/a.mkv shares the prefix of the tv root but is not below it
+	opts := Options{PathsMapping: map[string][]string{src: {dest}}}
+	if moved := relinkMoved(oldPath, newPath, src, []string{dest}, true, opts, nil); len(moved) != 0 {
+		t.Fatalf("relinked from another root: %v", moved)
+	}
+	if _, err := os.Lstat(oldTarget); err != nil {
+		t.Fatalf("link of the other root was moved: %v", err)
+	}
+}
+
+func TestScanOnStartHoldsBackDownloads(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	downloading := filepath.Join(src, "a.mkv")
+	writeFile(t, downloading, "partial")
+	writeFile(t, downloading+".part", "state")
+	old := time.Now().Add(-time.Hour)
+	done := filepath.Join(src, "b.mkv")
+	writeFile(t, done, "complete")
+	if err := os.Chtimes(done, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	w := newTestWatcher(t, src, dest, ConflictSkip)
+	w.options.TempSuffixes = []string{".part"}
+	w.options.StableSeconds = 60
+	w.options.ScanOnStart = true
+	w.catchUp()
+
+	for _, name := range []string{"a.mkv", "a.mkv.part"} {
+		if _, err := os.Lstat(filepath.Join(dest, name)); !os.IsNotExist(err) {
+			t.Errorf("%s linked by the scan: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dest, "b.mkv")); err != nil {
+		t.Errorf("settled file not linked: %v", err)
+	}
+	pending := w.Pending()
+	if len(pending) != 1 || pending[0].Path != downloading || pending[0].Reason != PendingTempFile {
+		t.Fatalf("pending = %+v, want only %s waiting for its temp file", pending, downloading)
+	}
+
+	// Left unclaimed, so the event path links it once the download is done
+	if !w.claim(downloading, claimEvent) {
+		t.Fatal("held-back file was claimed by the scan")
+	}
+	if err := os.Remove(downloading + ".part"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(downloading, old, old); err != nil {
+		t.Fatal(err)
+	}
+	w.dropPending(downloading)
+	w.handleAdd(downloading, &Stats{FailFiles: make(map[string][]string)})
+	if _, err := os.Stat(filepath.Join(dest, "a.mkv")); err != nil {
+		t.Errorf("finished download not linked: %v", err)
+	}
+}
+
+func TestIsCachedAfterPreload(t *testing.T) {
+	var warnings []string
+	w, err := NewWatcher(Options{OpenCache: true}, func(level, msg string) {
+		if level == "WARN" {
+			warnings = append(warnings, msg)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.memCache.Store("/src/a.mkv", struct{}{})
+
+	// Before the preload a miss is looked up in the DB, which is not connected here
+	if w.isCached("/src/b.mkv") {
+		t.Error("uncached file reported as cached")
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("warnings = %q, want the failed DB lookup", warnings)
+	}
+
+	// Once preloaded the memory cache is authoritative
+	w.preloaded.Store(true)
+	warnings = nil
+	if !w.isCached("/src/a.mkv") || w.isCached("/src/b.mkv") {
+		t.Error("memory cache not used after the preload")
+	}
+	if len(warnings) != 0 {
+		t.Errorf("DB queried after the preload: %q", warnings)
+	}
+}
+
+func TestScanClaimsReleased(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	for _, name := range []string{"a.mkv", "b.mkv", "c.mkv"} {
+		writeFile(t, filepath.Join(src, name), name)
+	}
+	w := newTestWatcher(t, src, dest, ConflictSkip)
+	w.claims = map[string]string{}
+	// An event got to c.mkv first
+	w.claim(filepath.Join(src, "c.mkv"), claimEvent)
+
+	opts := w.options
+	opts.Claim = w.scanClaim
+	stats, err := Run(context.Background(), opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.SuccessCount != 2 {
+		t.Errorf("linked %d files, want 2", stats.SuccessCount)
+	}
+
+	// Only the event's claim is kept
+	if want := map[string]string{filepath.Join(src, "c.mkv"): claimEvent}; !reflect.DeepEqual(w.claims, want) {
+		t.Errorf("claims = %v, want %v", w.claims, want)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "c.mkv")); !os.IsNotExist(err) {
+		t.Errorf("file claimed by an event was linked by the scan: %v", err)
+	}
+}